@@ -0,0 +1,260 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/node_exporter/collector"
+)
+
+// maxSymlinks bounds the number of symlinks followed for a single path.
+const maxSymlinks = 40
+
+// captureFixturesTo runs the enabled collectors once in a traced child process
+// and writes the procfs and sysfs files they accessed to a ttar archive, laid
+// out like collector/fixtures.
+func captureFixturesTo(archive string, logger log.Logger) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	procPath, err := filepath.Abs(collector.ProcPath())
+	if err != nil {
+		return err
+	}
+	sysPath, err := filepath.Abs(collector.SysPath())
+	if err != nil {
+		return err
+	}
+
+	a := newFixtureArchive(map[string]string{"proc": procPath, "sys": sysPath})
+	args := append(captureChildArgs(os.Args[1:]), "--dump", "--dump.file="+os.DevNull)
+	exitCode, err := traceOpenedPaths(exe, args, func(pid int, path string) {
+		a.add(a.resolveSelf(pid, path))
+	})
+	if err != nil {
+		return err
+	}
+	if exitCode != 0 {
+		level.Warn(logger).Log("msg", "Collectors failed while capturing fixtures", "exit_code", exitCode)
+	}
+
+	f, err := os.Create(archive)
+	if err != nil {
+		return err
+	}
+	err = a.write(f, "node_exporter --capture-fixtures")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't write fixtures: %s", err)
+	}
+	level.Info(logger).Log("msg", "Captured fixtures", "archive", archive, "entries", len(a.entries))
+	return nil
+}
+
+// captureChildArgs removes the flags selecting the mode of operation from the
+// command line, so it can be passed to the child dumping the metrics.
+func captureChildArgs(args []string) []string {
+	var child []string
+	for i := 0; i < len(args); i++ {
+		switch arg := args[i]; {
+		case arg == "--capture-fixtures" || arg == "--dump.file":
+			// Skip the value too.
+			i++
+		case strings.HasPrefix(arg, "--capture-fixtures="),
+			strings.HasPrefix(arg, "--dump.file="),
+			arg == "--dump", arg == "--no-dump":
+		default:
+			child = append(child, arg)
+		}
+	}
+	return child
+}
+
+type fixtureEntry struct {
+	dir       bool
+	mode      os.FileMode
+	content   []byte
+	symlinkTo string
+}
+
+// fixtureArchive collects files below a set of roots, keyed by the path in
+// the archive. Symlinks are kept and followed as long as they point below a
+// root.
+type fixtureArchive struct {
+	// roots maps the top-level directory names in the archive to absolute
+	// paths.
+	roots   map[string]string
+	entries map[string]*fixtureEntry
+	seen    map[string]bool
+}
+
+func newFixtureArchive(roots map[string]string) *fixtureArchive {
+	return &fixtureArchive{
+		roots:   roots,
+		entries: make(map[string]*fixtureEntry),
+		seen:    make(map[string]bool),
+	}
+}
+
+// resolveSelf replaces /proc/self in a path of the traced process by its pid,
+// as the link would point to the capturing process otherwise.
+func (a *fixtureArchive) resolveSelf(pid int, path string) string {
+	proc, ok := a.roots["proc"]
+	if !ok {
+		return path
+	}
+	self := filepath.Join(proc, "self")
+	if path != self && !strings.HasPrefix(path, self+"/") {
+		return path
+	}
+	a.entries["proc/self"] = &fixtureEntry{symlinkTo: strconv.Itoa(pid)}
+	return filepath.Join(proc, strconv.Itoa(pid)) + strings.TrimPrefix(path, self)
+}
+
+// add adds the file at path, if it is below a root, together with the
+// directories and symlinks leading to it.
+func (a *fixtureArchive) add(path string) {
+	a.addPath(filepath.Clean(path), 0)
+}
+
+func (a *fixtureArchive) addPath(path string, symlinks int) {
+	if a.seen[path] || symlinks > maxSymlinks {
+		return
+	}
+	a.seen[path] = true
+
+	var name, root string
+	for n, r := range a.roots {
+		if path == r || strings.HasPrefix(path, r+"/") {
+			name, root = n, r
+			break
+		}
+	}
+	if root == "" {
+		return
+	}
+
+	fi, err := os.Stat(root)
+	if err != nil {
+		return
+	}
+	if _, ok := a.entries[name]; !ok {
+		a.entries[name] = &fixtureEntry{dir: true, mode: fi.Mode()}
+	}
+
+	rel := strings.TrimPrefix(strings.TrimPrefix(path, root), "/")
+	if rel == "" {
+		return
+	}
+	components := strings.Split(rel, "/")
+	current, archivePath := root, name
+	for i, c := range components {
+		current = filepath.Join(current, c)
+		archivePath = archivePath + "/" + c
+		fi, err := os.Lstat(current)
+		if err != nil {
+			return
+		}
+		switch {
+		case fi.Mode()&os.ModeSymlink != 0:
+			target, err := os.Readlink(current)
+			if err != nil {
+				return
+			}
+			if _, ok := a.entries[archivePath]; !ok {
+				a.entries[archivePath] = &fixtureEntry{symlinkTo: target}
+			}
+			if !filepath.IsAbs(target) {
+				target = filepath.Join(filepath.Dir(current), target)
+			}
+			a.addPath(filepath.Join(append([]string{target}, components[i+1:]...)...), symlinks+1)
+			return
+		case fi.IsDir():
+			if _, ok := a.entries[archivePath]; !ok {
+				a.entries[archivePath] = &fixtureEntry{dir: true, mode: fi.Mode()}
+			}
+		case fi.Mode().IsRegular() && i == len(components)-1:
+			// Some files, like write-only sysfs attributes, can't be read.
+			content, err := ioutil.ReadFile(current)
+			if err != nil {
+				return
+			}
+			a.entries[archivePath] = &fixtureEntry{mode: fi.Mode(), content: content}
+		default:
+			return
+		}
+	}
+}
+
+// write writes the archive in the format of the ttar script.
+func (a *fixtureArchive) write(w io.Writer, createdBy string) error {
+	names := make([]string, 0, len(a.entries))
+	for name := range a.entries {
+		names = append(names, name)
+	}
+	// Sort by path components, so directories come before their contents.
+	sort.Slice(names, func(i, j int) bool {
+		return strings.Replace(names[i], "/", "\x00", -1) < strings.Replace(names[j], "/", "\x00", -1)
+	})
+
+	bw := bufio.NewWriter(w)
+	fmt.Fprintf(bw, "# Archive created by %s\n", createdBy)
+	for _, name := range names {
+		e := a.entries[name]
+		switch {
+		case e.symlinkTo != "":
+			fmt.Fprintf(bw, "Path: %s\nSymlinkTo: %s\n", name, e.symlinkTo)
+		case e.dir:
+			fmt.Fprintf(bw, "Directory: %s\nMode: %o\n", name, e.mode.Perm())
+		default:
+			lines := bytes.Count(e.content, []byte("\n"))
+			noEOL := len(e.content) > 0 && e.content[len(e.content)-1] != '\n'
+			if noEOL {
+				lines++
+			}
+			fmt.Fprintf(bw, "Path: %s\nLines: %d\n", name, lines)
+			bw.Write(ttarEscape(e.content))
+			if noEOL {
+				// The ttar marker for a last line without linefeed.
+				bw.WriteString("EOF\n")
+			}
+			fmt.Fprintf(bw, "Mode: %o\n", e.mode.Perm())
+		}
+		bw.WriteString("# ttar - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -\n")
+	}
+	return bw.Flush()
+}
+
+// ttarEscape escapes the markers ttar uses for null bytes and missing final
+// linefeeds.
+func ttarEscape(b []byte) []byte {
+	b = bytes.Replace(b, []byte("EOF"), []byte(`\EOF`), -1)
+	b = bytes.Replace(b, []byte("NULLBYTE"), []byte(`\NULLBYTE`), -1)
+	return bytes.Replace(b, []byte{0}, []byte("NULLBYTE"), -1)
+}
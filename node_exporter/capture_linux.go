@@ -0,0 +1,129 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// traceOpenedPaths runs the executable as a child process traced with
+// ptrace(2) and calls fn with the pid of the child and the absolute path of
+// every file it opens, stats or reads the link of, while the child is stopped
+// in that syscall. It returns the exit code of the child.
+func traceOpenedPaths(exe string, args []string, fn func(pid int, path string)) (int, error) {
+	// All ptrace requests have to come from the thread which started the
+	// child.
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	cwd, err := os.Getwd()
+	if err != nil {
+		return 0, err
+	}
+
+	cmd := exec.Command(exe, args...)
+	cmd.Stderr = os.Stderr
+	cmd.SysProcAttr = &syscall.SysProcAttr{Ptrace: true}
+	if err := cmd.Start(); err != nil {
+		return 0, fmt.Errorf("failed to start %s: %w", exe, err)
+	}
+	pid := cmd.Process.Pid
+
+	// The child stops with a SIGTRAP after exec.
+	var ws unix.WaitStatus
+	if _, err := unix.Wait4(pid, &ws, 0, nil); err != nil {
+		return 0, fmt.Errorf("failed to wait for child: %w", err)
+	}
+	options := unix.PTRACE_O_TRACESYSGOOD | unix.PTRACE_O_TRACECLONE | unix.PTRACE_O_EXITKILL
+	if err := unix.PtraceSetOptions(pid, options); err != nil {
+		return 0, fmt.Errorf("failed to set ptrace options: %w", err)
+	}
+	if err := unix.PtraceSyscall(pid, 0); err != nil {
+		return 0, fmt.Errorf("failed to resume child: %w", err)
+	}
+
+	for {
+		tid, err := unix.Wait4(-1, &ws, unix.WALL, nil)
+		if err == unix.EINTR {
+			continue
+		}
+		if err != nil {
+			return 0, fmt.Errorf("failed to wait for child: %w", err)
+		}
+		switch {
+		case ws.Exited() && tid == pid:
+			return ws.ExitStatus(), nil
+		case ws.Signaled() && tid == pid:
+			return 0, fmt.Errorf("child killed by %s", ws.Signal())
+		case !ws.Stopped():
+			continue
+		}
+
+		var signal int
+		switch sig := ws.StopSignal(); {
+		case sig == unix.SIGTRAP|0x80:
+			// Syscall entry or exit, the path arguments are valid in both.
+			if addr, ok := syscallPathAddr(tid); ok {
+				if path, ok := peekString(tid, addr); ok {
+					if !filepath.IsAbs(path) {
+						path = filepath.Join(cwd, path)
+					}
+					fn(pid, path)
+				}
+			}
+		case sig == unix.SIGTRAP && ws.TrapCause() > 0:
+			// A ptrace event like the creation of a thread.
+		case sig == unix.SIGSTOP:
+			// New threads start with a SIGSTOP.
+		default:
+			signal = int(sig)
+		}
+		// The thread may have exited in between.
+		if err := unix.PtraceSyscall(tid, signal); err != nil && err != unix.ESRCH {
+			return 0, fmt.Errorf("failed to resume thread %d: %w", tid, err)
+		}
+	}
+}
+
+// peekString reads a NUL-terminated string from the memory of a stopped
+// thread.
+func peekString(tid int, addr uintptr) (string, bool) {
+	var (
+		s     []byte
+		chunk = make([]byte, 256)
+	)
+	for len(s) < unix.PathMax {
+		n, err := unix.PtracePeekData(tid, addr+uintptr(len(s)), chunk)
+		if i := bytes.IndexByte(chunk[:n], 0); i >= 0 {
+			return string(append(s, chunk[:i]...)), true
+		}
+		if err != nil || n == 0 {
+			return "", false
+		}
+		s = append(s, chunk[:n]...)
+	}
+	return "", false
+}
@@ -0,0 +1,32 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import "golang.org/x/sys/unix"
+
+// syscallPathAddr returns the address of the path argument of the syscall a
+// thread is stopped in, if it is one accessing a file by path.
+func syscallPathAddr(tid int) (uintptr, bool) {
+	var regs unix.PtraceRegs
+	if err := unix.PtraceGetRegs(tid, &regs); err != nil {
+		return 0, false
+	}
+	switch regs.Orig_rax {
+	case unix.SYS_OPEN, unix.SYS_STAT, unix.SYS_LSTAT, unix.SYS_READLINK:
+		return uintptr(regs.Rdi), true
+	case unix.SYS_OPENAT, unix.SYS_NEWFSTATAT, unix.SYS_READLINKAT:
+		return uintptr(regs.Rsi), true
+	}
+	return 0, false
+}
@@ -0,0 +1,41 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"unsafe"
+
+	"golang.org/x/sys/unix"
+)
+
+// ntPrstatus selects the general purpose registers in PTRACE_GETREGSET.
+const ntPrstatus = 1
+
+// syscallPathAddr returns the address of the path argument of the syscall a
+// thread is stopped in, if it is one accessing a file by path. arm64 only
+// has the *at syscalls and only supports PTRACE_GETREGSET.
+func syscallPathAddr(tid int) (uintptr, bool) {
+	var regs unix.PtraceRegs
+	iov := unix.Iovec{Base: (*byte)(unsafe.Pointer(&regs))}
+	iov.SetLen(int(unsafe.Sizeof(regs)))
+	_, _, errno := unix.Syscall6(unix.SYS_PTRACE, unix.PTRACE_GETREGSET, uintptr(tid), ntPrstatus, uintptr(unsafe.Pointer(&iov)), 0, 0)
+	if errno != 0 {
+		return 0, false
+	}
+	switch regs.Regs[8] {
+	case unix.SYS_OPENAT, unix.SYS_FSTATAT, unix.SYS_READLINKAT:
+		return uintptr(regs.Regs[1]), true
+	}
+	return 0, false
+}
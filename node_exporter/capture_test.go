@@ -0,0 +1,116 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestCaptureChildArgs(t *testing.T) {
+	args := []string{
+		"--capture-fixtures", "a.ttar",
+		"--collector.disable-defaults",
+		"--capture-fixtures=b.ttar",
+		"--dump",
+		"--dump.file=-",
+		"--path.sysfs", "/host/sys",
+	}
+	want := []string{"--collector.disable-defaults", "--path.sysfs", "/host/sys"}
+	if got := captureChildArgs(args); !reflect.DeepEqual(got, want) {
+		t.Errorf("want %q, got %q", want, got)
+	}
+}
+
+func TestFixtureArchive(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-exporter-fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sys := filepath.Join(dir, "sys")
+	for _, d := range []string{"class/net", "devices/virtual/net/lo"} {
+		if err := os.MkdirAll(filepath.Join(sys, d), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	files := map[string]string{
+		"devices/virtual/net/lo/mtu":     "65536\n",
+		"devices/virtual/net/lo/ifalias": "EOF\x00NULLBYTE",
+		"devices/virtual/net/lo/other":   "not accessed\n",
+	}
+	for name, content := range files {
+		if err := ioutil.WriteFile(filepath.Join(sys, name), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Symlink("../../devices/virtual/net/lo", filepath.Join(sys, "class/net/lo")); err != nil {
+		t.Fatal(err)
+	}
+
+	a := newFixtureArchive(map[string]string{"sys": sys})
+	a.add(filepath.Join(sys, "class/net/lo/mtu"))
+	a.add(filepath.Join(sys, "class/net/lo/ifalias"))
+	a.add(filepath.Join(sys, "class/net/lo/missing"))
+	a.add(filepath.Join(dir, "outside"))
+
+	var buf bytes.Buffer
+	if err := a.write(&buf, "test"); err != nil {
+		t.Fatal(err)
+	}
+	want := `# Archive created by test
+Directory: sys
+Mode: 755
+# ttar - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+Directory: sys/class
+Mode: 755
+# ttar - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+Directory: sys/class/net
+Mode: 755
+# ttar - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+Path: sys/class/net/lo
+SymlinkTo: ../../devices/virtual/net/lo
+# ttar - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+Directory: sys/devices
+Mode: 755
+# ttar - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+Directory: sys/devices/virtual
+Mode: 755
+# ttar - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+Directory: sys/devices/virtual/net
+Mode: 755
+# ttar - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+Directory: sys/devices/virtual/net/lo
+Mode: 755
+# ttar - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+Path: sys/devices/virtual/net/lo/ifalias
+Lines: 1
+\EOFNULLBYTE\NULLBYTEEOF
+Mode: 644
+# ttar - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+Path: sys/devices/virtual/net/lo/mtu
+Lines: 1
+65536
+Mode: 644
+# ttar - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - - -
+`
+	if got := buf.String(); got != want {
+		t.Errorf("want archive:\n%s\ngot:\n%s", want, got)
+	}
+}
@@ -17,11 +17,13 @@
 package collector
 
 import (
+	"bufio"
 	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
+	"strconv"
 	"strings"
 
 	"github.com/go-kit/log"
@@ -30,8 +32,54 @@ import (
 )
 
 type bondingCollector struct {
-	slaves, active typedDesc
-	logger         log.Logger
+	slaves, active                    typedDesc
+	info                              typedDesc
+	slaveUp, slaveLinkFailures        typedDesc
+	slaveSpeed, slaveInfo             typedDesc
+	adInfo, adPorts                   typedDesc
+	slaveADInfo, slaveADAggregated    typedDesc
+	slaveADActorState, slaveADPartner typedDesc
+	logger                            log.Logger
+}
+
+// bondingDetail is the state of a bonding interface as reported by
+// /proc/net/bonding/<master>.
+type bondingDetail struct {
+	mode        string
+	activeSlave string
+	aggregator  *bondingAggregator // only set in 802.3ad mode
+	slaves      []*bondingSlave
+}
+
+type bondingAggregator struct {
+	id         string
+	ports      uint64
+	partnerMAC string
+	lacpRate   string
+}
+
+type bondingSlave struct {
+	name             string
+	miiStatus        string
+	speed            *float64 // in bytes per second
+	duplex           string
+	linkFailures     uint64
+	aggregatorID     string
+	partnerMAC       string
+	actorPortState   *uint64
+	partnerPortState *uint64
+}
+
+// bondingModes maps the mode descriptions used in /proc/net/bonding to the
+// mode names used when configuring bonding interfaces.
+var bondingModes = map[string]string{
+	"load balancing (round-robin)":          "balance-rr",
+	"fault-tolerance (active-backup)":       "active-backup",
+	"load balancing (xor)":                  "balance-xor",
+	"fault-tolerance (broadcast)":           "broadcast",
+	"IEEE 802.3ad Dynamic link aggregation": "802.3ad",
+	"transmit load balancing":               "balance-tlb",
+	"adaptive load balancing":               "balance-alb",
 }
 
 func init() {
@@ -52,6 +100,61 @@ func NewBondingCollector(logger log.Logger) (Collector, error) {
 			"Number of active slaves per bonding interface.",
 			[]string{"master"}, nil,
 		), prometheus.GaugeValue},
+		info: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "info"),
+			"A metric with a constant '1' value labeled by the mode and currently active slave of a bonding interface.",
+			[]string{"master", "mode", "active_slave"}, nil,
+		), prometheus.GaugeValue},
+		slaveUp: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "slave_up"),
+			"Whether the MII status of a bonding slave is up.",
+			[]string{"master", "slave"}, nil,
+		), prometheus.GaugeValue},
+		slaveLinkFailures: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "slave_link_failures_total"),
+			"Number of link failures of a bonding slave.",
+			[]string{"master", "slave"}, nil,
+		), prometheus.CounterValue},
+		slaveSpeed: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "slave_speed_bytes"),
+			"Speed of a bonding slave in bytes per second.",
+			[]string{"master", "slave"}, nil,
+		), prometheus.GaugeValue},
+		slaveInfo: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "slave_info"),
+			"A metric with a constant '1' value labeled by the duplex mode of a bonding slave.",
+			[]string{"master", "slave", "duplex"}, nil,
+		), prometheus.GaugeValue},
+		adInfo: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "ad_info"),
+			"A metric with a constant '1' value labeled by the active aggregator, its partner MAC address and the LACP rate of an 802.3ad bonding interface.",
+			[]string{"master", "aggregator_id", "partner_mac", "lacp_rate"}, nil,
+		), prometheus.GaugeValue},
+		adPorts: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "ad_active_aggregator_ports"),
+			"Number of ports in the active aggregator of an 802.3ad bonding interface.",
+			[]string{"master"}, nil,
+		), prometheus.GaugeValue},
+		slaveADInfo: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "slave_ad_info"),
+			"A metric with a constant '1' value labeled by the aggregator and LACP partner MAC address of an 802.3ad bonding slave.",
+			[]string{"master", "slave", "aggregator_id", "partner_mac"}, nil,
+		), prometheus.GaugeValue},
+		slaveADAggregated: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "slave_ad_in_active_aggregator"),
+			"Whether an 802.3ad bonding slave is part of the active aggregator.",
+			[]string{"master", "slave"}, nil,
+		), prometheus.GaugeValue},
+		slaveADActorState: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "slave_ad_actor_port_state"),
+			"LACP port state bitmask sent by an 802.3ad bonding slave.",
+			[]string{"master", "slave"}, nil,
+		), prometheus.GaugeValue},
+		slaveADPartner: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "bonding", "slave_ad_partner_port_state"),
+			"LACP port state bitmask received from the partner of an 802.3ad bonding slave.",
+			[]string{"master", "slave"}, nil,
+		), prometheus.GaugeValue},
 		logger: logger,
 	}, nil
 }
@@ -70,10 +173,58 @@ func (c *bondingCollector) Update(ch chan<- prometheus.Metric) error {
 	for master, status := range bondingStats {
 		ch <- c.slaves.mustNewConstMetric(float64(status[0]), master)
 		ch <- c.active.mustNewConstMetric(float64(status[1]), master)
+
+		detailfile := procFilePath(filepath.Join("net/bonding", master))
+		detail, err := readBondingDetail(detailfile)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				level.Debug(c.logger).Log("msg", "Not collecting bonding details, file does not exist", "file", detailfile)
+				continue
+			}
+			return err
+		}
+		c.updateDetail(ch, master, detail)
 	}
 	return nil
 }
 
+func (c *bondingCollector) updateDetail(ch chan<- prometheus.Metric, master string, detail *bondingDetail) {
+	ch <- c.info.mustNewConstMetric(1.0, master, detail.mode, detail.activeSlave)
+	if agg := detail.aggregator; agg != nil {
+		ch <- c.adInfo.mustNewConstMetric(1.0, master, agg.id, agg.partnerMAC, agg.lacpRate)
+		ch <- c.adPorts.mustNewConstMetric(float64(agg.ports), master)
+	}
+
+	for _, slave := range detail.slaves {
+		var up float64
+		if slave.miiStatus == "up" {
+			up = 1
+		}
+		ch <- c.slaveUp.mustNewConstMetric(up, master, slave.name)
+		ch <- c.slaveLinkFailures.mustNewConstMetric(float64(slave.linkFailures), master, slave.name)
+		ch <- c.slaveInfo.mustNewConstMetric(1.0, master, slave.name, slave.duplex)
+		if slave.speed != nil {
+			ch <- c.slaveSpeed.mustNewConstMetric(*slave.speed, master, slave.name)
+		}
+
+		if detail.aggregator == nil {
+			continue
+		}
+		ch <- c.slaveADInfo.mustNewConstMetric(1.0, master, slave.name, slave.aggregatorID, slave.partnerMAC)
+		var aggregated float64
+		if slave.aggregatorID == detail.aggregator.id {
+			aggregated = 1
+		}
+		ch <- c.slaveADAggregated.mustNewConstMetric(aggregated, master, slave.name)
+		if slave.actorPortState != nil {
+			ch <- c.slaveADActorState.mustNewConstMetric(float64(*slave.actorPortState), master, slave.name)
+		}
+		if slave.partnerPortState != nil {
+			ch <- c.slaveADPartner.mustNewConstMetric(float64(*slave.partnerPortState), master, slave.name)
+		}
+	}
+}
+
 func readBondingStats(root string) (status map[string][2]int, err error) {
 	status = map[string][2]int{}
 	masters, err := ioutil.ReadFile(filepath.Join(root, "bonding_masters"))
@@ -104,3 +255,129 @@ func readBondingStats(root string) (status map[string][2]int, err error) {
 	}
 	return status, err
 }
+
+// readBondingDetail parses the status of a bonding interface from
+// /proc/net/bonding/<master>. The file consists of "key: value" lines in a
+// section for the interface, optionally followed by the active aggregator
+// info, and a section for each slave.
+func readBondingDetail(path string) (*bondingDetail, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var (
+		detail  = &bondingDetail{}
+		slave   *bondingSlave
+		section string
+	)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		switch line {
+		case "Active Aggregator Info:":
+			section = "aggregator"
+			continue
+		case "details actor lacp pdu:":
+			section = "actor"
+			continue
+		case "details partner lacp pdu:":
+			section = "partner"
+			continue
+		}
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		key, value := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+
+		if key == "Slave Interface" {
+			slave = &bondingSlave{name: value}
+			detail.slaves = append(detail.slaves, slave)
+			section = "slave"
+			continue
+		}
+
+		switch section {
+		case "":
+			switch key {
+			case "Bonding Mode":
+				detail.mode = value
+				if mode, ok := bondingModes[value]; ok {
+					detail.mode = mode
+				}
+			case "Currently Active Slave":
+				if value != "None" {
+					detail.activeSlave = value
+				}
+			case "LACP rate":
+				if detail.aggregator == nil {
+					detail.aggregator = &bondingAggregator{}
+				}
+				detail.aggregator.lacpRate = value
+			}
+		case "aggregator":
+			if detail.aggregator == nil {
+				detail.aggregator = &bondingAggregator{}
+			}
+			switch key {
+			case "Aggregator ID":
+				detail.aggregator.id = value
+			case "Number of ports":
+				detail.aggregator.ports, err = strconv.ParseUint(value, 10, 64)
+			case "Partner Mac Address":
+				detail.aggregator.partnerMAC = value
+			}
+		case "slave":
+			switch key {
+			case "MII Status":
+				slave.miiStatus = value
+			case "Speed":
+				slave.speed, err = parseBondingSpeed(value)
+			case "Duplex":
+				slave.duplex = strings.ToLower(value)
+			case "Link Failure Count":
+				slave.linkFailures, err = strconv.ParseUint(value, 10, 64)
+			case "Aggregator ID":
+				slave.aggregatorID = value
+			}
+		case "actor":
+			if key == "port state" {
+				slave.actorPortState, err = parseBondingPortState(value)
+			}
+		case "partner":
+			switch key {
+			case "port state":
+				slave.partnerPortState, err = parseBondingPortState(value)
+			case "system mac address":
+				slave.partnerMAC = value
+			}
+		}
+		if err != nil {
+			return nil, fmt.Errorf("invalid %q in %s: %w", line, path, err)
+		}
+	}
+	return detail, scanner.Err()
+}
+
+// parseBondingSpeed parses a speed like "10000 Mbps" into bytes per second.
+func parseBondingSpeed(value string) (*float64, error) {
+	if value == "Unknown" {
+		return nil, nil
+	}
+	mbps, err := strconv.ParseFloat(strings.TrimSuffix(value, " Mbps"), 64)
+	if err != nil {
+		return nil, err
+	}
+	speed := mbps * 1000 * 1000 / 8
+	return &speed, nil
+}
+
+func parseBondingPortState(value string) (*uint64, error) {
+	state, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return nil, err
+	}
+	return &state, nil
+}
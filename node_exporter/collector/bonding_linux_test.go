@@ -34,3 +34,37 @@ func TestBonding(t *testing.T) {
 		t.Fatal("dmz in unexpected state")
 	}
 }
+
+func TestBondingDetail(t *testing.T) {
+	detail, err := readBondingDetail("fixtures/proc/net/bonding/int")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail.mode != "active-backup" || detail.activeSlave != "eth5" || detail.aggregator != nil {
+		t.Fatalf("int in unexpected state: %+v", detail)
+	}
+	if len(detail.slaves) != 2 {
+		t.Fatalf("want 2 slaves of int, got %d", len(detail.slaves))
+	}
+	if s := detail.slaves[1]; s.name != "eth1" || s.miiStatus != "down" || s.linkFailures != 3 || s.speed != nil {
+		t.Fatalf("eth1 in unexpected state: %+v", s)
+	}
+
+	detail, err = readBondingDetail("fixtures/proc/net/bonding/dmz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if detail.mode != "802.3ad" || detail.activeSlave != "" {
+		t.Fatalf("dmz in unexpected state: %+v", detail)
+	}
+	if agg := detail.aggregator; agg == nil || agg.id != "1" || agg.ports != 1 || agg.partnerMAC != "00:23:04:ee:be:64" || agg.lacpRate != "fast" {
+		t.Fatalf("dmz aggregator in unexpected state: %+v", agg)
+	}
+	s := detail.slaves[1]
+	if s.name != "eth4" || s.aggregatorID != "2" || s.partnerMAC != "00:00:00:00:00:00" {
+		t.Fatalf("eth4 in unexpected state: %+v", s)
+	}
+	if *s.speed != 125000000 || *s.actorPortState != 69 || *s.partnerPortState != 1 {
+		t.Fatalf("eth4 in unexpected state: speed %v, actor port state %v, partner port state %v", *s.speed, *s.actorPortState, *s.partnerPortState)
+	}
+}
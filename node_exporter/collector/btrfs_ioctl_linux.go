@@ -0,0 +1,269 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nobtrfs
+// +build !nobtrfs
+
+package collector
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"unsafe"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"golang.org/x/sys/unix"
+)
+
+// Requests of the btrfs ioctls used, see include/uapi/linux/btrfs.h.
+const (
+	btrfsIocScrubProgress   = 0xc400941d // _IOWR(0x94, 29, struct btrfs_ioctl_scrub_args)
+	btrfsIocDevInfo         = 0xd000941e // _IOWR(0x94, 30, struct btrfs_ioctl_dev_info_args)
+	btrfsIocFSInfo          = 0x8400941f // _IOR(0x94, 31, struct btrfs_ioctl_fs_info_args)
+	btrfsIocBalanceProgress = 0x84009422 // _IOR(0x94, 34, struct btrfs_ioctl_balance_args)
+	btrfsIocGetDevStats     = 0xc4089434 // _IOWR(0x94, 52, struct btrfs_ioctl_get_dev_stats)
+
+	btrfsBalanceStateRunning = 1 << 0
+)
+
+// btrfsDeviceErrorTypes are the names btrfs-progs uses for the per-device
+// error counters, in the order the kernel returns them.
+var btrfsDeviceErrorTypes = []string{
+	"write_io_errs",
+	"read_io_errs",
+	"flush_io_errs",
+	"corruption_errs",
+	"generation_errs",
+}
+
+// btrfsIoctlStats are the statistics of a mounted Btrfs filesystem which are
+// only available via ioctls on its mount point.
+type btrfsIoctlStats struct {
+	devices []btrfsIoctlDeviceStats
+	// balance is nil if the exporter isn't permitted to query it.
+	balance *btrfsBalanceStatus
+}
+
+type btrfsIoctlDeviceStats struct {
+	name      string
+	usedBytes uint64
+	// errors holds the counters in the order of btrfsDeviceErrorTypes.
+	errors []uint64
+	// scrub is nil if the exporter isn't permitted to query it.
+	scrub *btrfsScrubStatus
+}
+
+// btrfsScrubStatus is the progress of a scrub of a device. The kernel only
+// reports the progress of running scrubs.
+type btrfsScrubStatus struct {
+	running          bool
+	bytesScrubbed    uint64
+	readErrors       uint64
+	csumErrors       uint64
+	verifyErrors     uint64
+	superErrors      uint64
+	uncorrectable    uint64
+	correctedErrors  uint64
+	unverifiedErrors uint64
+}
+
+// btrfsBalanceStatus is the progress of a running or paused balance, in chunks.
+type btrfsBalanceStatus struct {
+	exists     bool
+	running    bool
+	expected   uint64
+	considered uint64
+	completed  uint64
+}
+
+type btrfsIoctlFSInfoArgs struct {
+	maxID      uint64
+	numDevices uint64
+	_          [1008]byte
+}
+
+type btrfsIoctlDevInfoArgs struct {
+	devID      uint64
+	uuid       [16]byte
+	bytesUsed  uint64
+	totalBytes uint64
+	_          [379]uint64
+	path       [1024]byte
+}
+
+type btrfsIoctlGetDevStatsArgs struct {
+	devID   uint64
+	nrItems uint64
+	flags   uint64
+	values  [5]uint64
+	_       [121]uint64
+}
+
+type btrfsIoctlScrubArgs struct {
+	devID    uint64
+	start    uint64
+	end      uint64
+	flags    uint64
+	progress struct {
+		dataExtentsScrubbed uint64
+		treeExtentsScrubbed uint64
+		dataBytesScrubbed   uint64
+		treeBytesScrubbed   uint64
+		readErrors          uint64
+		csumErrors          uint64
+		verifyErrors        uint64
+		noCsum              uint64
+		csumDiscards        uint64
+		superErrors         uint64
+		mallocErrors        uint64
+		uncorrectableErrors uint64
+		correctedErrors     uint64
+		lastPhysical        uint64
+		unverifiedErrors    uint64
+	}
+	_ [109]uint64
+}
+
+type btrfsIoctlBalanceArgs struct {
+	flags uint64
+	state uint64
+	data  [136]byte
+	meta  [136]byte
+	sys   [136]byte
+	stat  struct {
+		expected   uint64
+		considered uint64
+		completed  uint64
+	}
+	_ [72]uint64
+}
+
+func btrfsIoctl(fd uintptr, req uintptr, arg unsafe.Pointer) error {
+	if _, _, errno := unix.Syscall(unix.SYS_IOCTL, fd, req, uintptr(arg)); errno != 0 {
+		return errno
+	}
+	return nil
+}
+
+// readBtrfsIoctlStats queries the device error counters and the progress of
+// scrubs and balances of the Btrfs filesystem mounted at mountPoint. Only
+// the scrub and balance progress need CAP_SYS_ADMIN. Devices which can't be
+// queried are left out.
+func readBtrfsIoctlStats(mountPoint string, logger log.Logger) (*btrfsIoctlStats, error) {
+	f, err := os.Open(mountPoint)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	fd := f.Fd()
+
+	var fsInfo btrfsIoctlFSInfoArgs
+	if err := btrfsIoctl(fd, btrfsIocFSInfo, unsafe.Pointer(&fsInfo)); err != nil {
+		return nil, fmt.Errorf("BTRFS_IOC_FS_INFO failed: %w", err)
+	}
+
+	stats := &btrfsIoctlStats{}
+	// Device IDs are allocated sequentially, but removed devices leave gaps.
+	for id := uint64(1); id <= fsInfo.maxID; id++ {
+		dev, err := readBtrfsIoctlDeviceStats(fd, id)
+		if err != nil {
+			level.Debug(logger).Log("msg", "Failed to query Btrfs device", "mountpoint", mountPoint, "devid", id, "err", err)
+			continue
+		}
+		if dev != nil {
+			stats.devices = append(stats.devices, *dev)
+		}
+	}
+
+	var balance btrfsIoctlBalanceArgs
+	switch err := btrfsIoctl(fd, btrfsIocBalanceProgress, unsafe.Pointer(&balance)); {
+	case err == nil:
+		stats.balance = &btrfsBalanceStatus{
+			exists:     true,
+			running:    balance.state&btrfsBalanceStateRunning != 0,
+			expected:   balance.stat.expected,
+			considered: balance.stat.considered,
+			completed:  balance.stat.completed,
+		}
+	case errors.Is(err, unix.ENOTCONN):
+		stats.balance = &btrfsBalanceStatus{}
+	case errors.Is(err, unix.EPERM):
+	default:
+		return nil, fmt.Errorf("BTRFS_IOC_BALANCE_PROGRESS failed: %w", err)
+	}
+
+	return stats, nil
+}
+
+// readBtrfsIoctlDeviceStats queries the error counters and the scrub progress
+// of the device with the given ID, returning nil if there is no such device.
+func readBtrfsIoctlDeviceStats(fd uintptr, id uint64) (*btrfsIoctlDeviceStats, error) {
+	devInfo := btrfsIoctlDevInfoArgs{devID: id}
+	if err := btrfsIoctl(fd, btrfsIocDevInfo, unsafe.Pointer(&devInfo)); err != nil {
+		if errors.Is(err, unix.ENODEV) {
+			return nil, nil
+		}
+		return nil, fmt.Errorf("BTRFS_IOC_DEV_INFO failed: %w", err)
+	}
+
+	devStats := btrfsIoctlGetDevStatsArgs{devID: id, nrItems: uint64(len(btrfsDeviceErrorTypes))}
+	if err := btrfsIoctl(fd, btrfsIocGetDevStats, unsafe.Pointer(&devStats)); err != nil {
+		return nil, fmt.Errorf("BTRFS_IOC_GET_DEV_STATS failed: %w", err)
+	}
+
+	dev := &btrfsIoctlDeviceStats{
+		name:      btrfsDeviceName(devInfo.path[:]),
+		usedBytes: devInfo.bytesUsed,
+		errors:    devStats.values[:devStats.nrItems],
+	}
+
+	scrub := btrfsIoctlScrubArgs{devID: id}
+	switch err := btrfsIoctl(fd, btrfsIocScrubProgress, unsafe.Pointer(&scrub)); {
+	case err == nil:
+		p := scrub.progress
+		dev.scrub = &btrfsScrubStatus{
+			running:          true,
+			bytesScrubbed:    p.dataBytesScrubbed + p.treeBytesScrubbed,
+			readErrors:       p.readErrors,
+			csumErrors:       p.csumErrors,
+			verifyErrors:     p.verifyErrors,
+			superErrors:      p.superErrors,
+			uncorrectable:    p.uncorrectableErrors,
+			correctedErrors:  p.correctedErrors,
+			unverifiedErrors: p.unverifiedErrors,
+		}
+	case errors.Is(err, unix.ENOTCONN):
+		dev.scrub = &btrfsScrubStatus{}
+	case errors.Is(err, unix.EPERM):
+	default:
+		return nil, fmt.Errorf("BTRFS_IOC_SCRUB_PROGRESS failed: %w", err)
+	}
+	return dev, nil
+}
+
+// btrfsDeviceName turns the device path reported by the kernel into the
+// kernel name of the device, e.g. /dev/mapper/vg0-data into dm-0.
+func btrfsDeviceName(path []byte) string {
+	if i := bytes.IndexByte(path, 0); i >= 0 {
+		path = path[:i]
+	}
+	p := string(path)
+	if resolved, err := filepath.EvalSymlinks(rootfsFilePath(p)); err == nil {
+		p = resolved
+	}
+	return filepath.Base(p)
+}
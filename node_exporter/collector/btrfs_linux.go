@@ -17,17 +17,23 @@
 package collector
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 
 	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/procfs/btrfs"
 )
 
 // A btrfsCollector is a Collector which gathers metrics from Btrfs filesystems.
 type btrfsCollector struct {
-	fs     btrfs.FS
-	logger log.Logger
+	fs         btrfs.FS
+	ioctlStats func(mountPoint string, logger log.Logger) (*btrfsIoctlStats, error)
+	logger     log.Logger
 }
 
 func init() {
@@ -42,8 +48,9 @@ func NewBtrfsCollector(logger log.Logger) (Collector, error) {
 	}
 
 	return &btrfsCollector{
-		fs:     fs,
-		logger: logger,
+		fs:         fs,
+		ioctlStats: readBtrfsIoctlStats,
+		logger:     logger,
 	}, nil
 }
 
@@ -55,31 +62,90 @@ func (c *btrfsCollector) Update(ch chan<- prometheus.Metric) error {
 		return fmt.Errorf("failed to retrieve Btrfs stats: %w", err)
 	}
 
+	mounts, err := btrfsMounts()
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "Failed to read mount points of Btrfs filesystems", "err", err)
+	}
+
 	for _, s := range stats {
-		c.updateBtrfsStats(ch, s)
+		var ioctlStats *btrfsIoctlStats
+		if mountPoint, ok := btrfsMountPoint(mounts, s); ok {
+			ioctlStats, err = c.ioctlStats(rootfsFilePath(mountPoint), c.logger)
+			if err != nil {
+				level.Debug(c.logger).Log("msg", "Failed to query Btrfs filesystem", "uuid", s.UUID, "mountpoint", mountPoint, "err", err)
+			}
+		}
+		c.updateBtrfsStats(ch, s, ioctlStats)
 	}
 
 	return nil
 }
 
+// btrfsMount is a mounted Btrfs filesystem.
+type btrfsMount struct {
+	device     string
+	mountPoint string
+}
+
+// btrfsMounts returns the mounted Btrfs filesystems, the device being the
+// kernel name of the device given to mount.
+func btrfsMounts() ([]btrfsMount, error) {
+	file, err := os.Open(procFilePath("1/mounts"))
+	if errors.Is(err, os.ErrNotExist) {
+		file, err = os.Open(procFilePath("mounts"))
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var mounts []btrfsMount
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		parts := strings.Fields(scanner.Text())
+		if len(parts) < 3 || parts[2] != "btrfs" {
+			continue
+		}
+		mountPoint := strings.Replace(parts[1], "\\040", " ", -1)
+		mountPoint = strings.Replace(mountPoint, "\\011", "\t", -1)
+		mounts = append(mounts, btrfsMount{
+			device:     btrfsDeviceName([]byte(parts[0])),
+			mountPoint: rootfsStripPrefix(mountPoint),
+		})
+	}
+	return mounts, scanner.Err()
+}
+
+// btrfsMountPoint returns a mount point of the filesystem, which can be
+// mounted several times and from any of its devices.
+func btrfsMountPoint(mounts []btrfsMount, s *btrfs.Stats) (string, bool) {
+	for _, m := range mounts {
+		if _, ok := s.Devices[m.device]; ok {
+			return m.mountPoint, true
+		}
+	}
+	return "", false
+}
+
 // btrfsMetric represents a single Btrfs metric that is converted into a Prometheus Metric.
 type btrfsMetric struct {
 	name            string
 	desc            string
 	value           float64
+	valueType       prometheus.ValueType
 	extraLabel      []string
 	extraLabelValue []string
 }
 
 // updateBtrfsStats collects statistics for one bcache ID.
-func (c *btrfsCollector) updateBtrfsStats(ch chan<- prometheus.Metric, s *btrfs.Stats) {
+func (c *btrfsCollector) updateBtrfsStats(ch chan<- prometheus.Metric, s *btrfs.Stats, ioctlStats *btrfsIoctlStats) {
 	const subsystem = "btrfs"
 
 	// Basic information about the filesystem.
 	devLabels := []string{"uuid"}
 
 	// Retrieve the metrics.
-	metrics := c.getMetrics(s)
+	metrics := c.getMetrics(s, ioctlStats)
 
 	// Convert all gathered metrics to Prometheus Metrics and add to channel.
 	for _, m := range metrics {
@@ -97,17 +163,23 @@ func (c *btrfsCollector) updateBtrfsStats(ch chan<- prometheus.Metric, s *btrfs.
 			labelValues = append(labelValues, m.extraLabelValue...)
 		}
 
+		valueType := m.valueType
+		if valueType == 0 {
+			valueType = prometheus.GaugeValue
+		}
+
 		ch <- prometheus.MustNewConstMetric(
 			desc,
-			prometheus.GaugeValue,
+			valueType,
 			m.value,
 			labelValues...,
 		)
 	}
 }
 
-// getMetrics returns metrics for the given Btrfs statistics.
-func (c *btrfsCollector) getMetrics(s *btrfs.Stats) []btrfsMetric {
+// getMetrics returns metrics for the given Btrfs statistics. ioctlStats is nil
+// if the filesystem couldn't be queried via its mount point.
+func (c *btrfsCollector) getMetrics(s *btrfs.Stats, ioctlStats *btrfsIoctlStats) []btrfsMetric {
 	metrics := []btrfsMetric{
 		{
 			name:            "info",
@@ -139,6 +211,115 @@ func (c *btrfsCollector) getMetrics(s *btrfs.Stats) []btrfsMetric {
 	metrics = append(metrics, c.getAllocationStats("metadata", s.Allocation.Metadata)...)
 	metrics = append(metrics, c.getAllocationStats("system", s.Allocation.System)...)
 
+	if ioctlStats != nil {
+		metrics = append(metrics, c.getIoctlStats(ioctlStats)...)
+	}
+
+	return metrics
+}
+
+// getIoctlStats returns the device error, scrub and balance metrics.
+func (c *btrfsCollector) getIoctlStats(s *btrfsIoctlStats) []btrfsMetric {
+	var metrics []btrfsMetric
+
+	for _, dev := range s.devices {
+		metrics = append(metrics, btrfsMetric{
+			name:            "device_used_bytes",
+			desc:            "Amount of space of a device allocated to the filesystem.",
+			value:           float64(dev.usedBytes),
+			extraLabel:      []string{"device"},
+			extraLabelValue: []string{dev.name},
+		})
+		for i, v := range dev.errors {
+			metrics = append(metrics, btrfsMetric{
+				name:            "device_errors_total",
+				desc:            "Errors reported for a device of the filesystem.",
+				value:           float64(v),
+				valueType:       prometheus.CounterValue,
+				extraLabel:      []string{"device", "type"},
+				extraLabelValue: []string{dev.name, btrfsDeviceErrorTypes[i]},
+			})
+		}
+		if dev.scrub != nil {
+			metrics = append(metrics, c.getScrubStats(dev.name, dev.scrub)...)
+		}
+	}
+
+	if b := s.balance; b != nil {
+		running := 0.0
+		if b.running {
+			running = 1
+		}
+		metrics = append(metrics, btrfsMetric{
+			name:  "balance_running",
+			desc:  "Whether a balance of the filesystem is running.",
+			value: running,
+		})
+		// A paused balance keeps its progress and can be resumed.
+		if b.exists {
+			for _, m := range []struct {
+				name, desc string
+				value      uint64
+			}{
+				{"balance_expected_chunks", "Number of chunks the running or paused balance is expected to relocate.", b.expected},
+				{"balance_considered_chunks", "Number of chunks considered by the running or paused balance.", b.considered},
+				{"balance_completed_chunks", "Number of chunks relocated by the running or paused balance.", b.completed},
+			} {
+				metrics = append(metrics, btrfsMetric{name: m.name, desc: m.desc, value: float64(m.value)})
+			}
+		}
+	}
+
+	return metrics
+}
+
+// getScrubStats returns metrics for the scrub of a device. The kernel only
+// knows the progress of running scrubs.
+func (c *btrfsCollector) getScrubStats(device string, s *btrfsScrubStatus) []btrfsMetric {
+	running := 0.0
+	if s.running {
+		running = 1
+	}
+	metrics := []btrfsMetric{
+		{
+			name:            "scrub_running",
+			desc:            "Whether a scrub of a device of the filesystem is running.",
+			value:           running,
+			extraLabel:      []string{"device"},
+			extraLabelValue: []string{device},
+		},
+	}
+	if !s.running {
+		return metrics
+	}
+
+	metrics = append(metrics, btrfsMetric{
+		name:            "scrub_scrubbed_bytes",
+		desc:            "Amount of data and metadata verified by the running scrub of a device.",
+		value:           float64(s.bytesScrubbed),
+		extraLabel:      []string{"device"},
+		extraLabelValue: []string{device},
+	})
+	for _, e := range []struct {
+		typ   string
+		value uint64
+	}{
+		{"read", s.readErrors},
+		{"csum", s.csumErrors},
+		{"verify", s.verifyErrors},
+		{"super", s.superErrors},
+		{"uncorrectable", s.uncorrectable},
+		{"corrected", s.correctedErrors},
+		{"unverified", s.unverifiedErrors},
+	} {
+		metrics = append(metrics, btrfsMetric{
+			name:            "scrub_errors",
+			desc:            "Errors found by the running scrub of a device.",
+			value:           float64(e.value),
+			extraLabel:      []string{"device", "type"},
+			extraLabelValue: []string{device, e.typ},
+		})
+	}
 	return metrics
 }
 
@@ -17,9 +17,14 @@
 package collector
 
 import (
+	"fmt"
 	"strings"
 	"testing"
+	"unsafe"
 
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/prometheus/procfs/btrfs"
 )
 
@@ -104,7 +109,7 @@ func TestBtrfs(t *testing.T) {
 	}
 
 	for i, s := range stats {
-		metrics := collector.getMetrics(s)
+		metrics := collector.getMetrics(s, nil)
 		if len(metrics) != len(expectedBtrfsMetrics[i]) {
 			t.Fatalf("Unexpected number of Btrfs metrics: expected %v, got %v", len(expectedBtrfsMetrics[i]), len(metrics))
 		}
@@ -117,3 +122,117 @@ func TestBtrfs(t *testing.T) {
 		}
 	}
 }
+
+func TestBtrfsIoctlStats(t *testing.T) {
+	defer func(sys, proc string) {
+		*sysPath = sys
+		*procPath = proc
+	}(*sysPath, *procPath)
+	*sysPath = "fixtures/sys"
+	*procPath = "fixtures/btrfs/proc"
+
+	c, err := NewBtrfsCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.(*btrfsCollector).ioctlStats = func(mountPoint string, _ log.Logger) (*btrfsIoctlStats, error) {
+		if mountPoint != "/srv/fixture" {
+			return nil, fmt.Errorf("unexpected mount point %s", mountPoint)
+		}
+		return &btrfsIoctlStats{
+			devices: []btrfsIoctlDeviceStats{
+				{
+					name:      "loop25",
+					usedBytes: 1207959552,
+					errors:    []uint64{0, 0, 0, 0, 0},
+					scrub:     &btrfsScrubStatus{},
+				},
+				{
+					name:      "loop26",
+					usedBytes: 1207959552,
+					errors:    []uint64{3, 1, 0, 12, 0},
+					scrub: &btrfsScrubStatus{
+						running:         true,
+						bytesScrubbed:   536870912,
+						csumErrors:      2,
+						correctedErrors: 2,
+					},
+				},
+			},
+			balance: &btrfsBalanceStatus{exists: true, expected: 10, considered: 4, completed: 3},
+		}, nil
+	}
+
+	want := `# HELP node_btrfs_balance_completed_chunks Number of chunks relocated by the running or paused balance.
+# TYPE node_btrfs_balance_completed_chunks gauge
+node_btrfs_balance_completed_chunks{uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 3
+# HELP node_btrfs_balance_running Whether a balance of the filesystem is running.
+# TYPE node_btrfs_balance_running gauge
+node_btrfs_balance_running{uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+# HELP node_btrfs_device_errors_total Errors reported for a device of the filesystem.
+# TYPE node_btrfs_device_errors_total counter
+node_btrfs_device_errors_total{device="loop25",type="corruption_errs",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+node_btrfs_device_errors_total{device="loop25",type="flush_io_errs",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+node_btrfs_device_errors_total{device="loop25",type="generation_errs",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+node_btrfs_device_errors_total{device="loop25",type="read_io_errs",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+node_btrfs_device_errors_total{device="loop25",type="write_io_errs",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+node_btrfs_device_errors_total{device="loop26",type="corruption_errs",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 12
+node_btrfs_device_errors_total{device="loop26",type="flush_io_errs",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+node_btrfs_device_errors_total{device="loop26",type="generation_errs",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+node_btrfs_device_errors_total{device="loop26",type="read_io_errs",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 1
+node_btrfs_device_errors_total{device="loop26",type="write_io_errs",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 3
+# HELP node_btrfs_scrub_errors Errors found by the running scrub of a device.
+# TYPE node_btrfs_scrub_errors gauge
+node_btrfs_scrub_errors{device="loop26",type="corrected",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 2
+node_btrfs_scrub_errors{device="loop26",type="csum",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 2
+node_btrfs_scrub_errors{device="loop26",type="read",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+node_btrfs_scrub_errors{device="loop26",type="super",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+node_btrfs_scrub_errors{device="loop26",type="uncorrectable",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+node_btrfs_scrub_errors{device="loop26",type="unverified",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+node_btrfs_scrub_errors{device="loop26",type="verify",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+# HELP node_btrfs_scrub_running Whether a scrub of a device of the filesystem is running.
+# TYPE node_btrfs_scrub_running gauge
+node_btrfs_scrub_running{device="loop25",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 0
+node_btrfs_scrub_running{device="loop26",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 1
+# HELP node_btrfs_scrub_scrubbed_bytes Amount of data and metadata verified by the running scrub of a device.
+# TYPE node_btrfs_scrub_scrubbed_bytes gauge
+node_btrfs_scrub_scrubbed_bytes{device="loop26",uuid="0abb23a9-579b-43e6-ad30-227ef47fcb9d"} 5.36870912e+08
+`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+	err = testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"node_btrfs_balance_completed_chunks",
+		"node_btrfs_balance_running",
+		"node_btrfs_device_errors_total",
+		"node_btrfs_scrub_errors",
+		"node_btrfs_scrub_running",
+		"node_btrfs_scrub_scrubbed_bytes",
+	)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestBtrfsIoctlArgsSize(t *testing.T) {
+	// The kernel rejects requests whose encoded size doesn't match the size
+	// of the argument struct in include/uapi/linux/btrfs.h.
+	for _, tc := range []struct {
+		name string
+		req  uintptr
+		size uintptr
+		want uintptr
+	}{
+		{"BTRFS_IOC_SCRUB_PROGRESS", btrfsIocScrubProgress, unsafe.Sizeof(btrfsIoctlScrubArgs{}), 1024},
+		{"BTRFS_IOC_DEV_INFO", btrfsIocDevInfo, unsafe.Sizeof(btrfsIoctlDevInfoArgs{}), 4096},
+		{"BTRFS_IOC_FS_INFO", btrfsIocFSInfo, unsafe.Sizeof(btrfsIoctlFSInfoArgs{}), 1024},
+		{"BTRFS_IOC_BALANCE_PROGRESS", btrfsIocBalanceProgress, unsafe.Sizeof(btrfsIoctlBalanceArgs{}), 1024},
+		{"BTRFS_IOC_GET_DEV_STATS", btrfsIocGetDevStats, unsafe.Sizeof(btrfsIoctlGetDevStatsArgs{}), 1032},
+	} {
+		if tc.size != tc.want {
+			t.Errorf("%s: want argument size %d, got %d", tc.name, tc.want, tc.size)
+		}
+		if encoded := tc.req >> 16 & 0x3fff; encoded != tc.size {
+			t.Errorf("%s: request encodes size %d, argument size is %d", tc.name, encoded, tc.size)
+		}
+	}
+}
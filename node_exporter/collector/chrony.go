@@ -0,0 +1,467 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nochrony
+// +build !nochrony
+
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/rand"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const chronySubsystem = "chrony"
+
+var (
+	chronyAddress = kingpin.Flag("collector.chrony.address", "Address of the chronyd command socket, either host:port for UDP or unix:///path/to/chronyd.sock.").Default("127.0.0.1:323").String()
+	chronyTimeout = kingpin.Flag("collector.chrony.timeout", "Timeout for each request to chronyd.").Default("1s").Duration()
+)
+
+// chronyd command protocol, see candm.h in the chrony sources.
+const (
+	chronyProtocolVersion = 6
+	chronyPktTypeRequest  = 1
+	chronyPktTypeReply    = 2
+
+	chronyReqNSources    = 14
+	chronyReqSourceData  = 15
+	chronyReqTracking    = 33
+	chronyReqSourceStats = 34
+
+	chronyRpyNSources    = 2
+	chronyRpySourceData  = 3
+	chronyRpyTracking    = 5
+	chronyRpySourceStats = 6
+
+	chronySttSuccess = 0
+
+	chronyAddrInet4 = 1
+	chronyAddrInet6 = 2
+
+	chronyModeRefclock  = 2
+	chronyStateSelected = 0
+
+	// chronyNoHighSec marks the high 32 bits of a timestamp as unused.
+	chronyNoHighSec = 0x7fffffff
+)
+
+var (
+	chronyLeapStatus   = []string{"normal", "insert_second", "delete_second", "unsynchronised"}
+	chronySourceModes  = []string{"client", "peer", "refclock"}
+	chronySourceStates = []string{"selected", "nonselectable", "falseticker", "jittery", "unselected", "selectable"}
+)
+
+type chronyRequestHeader struct {
+	Version  uint8
+	PktType  uint8
+	Res1     uint8
+	Res2     uint8
+	Command  uint16
+	Attempt  uint16
+	Sequence uint32
+	Pad1     uint32
+	Pad2     uint32
+}
+
+type chronyReplyHeader struct {
+	Version  uint8
+	PktType  uint8
+	Res1     uint8
+	Res2     uint8
+	Command  uint16
+	Reply    uint16
+	Status   uint16
+	Pad1     uint16
+	Pad2     uint16
+	Pad3     uint16
+	Sequence uint32
+	Pad4     uint32
+	Pad5     uint32
+}
+
+// chronyFloat is the 32-bit floating point format of the protocol, with a
+// 7-bit exponent and a 25-bit coefficient.
+type chronyFloat uint32
+
+func (f chronyFloat) value() float64 {
+	exp := int32(f >> 25)
+	if exp >= 1<<6 {
+		exp -= 1 << 7
+	}
+	exp -= 25
+	coef := int32(f % (1 << 25))
+	if coef >= 1<<24 {
+		coef -= 1 << 25
+	}
+	return float64(coef) * math.Pow(2, float64(exp))
+}
+
+type chronyTimespec struct {
+	SecHigh uint32
+	SecLow  uint32
+	Nsec    uint32
+}
+
+func (t chronyTimespec) seconds() float64 {
+	sec := uint64(t.SecLow)
+	if t.SecHigh != chronyNoHighSec {
+		sec |= uint64(t.SecHigh) << 32
+	}
+	return float64(sec) + float64(t.Nsec)/1e9
+}
+
+type chronyIPAddr struct {
+	Addr   [16]byte
+	Family uint16
+	Pad    uint16
+}
+
+func (a chronyIPAddr) String() string {
+	switch a.Family {
+	case chronyAddrInet4:
+		return net.IP(a.Addr[:4]).String()
+	case chronyAddrInet6:
+		return net.IP(a.Addr[:]).String()
+	}
+	return ""
+}
+
+type chronyIndexRequest struct {
+	Index int32
+	EOR   int32
+}
+
+type chronyNSources struct {
+	NSources uint32
+	EOR      int32
+}
+
+type chronyTracking struct {
+	RefID              uint32
+	IPAddr             chronyIPAddr
+	Stratum            uint16
+	LeapStatus         uint16
+	RefTime            chronyTimespec
+	CurrentCorrection  chronyFloat
+	LastOffset         chronyFloat
+	RMSOffset          chronyFloat
+	FreqPPM            chronyFloat
+	ResidFreqPPM       chronyFloat
+	SkewPPM            chronyFloat
+	RootDelay          chronyFloat
+	RootDispersion     chronyFloat
+	LastUpdateInterval chronyFloat
+	EOR                int32
+}
+
+type chronySourceData struct {
+	IPAddr         chronyIPAddr
+	Poll           int16
+	Stratum        uint16
+	State          uint16
+	Mode           uint16
+	Flags          uint16
+	Reachability   uint16
+	SinceSample    uint32
+	OrigLatestMeas chronyFloat
+	LatestMeas     chronyFloat
+	LatestMeasErr  chronyFloat
+	EOR            int32
+}
+
+type chronySourceStats struct {
+	RefID        uint32
+	IPAddr       chronyIPAddr
+	NSamples     uint32
+	NRuns        uint32
+	SpanSeconds  uint32
+	SD           chronyFloat
+	ResidFreqPPM chronyFloat
+	SkewPPM      chronyFloat
+	EstOffset    chronyFloat
+	EstOffsetErr chronyFloat
+	EOR          int32
+}
+
+// chronyRefID formats a reference ID like chronyc does, as the address of the
+// source or, for reference clocks, as up to four ASCII characters.
+func chronyRefID(id uint32) string {
+	b := make([]byte, 4)
+	binary.BigEndian.PutUint32(b, id)
+	return strings.TrimRight(string(bytes.Map(func(r rune) rune {
+		if r < 0x20 || r > 0x7e {
+			return -1
+		}
+		return r
+	}, b)), " ")
+}
+
+// chronyClient sends commands to chronyd.
+type chronyClient struct {
+	conn     net.Conn
+	sequence uint32
+	timeout  time.Duration
+	local    string // path of the client socket for unix sockets
+}
+
+// dialChrony connects to the chronyd command socket. Unix sockets are
+// datagram sockets, so the client binds to a socket next to the server socket
+// like chronyc does, which chronyd must be able to write to.
+func dialChrony(address string, timeout time.Duration) (*chronyClient, error) {
+	c := &chronyClient{sequence: rand.Uint32(), timeout: timeout}
+	if !strings.HasPrefix(address, "unix://") {
+		conn, err := net.DialTimeout("udp", address, timeout)
+		if err != nil {
+			return nil, err
+		}
+		c.conn = conn
+		return c, nil
+	}
+
+	path := strings.TrimPrefix(address, "unix://")
+	// The random sequence number keeps concurrent scrapes apart.
+	c.local = filepath.Join(filepath.Dir(path), fmt.Sprintf("node_exporter.%d.%08x.sock", os.Getpid(), c.sequence))
+	os.Remove(c.local)
+	conn, err := net.DialUnix("unixgram", &net.UnixAddr{Name: c.local, Net: "unixgram"}, &net.UnixAddr{Name: path, Net: "unixgram"})
+	if err != nil {
+		return nil, err
+	}
+	c.conn = conn
+	if err := os.Chmod(c.local, 0666); err != nil {
+		c.Close()
+		return nil, err
+	}
+	return c, nil
+}
+
+func (c *chronyClient) Close() error {
+	err := c.conn.Close()
+	if c.local != "" {
+		os.Remove(c.local)
+	}
+	return err
+}
+
+// query sends a command and decodes the reply into reply. Requests are padded
+// to the length of the reply, as chronyd drops shorter requests to prevent
+// amplification attacks.
+func (c *chronyClient) query(command, replyCode uint16, request, reply interface{}) error {
+	c.sequence++
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, chronyRequestHeader{
+		Version:  chronyProtocolVersion,
+		PktType:  chronyPktTypeRequest,
+		Command:  command,
+		Sequence: c.sequence,
+	})
+	if request != nil {
+		binary.Write(&buf, binary.BigEndian, request)
+	}
+	if n := binary.Size(chronyReplyHeader{}) + binary.Size(reply); buf.Len() < n {
+		buf.Write(make([]byte, n-buf.Len()))
+	}
+
+	if err := c.conn.SetDeadline(time.Now().Add(c.timeout)); err != nil {
+		return err
+	}
+	if _, err := c.conn.Write(buf.Bytes()); err != nil {
+		return err
+	}
+
+	resp := make([]byte, 1024)
+	for {
+		n, err := c.conn.Read(resp)
+		if err != nil {
+			return err
+		}
+		r := bytes.NewReader(resp[:n])
+		var header chronyReplyHeader
+		if err := binary.Read(r, binary.BigEndian, &header); err != nil {
+			return fmt.Errorf("invalid reply: %w", err)
+		}
+		if header.PktType != chronyPktTypeReply || header.Sequence != c.sequence {
+			// A late reply to an earlier request, skip it.
+			continue
+		}
+		if header.Version != chronyProtocolVersion {
+			return fmt.Errorf("unsupported protocol version %d", header.Version)
+		}
+		if header.Status != chronySttSuccess {
+			return fmt.Errorf("command %d failed with status %d", command, header.Status)
+		}
+		if header.Command != command || header.Reply != replyCode {
+			return fmt.Errorf("unexpected reply %d to command %d", header.Reply, header.Command)
+		}
+		if err := binary.Read(r, binary.BigEndian, reply); err != nil {
+			return fmt.Errorf("invalid reply to command %d: %w", command, err)
+		}
+		return nil
+	}
+}
+
+type chronyCollector struct {
+	trackingInfo, stratum, leapStatus, referenceTime, systemTimeOffset typedDesc
+	lastOffset, rmsOffset, frequency, residualFrequency, skew          typedDesc
+	rootDelay, rootDispersion, updateInterval                          typedDesc
+	sourceInfo, sourceSelected, sourceStratum, sourcePoll              typedDesc
+	sourceReachability, sourceLastSampleAge                            typedDesc
+	sourceLastSampleOffset, sourceLastSampleError                      typedDesc
+	sourceSamples, sourceSpan, sourceStdDev                            typedDesc
+	sourceResidualFrequency, sourceSkew                                typedDesc
+	sourceEstimatedOffset, sourceEstimatedOffsetError                  typedDesc
+	logger                                                             log.Logger
+}
+
+func init() {
+	registerCollector("chrony", defaultDisabled, NewChronyCollector)
+}
+
+// NewChronyCollector returns a new Collector exposing the synchronisation
+// state of chronyd, as shown by chronyc tracking, sources and sourcestats.
+func NewChronyCollector(logger log.Logger) (Collector, error) {
+	sourceLabels := []string{"source"}
+	desc := func(name, help string, labels []string, valueType prometheus.ValueType) typedDesc {
+		return typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, chronySubsystem, name),
+			help, labels, nil,
+		), valueType}
+	}
+	return &chronyCollector{
+		trackingInfo:      desc("tracking_info", "A metric with a constant '1' value labeled by the reference ID and address of the source chronyd is synchronised to.", []string{"reference_id", "address"}, prometheus.GaugeValue),
+		stratum:           desc("tracking_stratum", "Stratum of the local clock.", nil, prometheus.GaugeValue),
+		leapStatus:        desc("tracking_leap_status", "Leap status of the local clock, 1 for the current status.", []string{"status"}, prometheus.GaugeValue),
+		referenceTime:     desc("tracking_reference_timestamp_seconds", "Time of the last measurement of the reference source, UNIX timestamp.", nil, prometheus.GaugeValue),
+		systemTimeOffset:  desc("tracking_system_time_offset_seconds", "Offset of the system clock chronyd is currently correcting.", nil, prometheus.GaugeValue),
+		lastOffset:        desc("tracking_last_offset_seconds", "Offset of the system clock at the last clock update.", nil, prometheus.GaugeValue),
+		rmsOffset:         desc("tracking_rms_offset_seconds", "Long-term average of the offset of the system clock.", nil, prometheus.GaugeValue),
+		frequency:         desc("tracking_frequency_ppm", "Frequency error of the system clock in parts per million.", nil, prometheus.GaugeValue),
+		residualFrequency: desc("tracking_residual_frequency_ppm", "Residual frequency of the reference source in parts per million.", nil, prometheus.GaugeValue),
+		skew:              desc("tracking_skew_ppm", "Estimated error bound of the frequency in parts per million.", nil, prometheus.GaugeValue),
+		rootDelay:         desc("tracking_root_delay_seconds", "Total network path delay to the stratum 1 source.", nil, prometheus.GaugeValue),
+		rootDispersion:    desc("tracking_root_dispersion_seconds", "Total dispersion accumulated up to the stratum 1 source.", nil, prometheus.GaugeValue),
+		updateInterval:    desc("tracking_update_interval_seconds", "Interval between the last two clock updates.", nil, prometheus.GaugeValue),
+
+		sourceInfo:             desc("source_info", "A metric with a constant '1' value labeled by the mode and selection state of a source.", []string{"source", "mode", "state"}, prometheus.GaugeValue),
+		sourceSelected:         desc("source_selected", "Whether the source is the one chronyd is synchronised to.", sourceLabels, prometheus.GaugeValue),
+		sourceStratum:          desc("source_stratum", "Stratum of the source.", sourceLabels, prometheus.GaugeValue),
+		sourcePoll:             desc("source_poll_interval_seconds", "Interval at which the source is polled.", sourceLabels, prometheus.GaugeValue),
+		sourceReachability:     desc("source_reachability", "Reachability register of the source, a bitmask of the last 8 polls.", sourceLabels, prometheus.GaugeValue),
+		sourceLastSampleAge:    desc("source_last_sample_age_seconds", "Time since the last sample was received from the source.", sourceLabels, prometheus.GaugeValue),
+		sourceLastSampleOffset: desc("source_last_sample_offset_seconds", "Offset of the local clock to the source at the last sample.", sourceLabels, prometheus.GaugeValue),
+		sourceLastSampleError:  desc("source_last_sample_error_seconds", "Error bound of the last sample of the source.", sourceLabels, prometheus.GaugeValue),
+
+		sourceSamples:              desc("sourcestats_samples", "Number of samples retained for the source.", sourceLabels, prometheus.GaugeValue),
+		sourceSpan:                 desc("sourcestats_span_seconds", "Interval between the oldest and newest sample of the source.", sourceLabels, prometheus.GaugeValue),
+		sourceStdDev:               desc("sourcestats_standard_deviation_seconds", "Estimated sample standard deviation of the source.", sourceLabels, prometheus.GaugeValue),
+		sourceResidualFrequency:    desc("sourcestats_residual_frequency_ppm", "Residual frequency of the source in parts per million.", sourceLabels, prometheus.GaugeValue),
+		sourceSkew:                 desc("sourcestats_skew_ppm", "Estimated error bound of the frequency of the source in parts per million.", sourceLabels, prometheus.GaugeValue),
+		sourceEstimatedOffset:      desc("sourcestats_offset_seconds", "Estimated offset of the source.", sourceLabels, prometheus.GaugeValue),
+		sourceEstimatedOffsetError: desc("sourcestats_offset_error_seconds", "Estimated error bound of the offset of the source.", sourceLabels, prometheus.GaugeValue),
+		logger:                     logger,
+	}, nil
+}
+
+func (c *chronyCollector) Update(ch chan<- prometheus.Metric) error {
+	client, err := dialChrony(*chronyAddress, *chronyTimeout)
+	if err != nil {
+		return fmt.Errorf("couldn't connect to chronyd: %w", err)
+	}
+	defer client.Close()
+
+	var tracking chronyTracking
+	if err := client.query(chronyReqTracking, chronyRpyTracking, nil, &tracking); err != nil {
+		return fmt.Errorf("couldn't get tracking data: %w", err)
+	}
+	address := tracking.IPAddr.String()
+	ch <- c.trackingInfo.mustNewConstMetric(1, fmt.Sprintf("%08X", tracking.RefID), address)
+	ch <- c.stratum.mustNewConstMetric(float64(tracking.Stratum))
+	for i, status := range chronyLeapStatus {
+		var value float64
+		if int(tracking.LeapStatus) == i {
+			value = 1
+		}
+		ch <- c.leapStatus.mustNewConstMetric(value, status)
+	}
+	ch <- c.referenceTime.mustNewConstMetric(tracking.RefTime.seconds())
+	ch <- c.systemTimeOffset.mustNewConstMetric(tracking.CurrentCorrection.value())
+	ch <- c.lastOffset.mustNewConstMetric(tracking.LastOffset.value())
+	ch <- c.rmsOffset.mustNewConstMetric(tracking.RMSOffset.value())
+	ch <- c.frequency.mustNewConstMetric(tracking.FreqPPM.value())
+	ch <- c.residualFrequency.mustNewConstMetric(tracking.ResidFreqPPM.value())
+	ch <- c.skew.mustNewConstMetric(tracking.SkewPPM.value())
+	ch <- c.rootDelay.mustNewConstMetric(tracking.RootDelay.value())
+	ch <- c.rootDispersion.mustNewConstMetric(tracking.RootDispersion.value())
+	ch <- c.updateInterval.mustNewConstMetric(tracking.LastUpdateInterval.value())
+
+	var n chronyNSources
+	if err := client.query(chronyReqNSources, chronyRpyNSources, nil, &n); err != nil {
+		return fmt.Errorf("couldn't get number of sources: %w", err)
+	}
+	for i := int32(0); i < int32(n.NSources); i++ {
+		var data chronySourceData
+		if err := client.query(chronyReqSourceData, chronyRpySourceData, &chronyIndexRequest{Index: i}, &data); err != nil {
+			return fmt.Errorf("couldn't get data of source %d: %w", i, err)
+		}
+		source := data.IPAddr.String()
+		if data.Mode == chronyModeRefclock {
+			// The address of reference clocks holds their reference ID.
+			source = chronyRefID(binary.BigEndian.Uint32(data.IPAddr.Addr[:4]))
+		}
+
+		var mode, state string
+		if int(data.Mode) < len(chronySourceModes) {
+			mode = chronySourceModes[data.Mode]
+		}
+		if int(data.State) < len(chronySourceStates) {
+			state = chronySourceStates[data.State]
+		}
+		var selected float64
+		if data.State == chronyStateSelected {
+			selected = 1
+		}
+		ch <- c.sourceInfo.mustNewConstMetric(1, source, mode, state)
+		ch <- c.sourceSelected.mustNewConstMetric(selected, source)
+		ch <- c.sourceStratum.mustNewConstMetric(float64(data.Stratum), source)
+		ch <- c.sourcePoll.mustNewConstMetric(math.Pow(2, float64(data.Poll)), source)
+		ch <- c.sourceReachability.mustNewConstMetric(float64(data.Reachability), source)
+		ch <- c.sourceLastSampleAge.mustNewConstMetric(float64(data.SinceSample), source)
+		ch <- c.sourceLastSampleOffset.mustNewConstMetric(data.LatestMeas.value(), source)
+		ch <- c.sourceLastSampleError.mustNewConstMetric(data.LatestMeasErr.value(), source)
+
+		var stats chronySourceStats
+		if err := client.query(chronyReqSourceStats, chronyRpySourceStats, &chronyIndexRequest{Index: i}, &stats); err != nil {
+			return fmt.Errorf("couldn't get statistics of source %d: %w", i, err)
+		}
+		ch <- c.sourceSamples.mustNewConstMetric(float64(stats.NSamples), source)
+		ch <- c.sourceSpan.mustNewConstMetric(float64(stats.SpanSeconds), source)
+		ch <- c.sourceStdDev.mustNewConstMetric(stats.SD.value(), source)
+		ch <- c.sourceResidualFrequency.mustNewConstMetric(stats.ResidFreqPPM.value(), source)
+		ch <- c.sourceSkew.mustNewConstMetric(stats.SkewPPM.value(), source)
+		ch <- c.sourceEstimatedOffset.mustNewConstMetric(stats.EstOffset.value(), source)
+		ch <- c.sourceEstimatedOffsetError.mustNewConstMetric(stats.EstOffsetErr.value(), source)
+	}
+	return nil
+}
@@ -0,0 +1,275 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nochrony
+// +build !nochrony
+
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// chronyFloatOf encodes a value in the chronyd protocol float format.
+func chronyFloatOf(v float64) chronyFloat {
+	if v == 0 {
+		return 0
+	}
+	_, exp := math.Frexp(v)
+	exp -= 24
+	coef := int32(math.Round(v / math.Pow(2, float64(exp))))
+	return chronyFloat(uint32(exp+25)&0x7f<<25 | uint32(coef)&(1<<25-1))
+}
+
+func chronyIPv4(ip string) chronyIPAddr {
+	a := chronyIPAddr{Family: chronyAddrInet4}
+	copy(a.Addr[:], net.ParseIP(ip).To4())
+	return a
+}
+
+// fakeChronyd answers tracking, sources and sourcestats requests like chronyd
+// with two sources, an NTP server and a PPS reference clock.
+type fakeChronyd struct {
+	conn net.PacketConn
+}
+
+func (f *fakeChronyd) serve(t *testing.T) {
+	buf := make([]byte, 1024)
+	for {
+		n, addr, err := f.conn.ReadFrom(buf)
+		if err != nil {
+			return
+		}
+		r := bytes.NewReader(buf[:n])
+		var req chronyRequestHeader
+		if err := binary.Read(r, binary.BigEndian, &req); err != nil {
+			t.Errorf("invalid request: %v", err)
+			return
+		}
+		var index chronyIndexRequest
+		binary.Read(r, binary.BigEndian, &index)
+
+		var (
+			code  uint16
+			reply interface{}
+		)
+		switch req.Command {
+		case chronyReqTracking:
+			code, reply = chronyRpyTracking, chronyTracking{
+				RefID:              0xc0000201,
+				IPAddr:             chronyIPv4("192.0.2.1"),
+				Stratum:            3,
+				RefTime:            chronyTimespec{SecHigh: chronyNoHighSec, SecLow: 1650000000, Nsec: 500000000},
+				CurrentCorrection:  chronyFloatOf(-0.0000152587890625),
+				LastOffset:         chronyFloatOf(0.000030517578125),
+				RMSOffset:          chronyFloatOf(0.00006103515625),
+				FreqPPM:            chronyFloatOf(-12.5),
+				ResidFreqPPM:       chronyFloatOf(0.001953125),
+				SkewPPM:            chronyFloatOf(0.0625),
+				RootDelay:          chronyFloatOf(0.0078125),
+				RootDispersion:     chronyFloatOf(0.0009765625),
+				LastUpdateInterval: chronyFloatOf(64.5),
+			}
+		case chronyReqNSources:
+			code, reply = chronyRpyNSources, chronyNSources{NSources: 2}
+		case chronyReqSourceData:
+			data := chronySourceData{
+				IPAddr:        chronyIPv4("192.0.2.1"),
+				Poll:          6,
+				Stratum:       2,
+				State:         chronyStateSelected,
+				Reachability:  0377,
+				SinceSample:   21,
+				LatestMeas:    chronyFloatOf(0.000244140625),
+				LatestMeasErr: chronyFloatOf(0.03125),
+			}
+			if index.Index == 1 {
+				data = chronySourceData{
+					IPAddr:       chronyIPAddr{Addr: [16]byte{'P', 'P', 'S', 0}, Family: chronyAddrInet4},
+					Poll:         4,
+					Mode:         chronyModeRefclock,
+					State:        3,
+					Reachability: 0376,
+					SinceSample:  10,
+				}
+			}
+			code, reply = chronyRpySourceData, data
+		case chronyReqSourceStats:
+			code, reply = chronyRpySourceStats, chronySourceStats{
+				NSamples:     uint32(10 + index.Index),
+				NRuns:        5,
+				SpanSeconds:  uint32(600 + index.Index),
+				SD:           chronyFloatOf(0.0001220703125),
+				ResidFreqPPM: chronyFloatOf(-0.125),
+				SkewPPM:      chronyFloatOf(0.25),
+				EstOffset:    chronyFloatOf(-0.000244140625),
+				EstOffsetErr: chronyFloatOf(0.00048828125),
+			}
+		default:
+			t.Errorf("unexpected command %d", req.Command)
+			return
+		}
+
+		// chronyd ignores requests shorter than their reply.
+		if n < binary.Size(chronyReplyHeader{})+binary.Size(reply) {
+			t.Errorf("request %d too short: %d bytes", req.Command, n)
+			continue
+		}
+
+		var resp bytes.Buffer
+		binary.Write(&resp, binary.BigEndian, chronyReplyHeader{
+			Version:  chronyProtocolVersion,
+			PktType:  chronyPktTypeReply,
+			Command:  req.Command,
+			Reply:    code,
+			Status:   chronySttSuccess,
+			Sequence: req.Sequence,
+		})
+		binary.Write(&resp, binary.BigEndian, reply)
+		if _, err := f.conn.WriteTo(resp.Bytes(), addr); err != nil {
+			t.Errorf("failed to send reply: %v", err)
+		}
+	}
+}
+
+func TestChronyFloat(t *testing.T) {
+	for _, v := range []float64{0, 1, -1, 0.5, -12.5, 1e-9, 123456.75, -0.000030517578125} {
+		got := chronyFloatOf(v).value()
+		if math.Abs(got-v) > math.Abs(v)*1e-7 {
+			t.Errorf("want %v, got %v", v, got)
+		}
+	}
+	// 2^-1 as encoded by chronyd.
+	if got := chronyFloat(0x02800000).value(); got != 0.5 {
+		t.Errorf("want 0.5, got %v", got)
+	}
+}
+
+func TestChronyCollector(t *testing.T) {
+	udp, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "chronyd.sock")
+	unix, err := net.ListenPacket("unixgram", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(address string, timeout time.Duration) {
+		*chronyAddress = address
+		*chronyTimeout = timeout
+	}(*chronyAddress, *chronyTimeout)
+	*chronyTimeout = time.Second
+
+	want := `# HELP node_chrony_source_info A metric with a constant '1' value labeled by the mode and selection state of a source.
+# TYPE node_chrony_source_info gauge
+node_chrony_source_info{mode="client",source="192.0.2.1",state="selected"} 1
+node_chrony_source_info{mode="refclock",source="PPS",state="jittery"} 1
+# HELP node_chrony_source_last_sample_offset_seconds Offset of the local clock to the source at the last sample.
+# TYPE node_chrony_source_last_sample_offset_seconds gauge
+node_chrony_source_last_sample_offset_seconds{source="192.0.2.1"} 0.000244140625
+node_chrony_source_last_sample_offset_seconds{source="PPS"} 0
+# HELP node_chrony_source_poll_interval_seconds Interval at which the source is polled.
+# TYPE node_chrony_source_poll_interval_seconds gauge
+node_chrony_source_poll_interval_seconds{source="192.0.2.1"} 64
+node_chrony_source_poll_interval_seconds{source="PPS"} 16
+# HELP node_chrony_source_reachability Reachability register of the source, a bitmask of the last 8 polls.
+# TYPE node_chrony_source_reachability gauge
+node_chrony_source_reachability{source="192.0.2.1"} 255
+node_chrony_source_reachability{source="PPS"} 254
+# HELP node_chrony_source_selected Whether the source is the one chronyd is synchronised to.
+# TYPE node_chrony_source_selected gauge
+node_chrony_source_selected{source="192.0.2.1"} 1
+node_chrony_source_selected{source="PPS"} 0
+# HELP node_chrony_sourcestats_samples Number of samples retained for the source.
+# TYPE node_chrony_sourcestats_samples gauge
+node_chrony_sourcestats_samples{source="192.0.2.1"} 10
+node_chrony_sourcestats_samples{source="PPS"} 11
+# HELP node_chrony_sourcestats_skew_ppm Estimated error bound of the frequency of the source in parts per million.
+# TYPE node_chrony_sourcestats_skew_ppm gauge
+node_chrony_sourcestats_skew_ppm{source="192.0.2.1"} 0.25
+node_chrony_sourcestats_skew_ppm{source="PPS"} 0.25
+# HELP node_chrony_tracking_frequency_ppm Frequency error of the system clock in parts per million.
+# TYPE node_chrony_tracking_frequency_ppm gauge
+node_chrony_tracking_frequency_ppm -12.5
+# HELP node_chrony_tracking_info A metric with a constant '1' value labeled by the reference ID and address of the source chronyd is synchronised to.
+# TYPE node_chrony_tracking_info gauge
+node_chrony_tracking_info{address="192.0.2.1",reference_id="C0000201"} 1
+# HELP node_chrony_tracking_leap_status Leap status of the local clock, 1 for the current status.
+# TYPE node_chrony_tracking_leap_status gauge
+node_chrony_tracking_leap_status{status="delete_second"} 0
+node_chrony_tracking_leap_status{status="insert_second"} 0
+node_chrony_tracking_leap_status{status="normal"} 1
+node_chrony_tracking_leap_status{status="unsynchronised"} 0
+# HELP node_chrony_tracking_reference_timestamp_seconds Time of the last measurement of the reference source, UNIX timestamp.
+# TYPE node_chrony_tracking_reference_timestamp_seconds gauge
+node_chrony_tracking_reference_timestamp_seconds 1.6500000005e+09
+# HELP node_chrony_tracking_stratum Stratum of the local clock.
+# TYPE node_chrony_tracking_stratum gauge
+node_chrony_tracking_stratum 3
+# HELP node_chrony_tracking_system_time_offset_seconds Offset of the system clock chronyd is currently correcting.
+# TYPE node_chrony_tracking_system_time_offset_seconds gauge
+node_chrony_tracking_system_time_offset_seconds -1.52587890625e-05
+# HELP node_chrony_tracking_update_interval_seconds Interval between the last two clock updates.
+# TYPE node_chrony_tracking_update_interval_seconds gauge
+node_chrony_tracking_update_interval_seconds 64.5
+`
+
+	for address, conn := range map[string]net.PacketConn{
+		udp.LocalAddr().String(): udp,
+		"unix://" + path:         unix,
+	} {
+		f := &fakeChronyd{conn: conn}
+		go f.serve(t)
+
+		*chronyAddress = address
+		c, err := NewChronyCollector(log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(collectorAdapter{c})
+		err = testutil.GatherAndCompare(registry, strings.NewReader(want),
+			"node_chrony_source_info",
+			"node_chrony_source_last_sample_offset_seconds",
+			"node_chrony_source_poll_interval_seconds",
+			"node_chrony_source_reachability",
+			"node_chrony_source_selected",
+			"node_chrony_sourcestats_samples",
+			"node_chrony_sourcestats_skew_ppm",
+			"node_chrony_tracking_frequency_ppm",
+			"node_chrony_tracking_info",
+			"node_chrony_tracking_leap_status",
+			"node_chrony_tracking_reference_timestamp_seconds",
+			"node_chrony_tracking_stratum",
+			"node_chrony_tracking_system_time_offset_seconds",
+			"node_chrony_tracking_update_interval_seconds",
+		)
+		if err != nil {
+			t.Errorf("%s: %v", address, err)
+		}
+		conn.Close()
+	}
+}
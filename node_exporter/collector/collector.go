@@ -77,8 +77,11 @@ func registerCollector(collector string, isDefaultEnabled bool, factory func(log
 
 // NodeCollector implements the prometheus.Collector interface.
 type NodeCollector struct {
-	Collectors map[string]Collector
-	logger     log.Logger
+	Collectors   map[string]Collector
+	seriesLimits map[string]int
+	targetLabels *targetLabels
+	rates        *rateSampler
+	logger       log.Logger
 }
 
 // DisableDefaultCollectors sets the collector state to false for all collectors which
@@ -123,43 +126,114 @@ func NewNodeCollector(logger log.Logger, filters ...string) (*NodeCollector, err
 		if !*enabled || (len(f) > 0 && !f[key]) {
 			continue
 		}
-		if collector, ok := initiatedCollectors[key]; ok {
-			collectors[key] = collector
-		} else {
-			collector, err := factories[key](log.With(logger, "collector", key))
-			if err != nil {
-				return nil, err
-			}
-			collectors[key] = collector
-			initiatedCollectors[key] = collector
+		collector, err := initiateCollector(key, logger)
+		if err != nil {
+			return nil, err
 		}
+		collectors[key] = collector
+	}
+	limits, err := seriesLimits(collectors)
+	if err != nil {
+		return nil, err
+	}
+	labels, err := newTargetLabels()
+	if err != nil {
+		return nil, err
+	}
+	sampler, err := startRateSampler(logger)
+	if err != nil {
+		return nil, err
+	}
+	return &NodeCollector{Collectors: collectors, seriesLimits: limits, targetLabels: labels, rates: sampler, logger: logger}, nil
+}
+
+// initiateCollector returns the instance of a collector, creating it on first
+// use. The caller must hold initiatedCollectorsMtx.
+func initiateCollector(key string, logger log.Logger) (Collector, error) {
+	if collector, ok := initiatedCollectors[key]; ok {
+		return collector, nil
+	}
+	collector, err := factories[key](log.With(logger, "collector", key))
+	if err != nil {
+		return nil, err
 	}
-	return &NodeCollector{Collectors: collectors, logger: logger}, nil
+	initiatedCollectors[key] = collector
+	return collector, nil
 }
 
 // Describe implements the prometheus.Collector interface.
 func (n NodeCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	if len(n.seriesLimits) > 0 {
+		ch <- seriesLimitExceededDesc
+	}
 }
 
 // Collect implements the prometheus.Collector interface.
 func (n NodeCollector) Collect(ch chan<- prometheus.Metric) {
-	wg := sync.WaitGroup{}
+	n.Scrape(ch)
+}
+
+// Scrape runs all collectors once like Collect and returns the errors of the
+// collectors which failed, keyed by collector name. Collectors which returned
+// no data are not considered failed.
+func (n NodeCollector) Scrape(ch chan<- prometheus.Metric) map[string]error {
+	var (
+		wg     = sync.WaitGroup{}
+		mtx    = sync.Mutex{}
+		failed = make(map[string]error)
+	)
 	wg.Add(len(n.Collectors))
 	for name, c := range n.Collectors {
 		go func(name string, c Collector) {
-			execute(name, c, ch, n.logger)
+			if n.rates != nil && n.rates.hasSeries(name) {
+				c = rateCollector{Collector: c, name: name, sampler: n.rates}
+			}
+			out := ch
+			var labeler *targetLabeler
+			if n.targetLabels.appliesTo(name) {
+				labeler = newTargetLabeler(ch, n.targetLabels.pairs)
+				out = labeler.ch
+			}
+			var err error
+			if limit, ok := n.seriesLimits[name]; ok {
+				err = executeWithSeriesLimit(name, c, limit, out, n.logger)
+			} else {
+				err = execute(name, c, out, n.logger)
+			}
+			if labeler != nil {
+				labeler.finish(name, n.logger)
+			}
+			if err != nil && !IsNoDataError(err) {
+				mtx.Lock()
+				failed[name] = err
+				mtx.Unlock()
+			}
 			wg.Done()
 		}(name, c)
 	}
 	wg.Wait()
+	return failed
 }
 
-func execute(name string, c Collector, ch chan<- prometheus.Metric, logger log.Logger) {
-	begin := time.Now()
-	err := c.Update(ch)
+func execute(name string, c Collector, ch chan<- prometheus.Metric, logger log.Logger) error {
+	var (
+		begin  = time.Now()
+		err    error
+		sample profileSample
+	)
+	if profilingEnabled {
+		sample, err = profileUpdate(c, ch)
+	} else {
+		err = c.Update(ch)
+	}
 	duration := time.Since(begin)
+	if profilingEnabled {
+		duration = sample.duration
+		recordProfile(name, duration, sample)
+	}
+	recordScrape(name, begin, duration, err)
 	var success float64
 
 	if err != nil {
@@ -175,6 +249,7 @@ func execute(name string, c Collector, ch chan<- prometheus.Metric, logger log.L
 	}
 	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
 	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+	return err
 }
 
 // Collector is the interface a collector has to implement.
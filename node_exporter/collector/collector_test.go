@@ -0,0 +1,59 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type errorTestCollector struct {
+	err error
+}
+
+func (c errorTestCollector) Update(ch chan<- prometheus.Metric) error {
+	return c.err
+}
+
+func TestScrapeErrors(t *testing.T) {
+	failure := errors.New("failure")
+	nc := NodeCollector{
+		Collectors: map[string]Collector{
+			"ok":      errorTestCollector{},
+			"nodata":  errorTestCollector{err: ErrNoData},
+			"failing": errorTestCollector{err: failure},
+			"limited": errorTestCollector{err: failure},
+		},
+		seriesLimits: map[string]int{"limited": 10},
+		logger:       log.NewNopLogger(),
+	}
+
+	var (
+		ch     = make(chan prometheus.Metric)
+		failed map[string]error
+	)
+	go func() {
+		failed = nc.Scrape(ch)
+		close(ch)
+	}()
+	for range ch {
+	}
+
+	if len(failed) != 2 || failed["failing"] != failure || failed["limited"] != failure {
+		t.Errorf("want failing and limited collectors to fail, got %v", failed)
+	}
+}
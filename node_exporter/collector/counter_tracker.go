@@ -0,0 +1,100 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"math"
+	"sync"
+)
+
+// counterTracker turns raw per-device counters, which may wrap around at 32
+// bits or be reset (e.g. by a driver reload), into monotonic counters by
+// accumulating the increments observed between scrapes.
+type counterTracker struct {
+	mtx     sync.Mutex
+	devices map[string]*trackedDevice
+}
+
+type trackedDevice struct {
+	raw    map[string]uint64
+	value  map[string]uint64
+	resets uint64
+}
+
+func newCounterTracker() *counterTracker {
+	return &counterTracker{devices: make(map[string]*trackedDevice)}
+}
+
+// observe records the raw counters of a device and returns the monotonic
+// counters together with the number of wraps or resets seen so far. Several
+// counters wrapping or resetting in the same observation count only once.
+func (t *counterTracker) observe(device string, raw map[string]uint64) (map[string]uint64, uint64) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	d, ok := t.devices[device]
+	if !ok {
+		d = &trackedDevice{
+			raw:   make(map[string]uint64, len(raw)),
+			value: make(map[string]uint64, len(raw)),
+		}
+		t.devices[device] = d
+	}
+
+	var reset bool
+	result := make(map[string]uint64, len(raw))
+	for key, cur := range raw {
+		prev, ok := d.raw[key]
+		if !ok {
+			d.value[key] = cur
+		} else {
+			delta, r := counterDelta(prev, cur)
+			d.value[key] += delta
+			reset = reset || r
+		}
+		d.raw[key] = cur
+		result[key] = d.value[key]
+	}
+	if reset {
+		d.resets++
+	}
+	return result, d.resets
+}
+
+// forget drops the state of all devices not contained in the given set, so
+// that removed interfaces don't accumulate.
+func (t *counterTracker) forget(keep map[string]struct{}) {
+	t.mtx.Lock()
+	defer t.mtx.Unlock()
+
+	for device := range t.devices {
+		if _, ok := keep[device]; !ok {
+			delete(t.devices, device)
+		}
+	}
+}
+
+// counterDelta returns the increment between two raw counter values and
+// whether the counter wrapped or was reset in between. A decrease from the
+// upper half of the 32-bit range is treated as a 32-bit wrap, any other
+// decrease as a reset to zero.
+func counterDelta(prev, cur uint64) (uint64, bool) {
+	if cur >= prev {
+		return cur - prev, false
+	}
+	if prev <= math.MaxUint32 && prev >= 1<<31 {
+		return math.MaxUint32 - prev + cur + 1, true
+	}
+	return cur, true
+}
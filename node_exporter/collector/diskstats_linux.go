@@ -17,8 +17,13 @@
 package collector
 
 import (
+	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"regexp"
+	"strings"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -33,6 +38,7 @@ const (
 
 var (
 	ignoredDevices = kingpin.Flag("collector.diskstats.ignored-devices", "Regexp of devices to ignore for diskstats.").Default("^(ram|loop|fd|(h|s|v|xv)d[a-z]|nvme\\d+n\\d+p)\\d+$").String()
+	ignoredDMNames = kingpin.Flag("collector.diskstats.ignored-dm-names", "Regexp of device-mapper names, e.g. vg0-data or mpatha, of devices to ignore for diskstats.").Default("").String()
 )
 
 type typedFactorDesc struct {
@@ -46,8 +52,11 @@ func (d *typedFactorDesc) mustNewConstMetric(value float64, labels ...string) pr
 
 type diskstatsCollector struct {
 	ignoredDevicesPattern *regexp.Regexp
+	ignoredDMNamesPattern *regexp.Regexp
 	fs                    blockdevice.FS
 	infoDesc              typedFactorDesc
+	dmInfoDesc            typedFactorDesc
+	slaveInfoDesc         typedFactorDesc
 	descs                 []typedFactorDesc
 	logger                log.Logger
 }
@@ -65,8 +74,17 @@ func NewDiskstatsCollector(logger log.Logger) (Collector, error) {
 		return nil, fmt.Errorf("failed to open sysfs: %w", err)
 	}
 
+	var ignoredDMNamesPattern *regexp.Regexp
+	if *ignoredDMNames != "" {
+		ignoredDMNamesPattern, err = regexp.Compile(*ignoredDMNames)
+		if err != nil {
+			return nil, fmt.Errorf("invalid regexp for device-mapper names to ignore: %w", err)
+		}
+	}
+
 	return &diskstatsCollector{
 		ignoredDevicesPattern: regexp.MustCompile(*ignoredDevices),
+		ignoredDMNamesPattern: ignoredDMNamesPattern,
 		fs:                    fs,
 		infoDesc: typedFactorDesc{
 			desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, diskSubsystem, "info"),
@@ -75,6 +93,20 @@ func NewDiskstatsCollector(logger log.Logger) (Collector, error) {
 				nil,
 			), valueType: prometheus.GaugeValue,
 		},
+		dmInfoDesc: typedFactorDesc{
+			desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, diskSubsystem, "device_mapper_info"),
+				"Info of /sys/block/<block_device>/dm, with the VG and LV names of LVM volumes and the WWID of multipath devices.",
+				[]string{"device", "name", "uuid", "vg_name", "lv_name", "lv_layer", "multipath_wwid"},
+				nil,
+			), valueType: prometheus.GaugeValue,
+		},
+		slaveInfoDesc: typedFactorDesc{
+			desc: prometheus.NewDesc(prometheus.BuildFQName(namespace, diskSubsystem, "slave_info"),
+				"A metric with a constant '1' value for each device underlying a block device, from /sys/block/<block_device>/slaves.",
+				[]string{"device", "slave"},
+				nil,
+			), valueType: prometheus.GaugeValue,
+		},
 		descs: []typedFactorDesc{
 			{
 				desc: readsCompletedDesc, valueType: prometheus.CounterValue,
@@ -195,6 +227,15 @@ func (c *diskstatsCollector) Update(ch chan<- prometheus.Metric) error {
 			continue
 		}
 
+		dm, err := readDeviceMapperInfo(dev)
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "Error getting device-mapper info", "device", dev, "err", err)
+		}
+		if dm != nil && c.ignoredDMNamesPattern != nil && c.ignoredDMNamesPattern.MatchString(dm.name) {
+			level.Debug(c.logger).Log("msg", "Ignoring device-mapper device", "device", dev, "name", dm.name, "pattern", c.ignoredDMNamesPattern)
+			continue
+		}
+
 		diskSectorSize := 512.0
 		blockQueue, err := c.fs.SysBlockDeviceQueueStats(dev)
 		if err != nil {
@@ -204,6 +245,16 @@ func (c *diskstatsCollector) Update(ch chan<- prometheus.Metric) error {
 		}
 
 		ch <- c.infoDesc.mustNewConstMetric(1.0, dev, fmt.Sprint(stats.MajorNumber), fmt.Sprint(stats.MinorNumber))
+		if dm != nil {
+			ch <- c.dmInfoDesc.mustNewConstMetric(1.0, dev, dm.name, dm.uuid, dm.vgName, dm.lvName, dm.lvLayer, dm.multipathWWID)
+		}
+		slaves, err := ioutil.ReadDir(sysFilePath(filepath.Join("block", dev, "slaves")))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "Error getting slave devices", "device", dev, "err", err)
+		}
+		for _, slave := range slaves {
+			ch <- c.slaveInfoDesc.mustNewConstMetric(1.0, dev, slave.Name())
+		}
 
 		statCount := stats.IoStatsCount - 3 // Total diskstats record count, less MajorNumber, MinorNumber and DeviceName
 
@@ -234,3 +285,74 @@ func (c *diskstatsCollector) Update(ch chan<- prometheus.Metric) error {
 	}
 	return nil
 }
+
+// deviceMapperInfo describes a device-mapper device like an LVM volume or a
+// multipath device.
+type deviceMapperInfo struct {
+	name          string
+	uuid          string
+	vgName        string
+	lvName        string
+	lvLayer       string
+	multipathWWID string
+}
+
+// readDeviceMapperInfo reads /sys/block/<dev>/dm. It returns nil if dev isn't
+// a device-mapper device.
+func readDeviceMapperInfo(dev string) (*deviceMapperInfo, error) {
+	name, err := ioutil.ReadFile(sysFilePath(filepath.Join("block", dev, "dm", "name")))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	uuid, err := ioutil.ReadFile(sysFilePath(filepath.Join("block", dev, "dm", "uuid")))
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, err
+	}
+
+	info := &deviceMapperInfo{
+		name: strings.TrimSpace(string(name)),
+		uuid: strings.TrimSpace(string(uuid)),
+	}
+	// The UUID prefix is set by the tool which created the device.
+	switch {
+	case strings.HasPrefix(info.uuid, "LVM-"):
+		info.vgName, info.lvName, info.lvLayer = parseLVMName(info.name)
+	case strings.HasPrefix(info.uuid, "mpath-"):
+		info.multipathWWID = strings.TrimPrefix(info.uuid, "mpath-")
+	}
+	return info, nil
+}
+
+// parseLVMName splits the device-mapper name LVM gives its devices into the
+// VG name, LV name and the optional layer, e.g. tpool for thin pools. The
+// parts are separated by dashes, dashes within the parts are doubled.
+func parseLVMName(name string) (vg, lv, layer string) {
+	var parts []string
+	var part strings.Builder
+	for i := 0; i < len(name); i++ {
+		if name[i] != '-' {
+			part.WriteByte(name[i])
+			continue
+		}
+		if i+1 < len(name) && name[i+1] == '-' {
+			part.WriteByte('-')
+			i++
+			continue
+		}
+		parts = append(parts, part.String())
+		part.Reset()
+	}
+	parts = append(parts, part.String())
+
+	switch len(parts) {
+	case 1:
+		return parts[0], "", ""
+	case 2:
+		return parts[0], parts[1], ""
+	default:
+		return parts[0], parts[1], strings.Join(parts[2:], "-")
+	}
+}
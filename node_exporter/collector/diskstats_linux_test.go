@@ -15,7 +15,9 @@ package collector
 
 import (
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
 
@@ -50,7 +52,13 @@ func TestDiskStats(t *testing.T) {
 	*sysPath = "fixtures/sys"
 	*procPath = "fixtures/proc"
 	*ignoredDevices = "^(ram|loop|fd|(h|s|v|xv)d[a-z]|nvme\\d+n\\d+p)\\d+$"
-	testcase := `# HELP node_disk_discard_time_seconds_total This is the total number of seconds spent by all discards.
+	testcase := `# HELP node_disk_device_mapper_info Info of /sys/block/<block_device>/dm, with the VG and LV names of LVM volumes and the WWID of multipath devices.
+# TYPE node_disk_device_mapper_info gauge
+node_disk_device_mapper_info{device="dm-0",lv_layer="",lv_name="root",multipath_wwid="",name="system-root",uuid="LVM-Ql7fFQjiKfPmFq9FaFWkSL1rQ3PQrFn9x9ZkYoEjDQ0W6zUGSdwx2BxiLc0kdP07",vg_name="system"} 1
+node_disk_device_mapper_info{device="dm-1",lv_layer="tpool",lv_name="thin-pool",multipath_wwid="",name="data--vg-thin--pool-tpool",uuid="LVM-eR5YnBPngZW5ZVZqHXhBH5zYk0CDMUjxp3Zdln8A4vg5XhVEjNU6T0Ys8bJkZh3o-tpool",vg_name="data-vg"} 1
+node_disk_device_mapper_info{device="dm-2",lv_layer="",lv_name="",multipath_wwid="3600508b400105e210000900000490000",name="mpatha",uuid="mpath-3600508b400105e210000900000490000",vg_name=""} 1
+node_disk_device_mapper_info{device="dm-3",lv_layer="",lv_name="",multipath_wwid="",name="luks-0b7a8bd6",uuid="CRYPT-LUKS2-0b7a8bd6c2a14b0f8ef7c5a0e8f3c1a2-luks-0b7a8bd6",vg_name=""} 1
+# HELP node_disk_discard_time_seconds_total This is the total number of seconds spent by all discards.
 # TYPE node_disk_discard_time_seconds_total counter
 node_disk_discard_time_seconds_total{device="sdb"} 11.13
 node_disk_discard_time_seconds_total{device="sdc"} 11.13
@@ -208,6 +216,12 @@ node_disk_reads_merged_total{device="sdb"} 841
 node_disk_reads_merged_total{device="sdc"} 141
 node_disk_reads_merged_total{device="sr0"} 0
 node_disk_reads_merged_total{device="vda"} 15386
+# HELP node_disk_slave_info A metric with a constant '1' value for each device underlying a block device, from /sys/block/<block_device>/slaves.
+# TYPE node_disk_slave_info gauge
+node_disk_slave_info{device="dm-0",slave="md3"} 1
+node_disk_slave_info{device="dm-1",slave="md201"} 1
+node_disk_slave_info{device="dm-2",slave="sda"} 1
+node_disk_slave_info{device="dm-3",slave="dm-2"} 1
 # HELP node_disk_write_time_seconds_total This is the total number of seconds spent by all writes.
 # TYPE node_disk_write_time_seconds_total counter
 node_disk_write_time_seconds_total{device="dm-0"} 1.1585578e+06
@@ -304,3 +318,65 @@ node_disk_written_bytes_total{device="vda"} 1.0938236928e+11
 		t.Fatal(err)
 	}
 }
+
+func TestParseLVMName(t *testing.T) {
+	for _, tc := range []struct {
+		name, vg, lv, layer string
+	}{
+		{"vg0-data", "vg0", "data", ""},
+		{"data--vg-thin--pool-tpool", "data-vg", "thin-pool", "tpool"},
+		{"vg0-mirror_rimage_0", "vg0", "mirror_rimage_0", ""},
+		{"vg0", "vg0", "", ""},
+	} {
+		vg, lv, layer := parseLVMName(tc.name)
+		if vg != tc.vg || lv != tc.lv || layer != tc.layer {
+			t.Errorf("%s: want %q %q %q, got %q %q %q", tc.name, tc.vg, tc.lv, tc.layer, vg, lv, layer)
+		}
+	}
+}
+
+func TestDiskStatsDeviceMapperErrors(t *testing.T) {
+	defer func(proc, sys, ignored string) {
+		*procPath, *sysPath, *ignoredDevices = proc, sys, ignored
+	}(*procPath, *sysPath, *ignoredDevices)
+
+	dir, err := ioutil.TempDir("", "diskstats")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	*procPath = filepath.Join(dir, "proc")
+	*sysPath = filepath.Join(dir, "sys")
+	*ignoredDevices = "^$"
+
+	// The dm name and the slaves can't be read: the former is a directory,
+	// the latter a file.
+	for _, path := range []string{"proc", "sys/block/dm-0/dm/name"} {
+		if err := os.MkdirAll(filepath.Join(dir, path), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for path, content := range map[string]string{
+		"proc/diskstats":        " 253       0 dm-0 100 0 800 10 50 0 400 20 0 30 30 0 0 0 0\n",
+		"sys/block/dm-0/slaves": "",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, path), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := NewDiskstatsCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectorAdapter{c})
+	want := `# HELP node_disk_reads_completed_total The total number of reads completed successfully.
+# TYPE node_disk_reads_completed_total counter
+node_disk_reads_completed_total{device="dm-0"} 100
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want),
+		"node_disk_reads_completed_total", "node_disk_device_mapper_info", "node_disk_slave_info"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -17,9 +17,14 @@
 package collector
 
 import (
+	"encoding/binary"
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
 
 	"github.com/go-kit/log"
@@ -31,6 +36,30 @@ import (
 type dmiCollector struct {
 	infoDesc *prometheus.Desc
 	values   []string
+
+	memoryDevices   []dmiMemoryDevice
+	memoryInfo      typedDesc
+	memorySize      typedDesc
+	memorySpeed     typedDesc
+	memoryConfSpeed typedDesc
+}
+
+// dmiMemoryDevice is a memory device (SMBIOS type 17), i.e. a memory slot
+// which may or may not be populated.
+type dmiMemoryDevice struct {
+	// handle identifies the structure, locators are not necessarily unique.
+	handle          string
+	locator         string
+	bankLocator     string
+	formFactor      string
+	memoryType      string
+	manufacturer    string
+	serialNumber    string
+	partNumber      string
+	size            uint64 // in bytes, 0 if no module is installed
+	sizeKnown       bool
+	speed           uint64 // in transfers per second, 0 if unknown
+	configuredSpeed uint64 // in transfers per second, 0 if unknown
 }
 
 func init() {
@@ -54,6 +83,13 @@ func NewDMICollector(logger log.Logger) (Collector, error) {
 		}
 	}
 
+	// The memory inventory is optional, errors reading it never prevent the
+	// collector from starting.
+	memoryDevices, err := readDMIMemoryDevices(sysFilePath("firmware/dmi/entries"), logger)
+	if err != nil {
+		level.Debug(logger).Log("msg", "Could not read SMBIOS memory device entries", "err", err)
+	}
+
 	var labels, values []string
 	for label, value := range map[string]*string{
 		"bios_date":         dmi.BiosDate,
@@ -93,14 +129,169 @@ func NewDMICollector(logger log.Logger) (Collector, error) {
 				"product_sku, product_uuid, product_version, system_vendor if provided by DMI.",
 			labels, nil,
 		),
-		values: values,
+		values:        values,
+		memoryDevices: memoryDevices,
+		memoryInfo: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dmi", "memory_device_info"),
+			"A metric with a constant '1' value labeled by the SMBIOS handle, locator, bank_locator, form_factor, type, manufacturer, serial_number and part_number of a memory device.",
+			[]string{"handle", "locator", "bank_locator", "form_factor", "type", "manufacturer", "serial_number", "part_number"}, nil,
+		), prometheus.GaugeValue},
+		memorySize: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dmi", "memory_device_size_bytes"),
+			"Size of the memory device, 0 if no module is installed.",
+			[]string{"handle", "locator", "bank_locator"}, nil,
+		), prometheus.GaugeValue},
+		memorySpeed: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dmi", "memory_device_speed_transfers_per_second"),
+			"Maximum speed of the memory device.",
+			[]string{"handle", "locator", "bank_locator"}, nil,
+		), prometheus.GaugeValue},
+		memoryConfSpeed: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "dmi", "memory_device_configured_speed_transfers_per_second"),
+			"Speed the memory device is configured to run at.",
+			[]string{"handle", "locator", "bank_locator"}, nil,
+		), prometheus.GaugeValue},
 	}, nil
 }
 
 func (c *dmiCollector) Update(ch chan<- prometheus.Metric) error {
-	if len(c.values) == 0 {
+	if len(c.values) == 0 && len(c.memoryDevices) == 0 {
 		return ErrNoData
 	}
-	ch <- prometheus.MustNewConstMetric(c.infoDesc, prometheus.GaugeValue, 1.0, c.values...)
+	if len(c.values) > 0 {
+		ch <- prometheus.MustNewConstMetric(c.infoDesc, prometheus.GaugeValue, 1.0, c.values...)
+	}
+	for _, d := range c.memoryDevices {
+		ch <- c.memoryInfo.mustNewConstMetric(1.0, d.handle, d.locator, d.bankLocator, d.formFactor, d.memoryType, d.manufacturer, d.serialNumber, d.partNumber)
+		if d.sizeKnown {
+			ch <- c.memorySize.mustNewConstMetric(float64(d.size), d.handle, d.locator, d.bankLocator)
+		}
+		if d.speed > 0 {
+			ch <- c.memorySpeed.mustNewConstMetric(float64(d.speed), d.handle, d.locator, d.bankLocator)
+		}
+		if d.configuredSpeed > 0 {
+			ch <- c.memoryConfSpeed.mustNewConstMetric(float64(d.configuredSpeed), d.handle, d.locator, d.bankLocator)
+		}
+	}
 	return nil
 }
+
+// SMBIOS memory form factors and types, see DSP0134 7.18.1 and 7.18.2.
+var (
+	dmiMemoryFormFactors = map[byte]string{
+		0x01: "Other", 0x02: "Unknown", 0x03: "SIMM", 0x04: "SIP", 0x05: "Chip", 0x06: "DIP",
+		0x07: "ZIP", 0x08: "Proprietary Card", 0x09: "DIMM", 0x0A: "TSOP", 0x0B: "Row of chips",
+		0x0C: "RIMM", 0x0D: "SODIMM", 0x0E: "SRIMM", 0x0F: "FB-DIMM", 0x10: "Die",
+	}
+	dmiMemoryTypes = map[byte]string{
+		0x01: "Other", 0x02: "Unknown", 0x03: "DRAM", 0x04: "EDRAM", 0x05: "VRAM", 0x06: "SRAM",
+		0x07: "RAM", 0x08: "ROM", 0x09: "Flash", 0x0A: "EEPROM", 0x0B: "FEPROM", 0x0C: "EPROM",
+		0x0D: "CDRAM", 0x0E: "3DRAM", 0x0F: "SDRAM", 0x10: "SGRAM", 0x11: "RDRAM", 0x12: "DDR",
+		0x13: "DDR2", 0x14: "DDR2 FB-DIMM", 0x18: "DDR3", 0x19: "FBD2", 0x1A: "DDR4", 0x1B: "LPDDR",
+		0x1C: "LPDDR2", 0x1D: "LPDDR3", 0x1E: "LPDDR4", 0x1F: "Logical non-volatile device",
+		0x20: "HBM", 0x21: "HBM2", 0x22: "DDR5", 0x23: "LPDDR5",
+	}
+)
+
+// readDMIMemoryDevices parses the SMBIOS memory device (type 17) structures
+// exposed in /sys/firmware/dmi/entries. Reading them usually requires root.
+// Entries which can't be read or parsed are logged and skipped.
+func readDMIMemoryDevices(entries string, logger log.Logger) ([]dmiMemoryDevice, error) {
+	if _, err := os.Stat(entries); err != nil {
+		return nil, err
+	}
+	paths, err := filepath.Glob(filepath.Join(entries, "17-*", "raw"))
+	if err != nil {
+		return nil, err
+	}
+	// Sort by instance number, so that the slots are listed in order.
+	sort.Slice(paths, func(i, j int) bool {
+		return dmiEntryInstance(paths[i]) < dmiEntryInstance(paths[j])
+	})
+
+	var devices []dmiMemoryDevice
+	for _, path := range paths {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			level.Debug(logger).Log("msg", "Could not read SMBIOS memory device entry", "path", path, "err", err)
+			continue
+		}
+		device, err := parseDMIMemoryDevice(raw)
+		if err != nil {
+			level.Warn(logger).Log("msg", "Skipping invalid SMBIOS memory device entry", "path", path, "err", err)
+			continue
+		}
+		devices = append(devices, device)
+	}
+	return devices, nil
+}
+
+func dmiEntryInstance(path string) int {
+	name := filepath.Base(filepath.Dir(path))
+	instance, _ := strconv.Atoi(strings.TrimPrefix(name, "17-"))
+	return instance
+}
+
+// parseDMIMemoryDevice parses a single SMBIOS type 17 structure including its
+// trailing string set.
+func parseDMIMemoryDevice(raw []byte) (dmiMemoryDevice, error) {
+	var d dmiMemoryDevice
+	if len(raw) < 0x15 || raw[0] != 17 {
+		return d, fmt.Errorf("not a memory device structure")
+	}
+	length := int(raw[1])
+	if length < 0x15 || length > len(raw) {
+		return d, fmt.Errorf("invalid structure length %d", length)
+	}
+	strs := strings.Split(string(raw[length:]), "\x00")
+	str := func(offset int) string {
+		if offset >= length {
+			return ""
+		}
+		idx := int(raw[offset])
+		if idx == 0 || idx > len(strs) {
+			return ""
+		}
+		return strings.ToValidUTF8(strings.TrimSpace(strs[idx-1]), "�")
+	}
+	word := func(offset int) uint16 {
+		return binary.LittleEndian.Uint16(raw[offset:])
+	}
+
+	d.handle = fmt.Sprintf("0x%04X", word(0x02))
+	d.locator = str(0x10)
+	d.bankLocator = str(0x11)
+	d.formFactor = dmiMemoryFormFactors[raw[0x0E]]
+	d.memoryType = dmiMemoryTypes[raw[0x12]]
+
+	switch size := word(0x0C); {
+	case size == 0xFFFF:
+		// Unknown size.
+	case size == 0x7FFF && length >= 0x20:
+		d.size = uint64(binary.LittleEndian.Uint32(raw[0x1C:])&0x7FFFFFFF) << 20
+		d.sizeKnown = true
+	case size&0x8000 != 0:
+		d.size = uint64(size&0x7FFF) << 10
+		d.sizeKnown = true
+	default:
+		d.size = uint64(size) << 20
+		d.sizeKnown = true
+	}
+
+	if length >= 0x17 {
+		if speed := word(0x15); speed != 0 && speed != 0xFFFF {
+			d.speed = uint64(speed) * 1e6
+		}
+	}
+	if length >= 0x1B {
+		d.manufacturer = str(0x17)
+		d.serialNumber = str(0x18)
+		d.partNumber = str(0x1A)
+	}
+	if length >= 0x22 {
+		if speed := word(0x20); speed != 0 && speed != 0xFFFF {
+			d.configuredSpeed = uint64(speed) * 1e6
+		}
+	}
+	return d, nil
+}
@@ -0,0 +1,188 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build linux && !nodmi
+// +build linux,!nodmi
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// dmiTestMemoryDevice returns a raw SMBIOS 2.8 memory device structure of a
+// 16 GiB DDR4 DIMM.
+func dmiTestMemoryDevice() []byte {
+	raw := make([]byte, 0x22)
+	raw[0x00] = 17
+	raw[0x01] = 0x22
+	raw[0x02] = 0x11                  // handle 0x0011
+	raw[0x0C], raw[0x0D] = 0x00, 0x40 // 16384 MiB
+	raw[0x0E] = 0x09                  // DIMM
+	raw[0x10] = 1
+	raw[0x11] = 2
+	raw[0x12] = 0x1A                  // DDR4
+	raw[0x15], raw[0x16] = 0x80, 0x0C // 3200 MT/s
+	raw[0x17] = 3
+	raw[0x18] = 4
+	raw[0x1A] = 5
+	raw[0x20], raw[0x21] = 0x75, 0x0B // 2933 MT/s
+	return append(raw, "DIMM_A1\x00BANK 0\x00Samsung\x0012345678\x00M393A2K43CB2-CTD \x00\x00"...)
+}
+
+func TestParseDMIMemoryDevice(t *testing.T) {
+	valid := dmiTestMemoryDevice()
+	tests := []struct {
+		name    string
+		raw     []byte
+		want    dmiMemoryDevice
+		wantErr bool
+	}{
+		{
+			name: "valid",
+			raw:  valid,
+			want: dmiMemoryDevice{
+				handle:          "0x0011",
+				locator:         "DIMM_A1",
+				bankLocator:     "BANK 0",
+				formFactor:      "DIMM",
+				memoryType:      "DDR4",
+				manufacturer:    "Samsung",
+				serialNumber:    "12345678",
+				partNumber:      "M393A2K43CB2-CTD",
+				size:            16 << 30,
+				sizeKnown:       true,
+				speed:           3200e6,
+				configuredSpeed: 2933e6,
+			},
+		},
+		{
+			name: "SMBIOS 2.1 without speeds and strings beyond the locators",
+			raw:  append([]byte{17, 0x15, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x00, 0x82, 0x0D, 0, 1, 0, 0x12, 0, 0}, "SODIMM0\x00\x00"...),
+			want: dmiMemoryDevice{
+				handle:     "0x0000",
+				locator:    "SODIMM0",
+				formFactor: "SODIMM",
+				memoryType: "DDR",
+				size:       512 << 10,
+				sizeKnown:  true,
+			},
+		},
+		{
+			name:    "truncated",
+			raw:     valid[:0x10],
+			wantErr: true,
+		},
+		{
+			name:    "length beyond the data",
+			raw:     append([]byte{17, 0xFF}, valid[2:0x22]...),
+			wantErr: true,
+		},
+		{
+			name:    "other structure type",
+			raw:     append([]byte{16}, valid[1:]...),
+			wantErr: true,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			got, err := parseDMIMemoryDevice(tc.raw)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("want error, got %+v", got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("want %+v, got %+v", tc.want, got)
+			}
+		})
+	}
+}
+
+func TestReadDMIMemoryDevicesSkipsInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dmi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, raw := range map[string][]byte{
+		"17-0": dmiTestMemoryDevice(),
+		"17-1": dmiTestMemoryDevice()[:0x08],
+	} {
+		if err := os.Mkdir(filepath.Join(dir, name), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name, "raw"), raw, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	devices, err := readDMIMemoryDevices(dir, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].locator != "DIMM_A1" {
+		t.Errorf("want only the valid device, got %+v", devices)
+	}
+}
+
+func TestDMIMemoryDevicesSharingLocators(t *testing.T) {
+	defer func(path string) { *sysPath = path }(*sysPath)
+	dir, err := ioutil.TempDir("", "dmi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	*sysPath = dir
+
+	// Both entries have the same locators, as reported by many BIOSes.
+	for i, name := range []string{"17-0", "17-1"} {
+		raw := dmiTestMemoryDevice()
+		raw[0x02] = byte(0x20 + i)
+		entry := filepath.Join(dir, "firmware/dmi/entries", name)
+		if err := os.MkdirAll(entry, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(entry, "raw"), raw, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	c, err := NewDMICollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectorAdapter{c})
+	want := `# HELP node_dmi_memory_device_size_bytes Size of the memory device, 0 if no module is installed.
+# TYPE node_dmi_memory_device_size_bytes gauge
+node_dmi_memory_device_size_bytes{bank_locator="BANK 0",handle="0x0020",locator="DIMM_A1"} 1.7179869184e+10
+node_dmi_memory_device_size_bytes{bank_locator="BANK 0",handle="0x0021",locator="DIMM_A1"} 1.7179869184e+10
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "node_dmi_memory_device_size_bytes"); err != nil {
+		t.Error(err)
+	}
+}
@@ -44,6 +44,10 @@ var (
 	ethtoolIncludedMetrics = kingpin.Flag("collector.ethtool.metrics-include", "Regexp of ethtool stats to include.").Default(".*").String()
 	ethtoolReceivedRegex   = regexp.MustCompile(`(^|_)rx(_|$)`)
 	ethtoolTransmitRegex   = regexp.MustCompile(`(^|_)tx(_|$)`)
+
+	// ethtoolCounters are the well-known stats exported as counters, which
+	// are kept monotonic across wraps and resets.
+	ethtoolCounters = []string{"rx_bytes", "rx_dropped", "rx_errors", "rx_packets", "tx_bytes", "tx_errors", "tx_packets"}
 )
 
 type Ethtool interface {
@@ -76,6 +80,8 @@ type ethtoolCollector struct {
 	ethtool        Ethtool
 	deviceFilter   netDevFilter
 	infoDesc       *prometheus.Desc
+	resetsDesc     *prometheus.Desc
+	counters       *counterTracker
 	metricsPattern *regexp.Regexp
 	logger         log.Logger
 }
@@ -195,6 +201,12 @@ func makeEthtoolCollector(logger log.Logger) (*ethtoolCollector, error) {
 			"A metric with a constant '1' value labeled by bus_info, device, driver, expansion_rom_version, firmware_version, version.",
 			[]string{"bus_info", "device", "driver", "expansion_rom_version", "firmware_version", "version"}, nil,
 		),
+		resetsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "ethtool", "counter_resets_total"),
+			"Number of scrapes in which a network interface counter wrapped around or was reset.",
+			[]string{"device"}, nil,
+		),
+		counters: newCounterTracker(),
 	}, nil
 }
 
@@ -319,6 +331,7 @@ func (c *ethtoolCollector) Update(ch chan<- prometheus.Metric) error {
 		return fmt.Errorf("no network devices found")
 	}
 
+	tracked := make(map[string]struct{})
 	for device := range netClass {
 		var stats map[string]uint64
 		var err error
@@ -385,6 +398,21 @@ func (c *ethtoolCollector) Update(ch chan<- prometheus.Metric) error {
 			continue
 		}
 
+		counters := make(map[string]uint64, len(ethtoolCounters))
+		for _, metric := range ethtoolCounters {
+			if val, ok := stats[metric]; ok {
+				counters[metric] = val
+			}
+		}
+		if len(counters) > 0 {
+			tracked[device] = struct{}{}
+			counters, resets := c.counters.observe(device, counters)
+			for metric, val := range counters {
+				stats[metric] = val
+			}
+			ch <- prometheus.MustNewConstMetric(c.resetsDesc, prometheus.CounterValue, float64(resets), device)
+		}
+
 		// Sanitizing the metric names can lead to duplicate metric names. Therefore check for clashes beforehand.
 		metricFQNames := make(map[string]string)
 		for metric := range stats {
@@ -433,6 +461,7 @@ func (c *ethtoolCollector) Update(ch chan<- prometheus.Metric) error {
 				entry, prometheus.UntypedValue, float64(val), device)
 		}
 	}
+	c.counters.forget(tracked)
 
 	return nil
 }
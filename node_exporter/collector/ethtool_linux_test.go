@@ -285,6 +285,9 @@ func TestEthToolCollector(t *testing.T) {
 	testcase := `# HELP node_ethtool_align_errors Network interface align_errors
 # TYPE node_ethtool_align_errors untyped
 node_ethtool_align_errors{device="eth0"} 0
+# HELP node_ethtool_counter_resets_total Number of scrapes in which a network interface counter wrapped around or was reset.
+# TYPE node_ethtool_counter_resets_total counter
+node_ethtool_counter_resets_total{device="eth0"} 0
 # HELP node_ethtool_info A metric with a constant '1' value labeled by bus_info, device, driver, expansion_rom_version, firmware_version, version.
 # TYPE node_ethtool_info gauge
 node_ethtool_info{bus_info="0000:00:1f.6",device="eth0",driver="e1000e",expansion_rom_version="",firmware_version="0.5-4",version="5.11.0-22-generic"} 1
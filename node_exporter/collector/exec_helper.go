@@ -0,0 +1,202 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noexec_helper && !notextfile
+// +build !noexec_helper,!notextfile
+
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	execHelperCommands       = kingpin.Flag("collector.exec_helper.command", "Helper command (with arguments) whose standard output is parsed in the text exposition format. Can be repeated.").Strings()
+	execHelperTimeout        = kingpin.Flag("collector.exec_helper.timeout", "Timeout after which a helper command is killed.").Default("10s").Duration()
+	execHelperMaxConcurrency = kingpin.Flag("collector.exec_helper.max-concurrency", "Maximum number of helper commands running at the same time.").Default("4").Int()
+)
+
+type execHelper struct {
+	name string
+	path string
+	args []string
+}
+
+type execHelperCollector struct {
+	helpers []execHelper
+	timeout time.Duration
+	sem     chan struct{}
+
+	success     typedDesc
+	duration    typedDesc
+	outputBytes typedDesc
+	logger      log.Logger
+}
+
+func init() {
+	registerCollector("exec_helper", defaultDisabled, NewExecHelperCollector)
+}
+
+// NewExecHelperCollector returns a new Collector exposing metrics printed by
+// external helper commands.
+func NewExecHelperCollector(logger log.Logger) (Collector, error) {
+	helpers, err := parseExecHelpers(*execHelperCommands)
+	if err != nil {
+		return nil, err
+	}
+	if *execHelperMaxConcurrency < 1 {
+		return nil, fmt.Errorf("invalid exec_helper max concurrency %d", *execHelperMaxConcurrency)
+	}
+
+	const subsystem = "exec_helper"
+	return &execHelperCollector{
+		helpers: helpers,
+		timeout: *execHelperTimeout,
+		sem:     make(chan struct{}, *execHelperMaxConcurrency),
+		success: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "success"),
+			"Whether the helper command exited successfully and its output could be parsed.",
+			[]string{"helper"}, nil,
+		), prometheus.GaugeValue},
+		duration: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "duration_seconds"),
+			"Duration of the helper command execution.",
+			[]string{"helper"}, nil,
+		), prometheus.GaugeValue},
+		outputBytes: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "output_bytes"),
+			"Size of the standard output of the helper command.",
+			[]string{"helper"}, nil,
+		), prometheus.GaugeValue},
+		logger: logger,
+	}, nil
+}
+
+// parseExecHelpers splits the configured command lines into executables and
+// arguments. Helpers are identified by the base name of their executable,
+// which therefore has to be unique.
+func parseExecHelpers(commands []string) ([]execHelper, error) {
+	helpers := make([]execHelper, 0, len(commands))
+	seen := map[string]bool{}
+	for _, command := range commands {
+		fields := strings.Fields(command)
+		if len(fields) == 0 {
+			return nil, fmt.Errorf("empty exec_helper command")
+		}
+		name := filepath.Base(fields[0])
+		if seen[name] {
+			return nil, fmt.Errorf("duplicate exec_helper command name %q", name)
+		}
+		seen[name] = true
+		helpers = append(helpers, execHelper{
+			name: name,
+			path: fields[0],
+			args: fields[1:],
+		})
+	}
+	return helpers, nil
+}
+
+// Update implements the Collector interface.
+func (c *execHelperCollector) Update(ch chan<- prometheus.Metric) error {
+	if len(c.helpers) == 0 {
+		return ErrNoData
+	}
+
+	wg := sync.WaitGroup{}
+	wg.Add(len(c.helpers))
+	for _, h := range c.helpers {
+		go func(h execHelper) {
+			defer wg.Done()
+			c.sem <- struct{}{}
+			defer func() { <-c.sem }()
+			c.runHelper(h, ch)
+		}(h)
+	}
+	wg.Wait()
+
+	return nil
+}
+
+// runHelper executes a single helper and exports its metrics together with
+// metrics about the execution itself. Failures of one helper are logged and
+// reported through node_exec_helper_success without failing the collector.
+func (c *execHelperCollector) runHelper(h execHelper, ch chan<- prometheus.Metric) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(h.path, h.args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	begin := time.Now()
+	err := startHelperProcess(cmd)
+	if err == nil {
+		timer := time.AfterFunc(c.timeout, func() {
+			killHelperProcess(cmd)
+		})
+		err = cmd.Wait()
+		if !timer.Stop() {
+			err = fmt.Errorf("timed out after %s", c.timeout)
+		}
+	}
+	duration := time.Since(begin)
+
+	if err == nil {
+		err = c.processOutput(h, stdout.Bytes(), ch)
+	}
+
+	var success float64
+	if err != nil {
+		level.Error(c.logger).Log("msg", "helper command failed", "helper", h.name, "err", err, "stderr", strings.TrimSpace(stderr.String()))
+	} else {
+		success = 1
+	}
+
+	ch <- c.success.mustNewConstMetric(success, h.name)
+	ch <- c.duration.mustNewConstMetric(duration.Seconds(), h.name)
+	ch <- c.outputBytes.mustNewConstMetric(float64(stdout.Len()), h.name)
+}
+
+// processOutput parses the output of a helper and converts it the same way
+// the textfile collector converts its files.
+func (c *execHelperCollector) processOutput(h execHelper, output []byte, ch chan<- prometheus.Metric) error {
+	var parser expfmt.TextParser
+	families, err := parser.TextToMetricFamilies(bytes.NewReader(output))
+	if err != nil {
+		return fmt.Errorf("failed to parse output: %w", err)
+	}
+
+	if hasTimestamps(families) {
+		return fmt.Errorf("output contains unsupported client-side timestamps")
+	}
+
+	for _, mf := range families {
+		if mf.Help == nil {
+			help := fmt.Sprintf("Metric read from helper %s", h.name)
+			mf.Help = &help
+		}
+		convertMetricFamily(mf, ch, c.logger)
+	}
+	return nil
+}
@@ -0,0 +1,112 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noexec_helper && !notextfile
+// +build !noexec_helper,!notextfile
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestExecHelperCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{
+		"--collector.exec_helper.command", "fixtures/exec_helper/raid.sh",
+		"--collector.exec_helper.command", "fixtures/exec_helper/broken.sh",
+		"--collector.exec_helper.command", "fixtures/exec_helper/failing.sh --verbose",
+		"--collector.exec_helper.command", "fixtures/exec_helper/slow.sh",
+		"--collector.exec_helper.command", "fixtures/exec_helper/wrapper.sh",
+		"--collector.exec_helper.timeout", "200ms",
+		"--collector.exec_helper.max-concurrency", "2",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		*execHelperCommands = nil
+	}()
+
+	c, err := NewExecHelperCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `# HELP node_exec_helper_output_bytes Size of the standard output of the helper command.
+# TYPE node_exec_helper_output_bytes gauge
+node_exec_helper_output_bytes{helper="broken.sh"} 15
+node_exec_helper_output_bytes{helper="failing.sh"} 10
+node_exec_helper_output_bytes{helper="raid.sh"} 212
+node_exec_helper_output_bytes{helper="slow.sh"} 0
+node_exec_helper_output_bytes{helper="wrapper.sh"} 0
+# HELP node_exec_helper_success Whether the helper command exited successfully and its output could be parsed.
+# TYPE node_exec_helper_success gauge
+node_exec_helper_success{helper="broken.sh"} 0
+node_exec_helper_success{helper="failing.sh"} 0
+node_exec_helper_success{helper="raid.sh"} 1
+node_exec_helper_success{helper="slow.sh"} 0
+node_exec_helper_success{helper="wrapper.sh"} 0
+# HELP raid_controller_status Controller status reported by the vendor CLI.
+# TYPE raid_controller_status gauge
+raid_controller_status{controller="0"} 1
+# HELP raid_physical_disk_errors_total Metric read from helper raid.sh
+# TYPE raid_physical_disk_errors_total untyped
+raid_physical_disk_errors_total{controller="0",slot="1"} 3
+`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+
+	begin := time.Now()
+	err = testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"node_exec_helper_output_bytes",
+		"node_exec_helper_success",
+		"raid_controller_status",
+		"raid_physical_disk_errors_total",
+		"ipmi_up",
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := time.Since(begin); d > 5*time.Second {
+		t.Errorf("slow helpers were not killed after timeout, collection took %s", d)
+	}
+}
+
+func TestParseExecHelpers(t *testing.T) {
+	helpers, err := parseExecHelpers([]string{"/usr/local/bin/raid-status -a 0"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(helpers) != 1 {
+		t.Fatalf("expected 1 helper, got %d", len(helpers))
+	}
+	if want, got := "raid-status", helpers[0].name; want != got {
+		t.Errorf("want name %q, got %q", want, got)
+	}
+	if want, got := "-a 0", strings.Join(helpers[0].args, " "); want != got {
+		t.Errorf("want args %q, got %q", want, got)
+	}
+
+	if _, err := parseExecHelpers([]string{"/a/ipmi", "/b/ipmi"}); err == nil {
+		t.Error("expected error for duplicate helper names")
+	}
+	if _, err := parseExecHelpers([]string{"  "}); err == nil {
+		t.Error("expected error for empty helper command")
+	}
+}
@@ -0,0 +1,34 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noexec_helper && !notextfile && !windows
+// +build !noexec_helper,!notextfile,!windows
+
+package collector
+
+import (
+	"os/exec"
+	"syscall"
+)
+
+// startHelperProcess starts a helper in its own process group, so that its
+// children, which may keep its output open, can be killed with it.
+func startHelperProcess(cmd *exec.Cmd) error {
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+	return cmd.Start()
+}
+
+// killHelperProcess kills the process group of a helper.
+func killHelperProcess(cmd *exec.Cmd) {
+	syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+}
@@ -0,0 +1,32 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noexec_helper && !notextfile
+// +build !noexec_helper,!notextfile
+
+package collector
+
+import (
+	"os/exec"
+)
+
+// startHelperProcess starts a helper. Windows has no process groups, so
+// children of a helper survive its timeout.
+func startHelperProcess(cmd *exec.Cmd) error {
+	return cmd.Start()
+}
+
+// killHelperProcess kills a helper.
+func killHelperProcess(cmd *exec.Cmd) {
+	cmd.Process.Kill()
+}
@@ -0,0 +1,151 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nofirmware && !noethtool
+// +build !nofirmware,!noethtool
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/safchain/ethtool"
+)
+
+type firmwareCollector struct {
+	ethtool     Ethtool
+	diskInfo    typedDesc
+	networkInfo typedDesc
+	logger      log.Logger
+}
+
+func init() {
+	registerCollector("firmware", defaultDisabled, NewFirmwareCollector)
+}
+
+// NewFirmwareCollector returns a new Collector exposing the firmware versions
+// of disks and network interfaces.
+func NewFirmwareCollector(logger log.Logger) (Collector, error) {
+	c := &firmwareCollector{
+		diskInfo: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "firmware", "disk_info"),
+			"A metric with a constant '1' value labeled by device, vendor, model and firmware_version of a disk.",
+			[]string{"device", "vendor", "model", "firmware_version"}, nil,
+		), prometheus.GaugeValue},
+		networkInfo: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "firmware", "network_info"),
+			"A metric with a constant '1' value labeled by device, bus_info, driver and firmware_version of a network interface.",
+			[]string{"device", "bus_info", "driver", "firmware_version"}, nil,
+		), prometheus.GaugeValue},
+		logger: logger,
+	}
+
+	e, err := ethtool.NewEthtool()
+	if err != nil {
+		level.Debug(logger).Log("msg", "Not collecting network interface firmware, failed to initialize ethtool library", "err", err)
+	} else {
+		c.ethtool = &ethtoolLibrary{e}
+	}
+	return c, nil
+}
+
+// Update implements Collector.
+func (c *firmwareCollector) Update(ch chan<- prometheus.Metric) error {
+	if err := c.updateDisks(ch); err != nil {
+		return err
+	}
+	if c.ethtool != nil {
+		return c.updateNetwork(ch)
+	}
+	return nil
+}
+
+func (c *firmwareCollector) updateDisks(ch chan<- prometheus.Metric) error {
+	root := sysFilePath("block")
+	devices, err := ioutil.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "Not collecting disk firmware, directory does not exist", "path", root)
+			return nil
+		}
+		return fmt.Errorf("failed to read block devices: %w", err)
+	}
+
+	for _, device := range devices {
+		path := filepath.Join(root, device.Name(), "device")
+		// SCSI and ATA disks expose the firmware revision as rev, NVMe
+		// controllers as firmware_rev. Virtual devices have neither.
+		revision, err := readFirmwareAttribute(path, "rev")
+		if errors.Is(err, os.ErrNotExist) {
+			revision, err = readFirmwareAttribute(path, "firmware_rev")
+		}
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		vendor, err := readFirmwareAttribute(path, "vendor")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		model, err := readFirmwareAttribute(path, "model")
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		ch <- c.diskInfo.mustNewConstMetric(1.0, device.Name(), vendor, model, revision)
+	}
+	return nil
+}
+
+func (c *firmwareCollector) updateNetwork(ch chan<- prometheus.Metric) error {
+	root := sysFilePath("class/net")
+	devices, err := ioutil.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "Not collecting network interface firmware, directory does not exist", "path", root)
+			return nil
+		}
+		return fmt.Errorf("failed to read network interfaces: %w", err)
+	}
+
+	for _, device := range devices {
+		// Only physical interfaces have a device and firmware.
+		if _, err := os.Stat(filepath.Join(root, device.Name(), "device")); err != nil {
+			continue
+		}
+		info, err := c.ethtool.DriverInfo(device.Name())
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "ethtool driver info error", "device", device.Name(), "err", err)
+			continue
+		}
+		ch <- c.networkInfo.mustNewConstMetric(1.0, device.Name(), info.BusInfo, info.Driver, info.FwVersion)
+	}
+	return nil
+}
+
+func readFirmwareAttribute(path, name string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(path, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.ToValidUTF8(strings.TrimSpace(string(data)), "�"), nil
+}
@@ -0,0 +1,53 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nofirmware && !noethtool
+// +build !nofirmware,!noethtool
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+func TestFirmwareCollector(t *testing.T) {
+	if _, err := kingpin.CommandLine.Parse([]string{"--path.sysfs", "fixtures/sys"}); err != nil {
+		t.Fatal(err)
+	}
+
+	c, err := NewFirmwareCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.(*firmwareCollector).ethtool = &EthtoolFixture{fixturePath: "fixtures/ethtool/"}
+
+	want := `# HELP node_firmware_disk_info A metric with a constant '1' value labeled by device, vendor, model and firmware_version of a disk.
+# TYPE node_firmware_disk_info gauge
+node_firmware_disk_info{device="nvme0n1",firmware_version="1B2QEXP7",model="Samsung SSD 970 PRO 512GB",vendor=""} 1
+node_firmware_disk_info{device="sda",firmware_version="4B6Q",model="Samsung SSD 860",vendor="ATA"} 1
+# HELP node_firmware_network_info A metric with a constant '1' value labeled by device, bus_info, driver and firmware_version of a network interface.
+# TYPE node_firmware_network_info gauge
+node_firmware_network_info{bus_info="0000:00:1f.6",device="eth0",driver="e1000e",firmware_version="0.5-4"} 1
+`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,4 @@
+#!/bin/sh
+echo "ipmi_up 1"
+echo "ipmitool: no such device" >&2
+exit 1
@@ -0,0 +1,7 @@
+#!/bin/sh
+cat <<METRICS
+# HELP raid_controller_status Controller status reported by the vendor CLI.
+# TYPE raid_controller_status gauge
+raid_controller_status{controller="0"} 1
+raid_physical_disk_errors_total{controller="0",slot="1"} 3
+METRICS
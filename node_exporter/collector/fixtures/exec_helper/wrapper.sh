@@ -0,0 +1,4 @@
+#!/bin/sh
+# The child keeps the output open after the script is killed.
+sleep 10 &
+wait
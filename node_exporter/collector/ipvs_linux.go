@@ -17,8 +17,12 @@
 package collector
 
 import (
+	"bufio"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"io"
+	"net"
 	"os"
 	"sort"
 	"strconv"
@@ -36,6 +40,8 @@ type ipvsCollector struct {
 	fs                                                                          procfs.FS
 	backendLabels                                                               []string
 	backendConnectionsActive, backendConnectionsInact, backendWeight            typedDesc
+	backendInfo, backendHealthy                                                 typedDesc
+	serviceInfo, serviceBackends, serviceBackendsDrained                        typedDesc
 	connections, incomingPackets, outgoingPackets, incomingBytes, outgoingBytes typedDesc
 	logger                                                                      log.Logger
 }
@@ -46,6 +52,26 @@ type ipvsBackendStatus struct {
 	Weight     uint64
 }
 
+// ipvsService is a virtual service with its scheduler and real servers, as
+// listed in /proc/net/ip_vs. procfs does not expose the scheduler and
+// forwarding method.
+type ipvsService struct {
+	Proto        string
+	LocalAddress net.IP
+	LocalPort    uint16
+	LocalMark    string
+	Scheduler    string
+	Flags        string
+	Backends     []ipvsRealServer
+}
+
+type ipvsRealServer struct {
+	RemoteAddress net.IP
+	RemotePort    uint16
+	Forward       string
+	Weight        uint64
+}
+
 const (
 	ipvsLabelLocalAddress  = "local_address"
 	ipvsLabelLocalPort     = "local_port"
@@ -55,6 +81,10 @@ const (
 	ipvsLabelLocalMark     = "local_mark"
 )
 
+// ipvsServiceLabels identify a virtual service, a firewall mark service has an
+// empty address and port 0.
+var ipvsServiceLabels = []string{ipvsLabelLocalAddress, ipvsLabelLocalPort, ipvsLabelProto, ipvsLabelLocalMark}
+
 var (
 	fullIpvsBackendLabels = []string{
 		ipvsLabelLocalAddress,
@@ -134,6 +164,31 @@ func newIPVSCollector(logger log.Logger) (*ipvsCollector, error) {
 		"The current backend weight by local and remote address.",
 		c.backendLabels, nil,
 	), prometheus.GaugeValue}
+	c.backendInfo = typedDesc{prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "backend_info"),
+		"A metric with a constant '1' value labeled by the forwarding method of the backend.",
+		append(append([]string{}, c.backendLabels...), "forwarding_method"), nil,
+	), prometheus.GaugeValue}
+	c.backendHealthy = typedDesc{prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "backend_healthy"),
+		"Whether the backend receives new connections, 0 if it was drained by setting its weight to 0.",
+		c.backendLabels, nil,
+	), prometheus.GaugeValue}
+	c.serviceInfo = typedDesc{prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "service_info"),
+		"A metric with a constant '1' value labeled by the scheduler and flags of the virtual service.",
+		append(append([]string{}, ipvsServiceLabels...), "scheduler", "flags"), nil,
+	), prometheus.GaugeValue}
+	c.serviceBackends = typedDesc{prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "service_backends"),
+		"The number of backends of the virtual service.",
+		ipvsServiceLabels, nil,
+	), prometheus.GaugeValue}
+	c.serviceBackendsDrained = typedDesc{prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, subsystem, "service_backends_drained"),
+		"The number of backends of the virtual service with weight 0.",
+		ipvsServiceLabels, nil,
+	), prometheus.GaugeValue}
 
 	return &c, nil
 }
@@ -162,29 +217,7 @@ func (c *ipvsCollector) Update(ch chan<- prometheus.Metric) error {
 	sums := map[string]ipvsBackendStatus{}
 	labelValues := map[string][]string{}
 	for _, backend := range backendStats {
-		localAddress := ""
-		if backend.LocalAddress.String() != "<nil>" {
-			localAddress = backend.LocalAddress.String()
-		}
-		kv := make([]string, len(c.backendLabels))
-		for i, label := range c.backendLabels {
-			var labelValue string
-			switch label {
-			case ipvsLabelLocalAddress:
-				labelValue = localAddress
-			case ipvsLabelLocalPort:
-				labelValue = strconv.FormatUint(uint64(backend.LocalPort), 10)
-			case ipvsLabelRemoteAddress:
-				labelValue = backend.RemoteAddress.String()
-			case ipvsLabelRemotePort:
-				labelValue = strconv.FormatUint(uint64(backend.RemotePort), 10)
-			case ipvsLabelProto:
-				labelValue = backend.Proto
-			case ipvsLabelLocalMark:
-				labelValue = backend.LocalMark
-			}
-			kv[i] = labelValue
-		}
+		kv := c.backendLabelValues(backend.LocalAddress, backend.LocalPort, backend.RemoteAddress, backend.RemotePort, backend.Proto, backend.LocalMark)
 		key := strings.Join(kv, "-")
 		status := sums[key]
 		status.ActiveConn += backend.ActiveConn
@@ -199,9 +232,180 @@ func (c *ipvsCollector) Update(ch chan<- prometheus.Metric) error {
 		ch <- c.backendConnectionsInact.mustNewConstMetric(float64(status.InactConn), kv...)
 		ch <- c.backendWeight.mustNewConstMetric(float64(status.Weight), kv...)
 	}
+
+	services, err := readIPVSServices(procFilePath("net/ip_vs"))
+	if err != nil {
+		return fmt.Errorf("could not get IPVS services: %w", err)
+	}
+	return c.updateServices(ch, services)
+}
+
+// updateServices exports the scheduler of each virtual service and the
+// forwarding method and drain state of its backends. Backends are aggregated
+// by the configured backend labels like the connection counts, so a
+// backend is only reported as drained if all aggregated backends are.
+func (c *ipvsCollector) updateServices(ch chan<- prometheus.Metric, services []ipvsService) error {
+	weights := map[string]uint64{}
+	methods := map[string]map[string]struct{}{}
+	labelValues := map[string][]string{}
+	for _, svc := range services {
+		serviceValues := []string{"", strconv.FormatUint(uint64(svc.LocalPort), 10), svc.Proto, svc.LocalMark}
+		if svc.LocalAddress != nil {
+			serviceValues[0] = svc.LocalAddress.String()
+		}
+		ch <- c.serviceInfo.mustNewConstMetric(1, append(serviceValues, svc.Scheduler, svc.Flags)...)
+
+		var drained int
+		for _, backend := range svc.Backends {
+			if backend.Weight == 0 {
+				drained++
+			}
+			kv := c.backendLabelValues(svc.LocalAddress, svc.LocalPort, backend.RemoteAddress, backend.RemotePort, svc.Proto, svc.LocalMark)
+			key := strings.Join(kv, "-")
+			weights[key] += backend.Weight
+			if methods[key] == nil {
+				methods[key] = map[string]struct{}{}
+			}
+			methods[key][backend.Forward] = struct{}{}
+			labelValues[key] = kv
+		}
+		ch <- c.serviceBackends.mustNewConstMetric(float64(len(svc.Backends)), serviceValues...)
+		ch <- c.serviceBackendsDrained.mustNewConstMetric(float64(drained), serviceValues...)
+	}
+
+	for key, weight := range weights {
+		kv := labelValues[key]
+		var healthy float64
+		if weight > 0 {
+			healthy = 1
+		}
+		ch <- c.backendHealthy.mustNewConstMetric(healthy, kv...)
+		for method := range methods[key] {
+			ch <- c.backendInfo.mustNewConstMetric(1, append(kv, method)...)
+		}
+	}
 	return nil
 }
 
+// backendLabelValues returns the values of the configured backend labels.
+func (c *ipvsCollector) backendLabelValues(localAddress net.IP, localPort uint16, remoteAddress net.IP, remotePort uint16, proto, localMark string) []string {
+	kv := make([]string, len(c.backendLabels))
+	for i, label := range c.backendLabels {
+		var labelValue string
+		switch label {
+		case ipvsLabelLocalAddress:
+			if localAddress != nil {
+				labelValue = localAddress.String()
+			}
+		case ipvsLabelLocalPort:
+			labelValue = strconv.FormatUint(uint64(localPort), 10)
+		case ipvsLabelRemoteAddress:
+			labelValue = remoteAddress.String()
+		case ipvsLabelRemotePort:
+			labelValue = strconv.FormatUint(uint64(remotePort), 10)
+		case ipvsLabelProto:
+			labelValue = proto
+		case ipvsLabelLocalMark:
+			labelValue = localMark
+		}
+		kv[i] = labelValue
+	}
+	return kv
+}
+
+// readIPVSServices parses the virtual services and their real servers from
+// /proc/net/ip_vs.
+func readIPVSServices(path string) ([]ipvsService, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return parseIPVSServices(f)
+}
+
+func parseIPVSServices(r io.Reader) ([]ipvsService, error) {
+	var services []ipvsService
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 {
+			continue
+		}
+		switch fields[0] {
+		case "TCP", "UDP", "SCTP":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("invalid IPVS service line: %q", scanner.Text())
+			}
+			ip, port, err := parseIPVSAddress(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			services = append(services, ipvsService{
+				Proto:        fields[0],
+				LocalAddress: ip,
+				LocalPort:    port,
+				Scheduler:    fields[2],
+				Flags:        strings.Join(fields[3:], " "),
+			})
+		case "FWM":
+			if len(fields) < 3 {
+				return nil, fmt.Errorf("invalid IPVS service line: %q", scanner.Text())
+			}
+			services = append(services, ipvsService{
+				Proto:     fields[0],
+				LocalMark: fields[1],
+				Scheduler: fields[2],
+				Flags:     strings.Join(fields[3:], " "),
+			})
+		case "->":
+			if len(fields) < 6 || len(services) == 0 {
+				// The header line, or a real server without service.
+				continue
+			}
+			ip, port, err := parseIPVSAddress(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			weight, err := strconv.ParseUint(fields[3], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid IPVS weight %q: %w", fields[3], err)
+			}
+			svc := &services[len(services)-1]
+			svc.Backends = append(svc.Backends, ipvsRealServer{
+				RemoteAddress: ip,
+				RemotePort:    port,
+				Forward:       strings.ToLower(fields[2]),
+				Weight:        weight,
+			})
+		}
+	}
+	return services, scanner.Err()
+}
+
+// parseIPVSAddress parses an address like C0A80016:0CEA for IPv4 or
+// [2620:0000:0abc:0000:0000:0000:0000:0001]:0050 for IPv6.
+func parseIPVSAddress(s string) (net.IP, uint16, error) {
+	i := strings.LastIndex(s, ":")
+	if i < 0 {
+		return nil, 0, fmt.Errorf("invalid IPVS address %q", s)
+	}
+	var ip net.IP
+	if strings.HasPrefix(s, "[") {
+		ip = net.ParseIP(strings.Trim(s[:i], "[]"))
+	} else if b, err := hex.DecodeString(s[:i]); err == nil && len(b) == net.IPv4len {
+		ip = net.IP(b)
+	}
+	if ip == nil {
+		return nil, 0, fmt.Errorf("invalid IPVS address %q", s)
+	}
+	port, err := strconv.ParseUint(s[i+1:], 16, 16)
+	if err != nil {
+		return nil, 0, fmt.Errorf("invalid IPVS port in %q: %w", s, err)
+	}
+	return ip, uint16(port), nil
+}
+
 func (c *ipvsCollector) parseIpvsLabels(labelString string) ([]string, error) {
 	labels := strings.Split(labelString, ",")
 	labelSet := make(map[string]bool, len(labels))
@@ -219,3 +219,37 @@ func TestIPVSCollectorResponse(t *testing.T) {
 		})
 	}
 }
+
+func TestParseIPVSServices(t *testing.T) {
+	services, err := parseIPVSServices(strings.NewReader(`IP Virtual Server version 1.2.1 (size=4096)
+Prot LocalAddress:Port Scheduler Flags
+  -> RemoteAddress:Port Forward Weight ActiveConn InActConn
+TCP  [2620:0000:0abc:0000:0000:0000:0000:0001]:0050 sh persistent 360
+  -> [2620:0000:0abc:0000:0000:0000:0000:0002]:0050 Route   1      0          0
+  -> [2620:0000:0abc:0000:0000:0000:0000:0003]:0050 Route   0      2          0
+FWM  00000064 rr
+  -> C0A80A01:0000      Masq    5      10         3
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(services) != 2 {
+		t.Fatalf("want 2 services, got %d", len(services))
+	}
+
+	svc := services[0]
+	if svc.LocalAddress.String() != "2620:0:abc::1" || svc.LocalPort != 80 || svc.Scheduler != "sh" || svc.Flags != "persistent 360" {
+		t.Errorf("unexpected service %+v", svc)
+	}
+	if len(svc.Backends) != 2 || svc.Backends[1].Weight != 0 || svc.Backends[1].Forward != "route" {
+		t.Errorf("unexpected backends %+v", svc.Backends)
+	}
+
+	svc = services[1]
+	if svc.Proto != "FWM" || svc.LocalMark != "00000064" || svc.LocalAddress != nil || svc.Scheduler != "rr" {
+		t.Errorf("unexpected service %+v", svc)
+	}
+	if len(svc.Backends) != 1 || svc.Backends[0].RemoteAddress.String() != "192.168.10.1" || svc.Backends[0].Forward != "masq" || svc.Backends[0].Weight != 5 {
+		t.Errorf("unexpected backends %+v", svc.Backends)
+	}
+}
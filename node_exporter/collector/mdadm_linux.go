@@ -19,7 +19,11 @@ package collector
 import (
 	"errors"
 	"fmt"
+	"io/ioutil"
 	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
@@ -99,6 +103,55 @@ var (
 		[]string{"device"},
 		nil,
 	)
+
+	memberStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "md", "member_state"),
+		"Indicates whether a state flag is set on a member disk of md-device.",
+		[]string{"device", "member", "state"},
+		nil,
+	)
+
+	memberInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "md", "member_info"),
+		"A metric with a constant '1' value labeled by the role of a member disk of md-device: active, rebuilding, spare, faulty or journal.",
+		[]string{"device", "member", "role"},
+		nil,
+	)
+
+	syncActionDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "md", "sync_action"),
+		"Indicates the current sync action of md-device.",
+		[]string{"device", "action"},
+		nil,
+	)
+
+	syncSpeedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "md", "sync_speed_bytes_per_second"),
+		"Current speed of the sync action of md-device.",
+		[]string{"device"},
+		nil,
+	)
+
+	syncETADesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "md", "sync_eta_seconds"),
+		"Estimated time until the current sync action of md-device completes.",
+		[]string{"device"},
+		nil,
+	)
+
+	mismatchDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "md", "mismatch_sectors"),
+		"Number of sectors found to be out of sync by the last check or repair of md-device.",
+		[]string{"device"},
+		nil,
+	)
+
+	// mdMemberStates are the member disk state flags exported from
+	// /sys/block/mdX/md/dev-*/state.
+	mdMemberStates = []string{"faulty", "in_sync", "write_mostly", "blocked"}
+
+	// mdSyncActions are the possible values of /sys/block/mdX/md/sync_action.
+	mdSyncActions = []string{"idle", "resync", "recover", "check", "repair", "reshape", "frozen"}
 )
 
 func (c *mdadmCollector) Update(ch chan<- prometheus.Metric) error {
@@ -200,7 +253,151 @@ func (c *mdadmCollector) Update(ch chan<- prometheus.Metric) error {
 			float64(mdStat.BlocksSynced),
 			mdStat.Name,
 		)
+
+		metrics, err := mdSysfsMetrics(mdStat.Name)
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				level.Debug(c.logger).Log("msg", "Not collecting md sysfs metrics, directory does not exist", "device", mdStat.Name)
+			} else {
+				level.Warn(c.logger).Log("msg", "Not collecting md sysfs metrics, error reading attributes", "device", mdStat.Name, "err", err)
+			}
+			continue
+		}
+		for _, m := range metrics {
+			ch <- m
+		}
 	}
 
 	return nil
 }
+
+// mdSysfsMetrics returns the member disk states and sync progress of a
+// md-device from /sys/block/<device>/md. If an attribute can't be read, none
+// of the metrics of the device are returned.
+func mdSysfsMetrics(device string) ([]prometheus.Metric, error) {
+	var metrics []prometheus.Metric
+	path := sysFilePath(filepath.Join("block", device, "md"))
+	members, err := filepath.Glob(filepath.Join(path, "dev-*"))
+	if err != nil {
+		return nil, err
+	}
+	if len(members) == 0 {
+		if _, err := os.Stat(path); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, member := range members {
+		state, err := readMdAttribute(member, "state")
+		if err != nil {
+			return nil, err
+		}
+		slot, err := readMdAttribute(member, "slot")
+		if err != nil {
+			return nil, err
+		}
+
+		flags := make(map[string]bool)
+		for _, flag := range strings.Split(state, ",") {
+			flags[flag] = true
+		}
+		name := strings.TrimPrefix(filepath.Base(member), "dev-")
+		metrics = append(metrics, prometheus.MustNewConstMetric(memberInfoDesc, prometheus.GaugeValue, 1, device, name, mdMemberRole(flags, slot)))
+		for _, s := range mdMemberStates {
+			var value float64
+			if flags[s] {
+				value = 1
+			}
+			metrics = append(metrics, prometheus.MustNewConstMetric(memberStateDesc, prometheus.GaugeValue, value, device, name, s))
+		}
+	}
+
+	action, err := readMdAttribute(path, "sync_action")
+	if errors.Is(err, os.ErrNotExist) {
+		// Arrays without redundancy (raid0, linear) have no sync attributes.
+		return metrics, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	for _, a := range mdSyncActions {
+		var value float64
+		if a == action {
+			value = 1
+		}
+		metrics = append(metrics, prometheus.MustNewConstMetric(syncActionDesc, prometheus.GaugeValue, value, device, a))
+	}
+
+	mismatch, err := readMdUintAttribute(path, "mismatch_cnt")
+	if err != nil {
+		return nil, err
+	}
+	metrics = append(metrics, prometheus.MustNewConstMetric(mismatchDesc, prometheus.GaugeValue, float64(mismatch), device))
+
+	// sync_speed is in KiB/s, sync_completed in sectors, both are "none" if
+	// no sync action is running.
+	var speed float64
+	if value, err := readMdAttribute(path, "sync_speed"); err != nil {
+		return nil, err
+	} else if value != "none" {
+		kib, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid sync_speed %q: %w", value, err)
+		}
+		speed = float64(kib) * 1024
+	}
+	metrics = append(metrics, prometheus.MustNewConstMetric(syncSpeedDesc, prometheus.GaugeValue, speed, device))
+
+	completed, err := readMdAttribute(path, "sync_completed")
+	if err != nil {
+		return nil, err
+	}
+	if completed == "none" || speed == 0 {
+		return metrics, nil
+	}
+	var done, total uint64
+	if _, err := fmt.Sscanf(completed, "%d / %d", &done, &total); err != nil {
+		return nil, fmt.Errorf("invalid sync_completed %q: %w", completed, err)
+	}
+	if total >= done {
+		metrics = append(metrics, prometheus.MustNewConstMetric(syncETADesc, prometheus.GaugeValue, float64(total-done)*512/speed, device))
+	}
+	return metrics, nil
+}
+
+// mdMemberRole returns the role of a member disk like mdadm --detail does,
+// based on its state flags and slot.
+func mdMemberRole(flags map[string]bool, slot string) string {
+	switch {
+	case flags["faulty"]:
+		return "faulty"
+	case flags["journal"]:
+		return "journal"
+	case slot == "none":
+		return "spare"
+	case flags["in_sync"]:
+		return "active"
+	default:
+		return "rebuilding"
+	}
+}
+
+func readMdAttribute(path, name string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(path, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func readMdUintAttribute(path, name string) (uint64, error) {
+	value, err := readMdAttribute(path, name)
+	if err != nil {
+		return 0, err
+	}
+	v, err := strconv.ParseUint(value, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", name, value, err)
+	}
+	return v, nil
+}
@@ -0,0 +1,179 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nomdadm
+// +build !nomdadm
+
+package collector
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// mdSysfsTestCollector exposes the sysfs metrics of a single md-device.
+type mdSysfsTestCollector string
+
+func (c mdSysfsTestCollector) Update(ch chan<- prometheus.Metric) error {
+	metrics, err := mdSysfsMetrics(string(c))
+	for _, m := range metrics {
+		ch <- m
+	}
+	return err
+}
+
+func TestMdSysfsMetrics(t *testing.T) {
+	defer func(path string) { *sysPath = path }(*sysPath)
+	*sysPath = "fixtures/sys"
+
+	tests := []struct {
+		device  string
+		metrics []string
+		want    string
+	}{
+		{
+			// A check with a blocked member and mismatches.
+			device: "md201",
+			want: `# HELP node_md_member_info A metric with a constant '1' value labeled by the role of a member disk of md-device: active, rebuilding, spare, faulty or journal.
+# TYPE node_md_member_info gauge
+node_md_member_info{device="md201",member="sda3",role="active"} 1
+node_md_member_info{device="md201",member="sdb3",role="active"} 1
+# HELP node_md_member_state Indicates whether a state flag is set on a member disk of md-device.
+# TYPE node_md_member_state gauge
+node_md_member_state{device="md201",member="sda3",state="blocked"} 0
+node_md_member_state{device="md201",member="sda3",state="faulty"} 0
+node_md_member_state{device="md201",member="sda3",state="in_sync"} 1
+node_md_member_state{device="md201",member="sda3",state="write_mostly"} 0
+node_md_member_state{device="md201",member="sdb3",state="blocked"} 1
+node_md_member_state{device="md201",member="sdb3",state="faulty"} 0
+node_md_member_state{device="md201",member="sdb3",state="in_sync"} 1
+node_md_member_state{device="md201",member="sdb3",state="write_mostly"} 0
+# HELP node_md_mismatch_sectors Number of sectors found to be out of sync by the last check or repair of md-device.
+# TYPE node_md_mismatch_sectors gauge
+node_md_mismatch_sectors{device="md201"} 16
+# HELP node_md_sync_action Indicates the current sync action of md-device.
+# TYPE node_md_sync_action gauge
+node_md_sync_action{action="check",device="md201"} 1
+node_md_sync_action{action="frozen",device="md201"} 0
+node_md_sync_action{action="idle",device="md201"} 0
+node_md_sync_action{action="recover",device="md201"} 0
+node_md_sync_action{action="repair",device="md201"} 0
+node_md_sync_action{action="reshape",device="md201"} 0
+node_md_sync_action{action="resync",device="md201"} 0
+# HELP node_md_sync_eta_seconds Estimated time until the current sync action of md-device completes.
+# TYPE node_md_sync_eta_seconds gauge
+node_md_sync_eta_seconds{device="md201"} 16.46188340807175
+# HELP node_md_sync_speed_bytes_per_second Current speed of the sync action of md-device.
+# TYPE node_md_sync_speed_bytes_per_second gauge
+node_md_sync_speed_bytes_per_second{device="md201"} 1.16916224e+08
+`,
+		},
+		{
+			// An idle array has no sync ETA.
+			device:  "md3",
+			metrics: []string{"node_md_sync_action", "node_md_sync_eta_seconds", "node_md_sync_speed_bytes_per_second"},
+			want: `# HELP node_md_sync_action Indicates the current sync action of md-device.
+# TYPE node_md_sync_action gauge
+node_md_sync_action{action="check",device="md3"} 0
+node_md_sync_action{action="frozen",device="md3"} 0
+node_md_sync_action{action="idle",device="md3"} 1
+node_md_sync_action{action="recover",device="md3"} 0
+node_md_sync_action{action="repair",device="md3"} 0
+node_md_sync_action{action="reshape",device="md3"} 0
+node_md_sync_action{action="resync",device="md3"} 0
+# HELP node_md_sync_speed_bytes_per_second Current speed of the sync action of md-device.
+# TYPE node_md_sync_speed_bytes_per_second gauge
+node_md_sync_speed_bytes_per_second{device="md3"} 0
+`,
+		},
+		{
+			// A recovery onto a spare after a member failed.
+			device:  "md6",
+			metrics: []string{"node_md_member_info", "node_md_member_state", "node_md_sync_eta_seconds", "node_md_sync_speed_bytes_per_second"},
+			want: `# HELP node_md_member_info A metric with a constant '1' value labeled by the role of a member disk of md-device: active, rebuilding, spare, faulty or journal.
+# TYPE node_md_member_info gauge
+node_md_member_info{device="md6",member="sda2",role="active"} 1
+node_md_member_info{device="md6",member="sdb2",role="faulty"} 1
+node_md_member_info{device="md6",member="sdc",role="rebuilding"} 1
+# HELP node_md_member_state Indicates whether a state flag is set on a member disk of md-device.
+# TYPE node_md_member_state gauge
+node_md_member_state{device="md6",member="sda2",state="blocked"} 0
+node_md_member_state{device="md6",member="sda2",state="faulty"} 0
+node_md_member_state{device="md6",member="sda2",state="in_sync"} 1
+node_md_member_state{device="md6",member="sda2",state="write_mostly"} 0
+node_md_member_state{device="md6",member="sdb2",state="blocked"} 0
+node_md_member_state{device="md6",member="sdb2",state="faulty"} 1
+node_md_member_state{device="md6",member="sdb2",state="in_sync"} 0
+node_md_member_state{device="md6",member="sdb2",state="write_mostly"} 0
+node_md_member_state{device="md6",member="sdc",state="blocked"} 0
+node_md_member_state{device="md6",member="sdc",state="faulty"} 0
+node_md_member_state{device="md6",member="sdc",state="in_sync"} 0
+node_md_member_state{device="md6",member="sdc",state="write_mostly"} 0
+# HELP node_md_sync_eta_seconds Estimated time until the current sync action of md-device completes.
+# TYPE node_md_sync_eta_seconds gauge
+node_md_sync_eta_seconds{device="md6"} 687.2450930199436
+# HELP node_md_sync_speed_bytes_per_second Current speed of the sync action of md-device.
+# TYPE node_md_sync_speed_bytes_per_second gauge
+node_md_sync_speed_bytes_per_second{device="md6"} 2.66017792e+08
+`,
+		},
+	}
+	for _, tc := range tests {
+		t.Run(tc.device, func(t *testing.T) {
+			reg := prometheus.NewRegistry()
+			reg.MustRegister(collectorAdapter{mdSysfsTestCollector(tc.device)})
+			if err := testutil.GatherAndCompare(reg, strings.NewReader(tc.want), tc.metrics...); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestMdSysfsMetricsErrors(t *testing.T) {
+	dir, err := ioutil.TempDir("", "mdadm")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	md := filepath.Join(dir, "block", "md0", "md")
+	if err := os.MkdirAll(filepath.Join(md, "dev-sda1"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range map[string]string{
+		"dev-sda1/state": "in_sync",
+		"dev-sda1/slot":  "0",
+		"sync_action":    "resync",
+		"mismatch_cnt":   "0",
+		"sync_speed":     "fast",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(md, name), []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	defer func(path string) { *sysPath = path }(*sysPath)
+	*sysPath = dir
+
+	if metrics, err := mdSysfsMetrics("md0"); err == nil || len(metrics) > 0 {
+		t.Errorf("want error and no metrics for an invalid attribute, got %d metrics and error %v", len(metrics), err)
+	}
+	if _, err := mdSysfsMetrics("md1"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("want not exist error for a missing device, got %v", err)
+	}
+}
@@ -0,0 +1,180 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nomountstats
+// +build !nomountstats
+
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	mountStatsLatencyHistograms = kingpin.Flag("collector.mountstats.latency-histograms", "Expose histograms of the latency of NFS operations, built from the average latency between scrapes.").Default("false").Bool()
+	mountStatsLatencyBuckets    = kingpin.Flag("collector.mountstats.latency-buckets", "Comma-separated upper bounds in seconds of the buckets of the NFS operation latency histograms.").Default("0.0005,0.001,0.0025,0.005,0.01,0.025,0.05,0.1,0.25,0.5,1,2.5,5,10").String()
+)
+
+// nfsOperationIdentifier identifies an operation of an NFS mount.
+type nfsOperationIdentifier struct {
+	nfsDeviceIdentifier
+	Operation string
+}
+
+// nfsOperationLatency holds the last seen totals of an operation and the
+// histograms built from them.
+type nfsOperationLatency struct {
+	requests     uint64
+	responseMs   uint64
+	requestMs    uint64
+	responseHist latencyHistogram
+	requestHist  latencyHistogram
+}
+
+type latencyHistogram struct {
+	count uint64
+	// sumMs is kept in milliseconds, the kernel's unit, to not accumulate
+	// rounding errors.
+	sumMs   uint64
+	buckets []uint64
+}
+
+// observe adds n observations averaging to a total of totalMs.
+// buckets are cumulative.
+func (h *latencyHistogram) observe(bounds []float64, totalMs, n uint64) {
+	if h.buckets == nil {
+		h.buckets = make([]uint64, len(bounds))
+	}
+	h.count += n
+	h.sumMs += totalMs
+	value := float64(totalMs) / 1000 / float64(n)
+	for i, b := range bounds {
+		if value <= b {
+			h.buckets[i] += n
+		}
+	}
+}
+
+func (h *latencyHistogram) metric(desc *prometheus.Desc, bounds []float64, labelValues []string) prometheus.Metric {
+	buckets := make(map[float64]uint64, len(bounds))
+	for i, b := range bounds {
+		var n uint64
+		if h.buckets != nil {
+			n = h.buckets[i]
+		}
+		buckets[b] = n
+	}
+	return prometheus.MustNewConstHistogram(desc, h.count, float64(h.sumMs%float64Mantissa)/1000, buckets, labelValues...)
+}
+
+// mountStatsLatency builds histograms of the latency of NFS operations. The
+// kernel only accounts the total latency of all requests of an operation, so
+// every request between two scrapes is observed with the average latency of
+// the requests in that interval. The histograms' sums therefore match the
+// total latencies since the exporter started.
+type mountStatsLatency struct {
+	bounds       []float64
+	responseDesc *prometheus.Desc
+	requestDesc  *prometheus.Desc
+
+	mtx  sync.Mutex
+	ops  map[nfsOperationIdentifier]*nfsOperationLatency
+	seen map[nfsOperationIdentifier]bool
+}
+
+func newMountStatsLatency(subsystem string, opLabels []string, buckets string) (*mountStatsLatency, error) {
+	bounds, err := parseLatencyBuckets(buckets)
+	if err != nil {
+		return nil, err
+	}
+	return &mountStatsLatency{
+		bounds: bounds,
+		responseDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "operations_response_time_seconds"),
+			"Histogram of the average duration requests of a given operation took to get a reply back after being transmitted, per interval between scrapes.",
+			opLabels,
+			nil,
+		),
+		requestDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "operations_request_time_seconds"),
+			"Histogram of the average duration requests of a given operation took from being enqueued to being completely handled, per interval between scrapes.",
+			opLabels,
+			nil,
+		),
+		ops:  make(map[nfsOperationIdentifier]*nfsOperationLatency),
+		seen: make(map[nfsOperationIdentifier]bool),
+	}, nil
+}
+
+func parseLatencyBuckets(s string) ([]float64, error) {
+	var bounds []float64
+	for _, f := range strings.Split(s, ",") {
+		b, err := strconv.ParseFloat(strings.TrimSpace(f), 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid latency bucket %q: %w", f, err)
+		}
+		bounds = append(bounds, b)
+	}
+	if !sort.Float64sAreSorted(bounds) {
+		return nil, fmt.Errorf("latency buckets %q are not sorted", s)
+	}
+	return bounds, nil
+}
+
+// begin starts a scrape. Operations not updated until end are forgotten.
+func (l *mountStatsLatency) begin() {
+	l.mtx.Lock()
+	l.seen = make(map[nfsOperationIdentifier]bool, len(l.ops))
+}
+
+func (l *mountStatsLatency) end() {
+	for id := range l.ops {
+		if !l.seen[id] {
+			delete(l.ops, id)
+		}
+	}
+	l.mtx.Unlock()
+}
+
+// update observes the requests of an operation since the last scrape and
+// exposes its histograms.
+func (l *mountStatsLatency) update(ch chan<- prometheus.Metric, id nfsOperationIdentifier, op procfs.NFSOperationStats, labelValues []string) {
+	l.seen[id] = true
+	state, ok := l.ops[id]
+	if !ok {
+		state = &nfsOperationLatency{}
+		l.ops[id] = state
+	}
+	// Counters going backwards mean the filesystem was remounted.
+	if ok && op.Requests > state.requests &&
+		op.CumulativeTotalResponseMilliseconds >= state.responseMs &&
+		op.CumulativeTotalRequestMilliseconds >= state.requestMs {
+		n := op.Requests - state.requests
+		state.responseHist.observe(l.bounds, op.CumulativeTotalResponseMilliseconds-state.responseMs, n)
+		state.requestHist.observe(l.bounds, op.CumulativeTotalRequestMilliseconds-state.requestMs, n)
+	}
+	state.requests = op.Requests
+	state.responseMs = op.CumulativeTotalResponseMilliseconds
+	state.requestMs = op.CumulativeTotalRequestMilliseconds
+
+	ch <- state.responseHist.metric(l.responseDesc, l.bounds, labelValues)
+	ch <- state.requestHist.metric(l.requestDesc, l.bounds, labelValues)
+}
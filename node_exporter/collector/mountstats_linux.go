@@ -94,6 +94,9 @@ type mountStatsCollector struct {
 	NFSEventPNFSReadTotal            *prometheus.Desc
 	NFSEventPNFSWriteTotal           *prometheus.Desc
 
+	// latency is nil unless --collector.mountstats.latency-histograms is set.
+	latency *mountStatsLatency
+
 	proc procfs.Proc
 
 	logger log.Logger
@@ -132,6 +135,14 @@ func NewMountStatsCollector(logger log.Logger) (Collector, error) {
 		opLabels = []string{"export", "protocol", "mountaddr", "operation"}
 	)
 
+	var latency *mountStatsLatency
+	if *mountStatsLatencyHistograms {
+		latency, err = newMountStatsLatency(subsystem, opLabels, *mountStatsLatencyBuckets)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	return &mountStatsCollector{
 		NFSAgeSecondsTotal: prometheus.NewDesc(
 			prometheus.BuildFQName(namespace, subsystem, "age_seconds_total"),
@@ -504,8 +515,9 @@ func NewMountStatsCollector(logger log.Logger) (Collector, error) {
 			nil,
 		),
 
-		proc:   proc,
-		logger: logger,
+		latency: latency,
+		proc:    proc,
+		logger:  logger,
 	}, nil
 }
 
@@ -520,6 +532,11 @@ func (c *mountStatsCollector) Update(ch chan<- prometheus.Metric) error {
 		return fmt.Errorf("failed to parse mountinfo: %w", err)
 	}
 
+	if c.latency != nil {
+		c.latency.begin()
+		defer c.latency.end()
+	}
+
 	// store all seen nfsDeviceIdentifiers for deduplication
 	deviceList := make(map[nfsDeviceIdentifier]bool)
 
@@ -546,13 +563,14 @@ func (c *mountStatsCollector) Update(ch chan<- prometheus.Metric) error {
 		}
 
 		deviceList[deviceIdentifier] = true
-		c.updateNFSStats(ch, stats, m.Device, stats.Transport.Protocol, mountAddress)
+		c.updateNFSStats(ch, stats, deviceIdentifier)
 	}
 
 	return nil
 }
 
-func (c *mountStatsCollector) updateNFSStats(ch chan<- prometheus.Metric, s *procfs.MountStatsNFS, export, protocol, mountAddress string) {
+func (c *mountStatsCollector) updateNFSStats(ch chan<- prometheus.Metric, s *procfs.MountStatsNFS, id nfsDeviceIdentifier) {
+	export, protocol, mountAddress := id.Device, id.Protocol, id.MountAddress
 	labelValues := []string{export, protocol, mountAddress}
 	ch <- prometheus.MustNewConstMetric(
 		c.NFSAgeSecondsTotal,
@@ -745,6 +763,10 @@ func (c *mountStatsCollector) updateNFSStats(ch chan<- prometheus.Metric, s *pro
 			float64(op.CumulativeTotalRequestMilliseconds%float64Mantissa)/1000.0,
 			opLabelValues...,
 		)
+
+		if c.latency != nil {
+			c.latency.update(ch, nfsOperationIdentifier{id, op.Operation}, op, opLabelValues)
+		}
 	}
 
 	ch <- prometheus.MustNewConstMetric(
@@ -0,0 +1,200 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nomountstats
+// +build !nomountstats
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/procfs"
+)
+
+// mountStatsLatencyTestCollector feeds the next set of operations to a
+// mountStatsLatency on every scrape.
+type mountStatsLatencyTestCollector struct {
+	latency *mountStatsLatency
+	scrapes [][]procfs.NFSOperationStats
+}
+
+func (c *mountStatsLatencyTestCollector) Update(ch chan<- prometheus.Metric) error {
+	id := nfsDeviceIdentifier{"192.168.1.1:/srv/test", "tcp", "192.168.1.1"}
+	ops := c.scrapes[0]
+	c.scrapes = c.scrapes[1:]
+
+	c.latency.begin()
+	defer c.latency.end()
+	for _, op := range ops {
+		labelValues := []string{id.Device, id.Protocol, id.MountAddress, op.Operation}
+		c.latency.update(ch, nfsOperationIdentifier{id, op.Operation}, op, labelValues)
+	}
+	return nil
+}
+
+func TestMountStatsLatency(t *testing.T) {
+	latency, err := newMountStatsLatency("mountstats_nfs", []string{"export", "protocol", "mountaddr", "operation"}, "0.001, 0.01,0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := &mountStatsLatencyTestCollector{
+		latency: latency,
+		scrapes: [][]procfs.NFSOperationStats{
+			// The first scrape only sets the baseline.
+			{
+				{Operation: "READ", Requests: 10, CumulativeTotalResponseMilliseconds: 100, CumulativeTotalRequestMilliseconds: 200},
+				{Operation: "WRITE", Requests: 5, CumulativeTotalResponseMilliseconds: 50, CumulativeTotalRequestMilliseconds: 50},
+			},
+			// 10 READs averaging 5ms and 8ms, and 2 WRITEs averaging 50ms and 500ms.
+			{
+				{Operation: "READ", Requests: 20, CumulativeTotalResponseMilliseconds: 150, CumulativeTotalRequestMilliseconds: 280},
+				{Operation: "WRITE", Requests: 7, CumulativeTotalResponseMilliseconds: 150, CumulativeTotalRequestMilliseconds: 1050},
+			},
+			// READ was remounted, WRITE disappeared.
+			{
+				{Operation: "READ", Requests: 4, CumulativeTotalResponseMilliseconds: 4, CumulativeTotalRequestMilliseconds: 4},
+			},
+			// 4 READs averaging 0.5ms.
+			{
+				{Operation: "READ", Requests: 8, CumulativeTotalResponseMilliseconds: 6, CumulativeTotalRequestMilliseconds: 6},
+			},
+		},
+	}
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+	names := []string{
+		"node_mountstats_nfs_operations_response_time_seconds",
+		"node_mountstats_nfs_operations_request_time_seconds",
+	}
+
+	for i, want := range []string{
+		`# HELP node_mountstats_nfs_operations_request_time_seconds Histogram of the average duration requests of a given operation took from being enqueued to being completely handled, per interval between scrapes.
+# TYPE node_mountstats_nfs_operations_request_time_seconds histogram
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.001"} 0
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.01"} 0
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.1"} 0
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="+Inf"} 0
+node_mountstats_nfs_operations_request_time_seconds_sum{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 0
+node_mountstats_nfs_operations_request_time_seconds_count{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 0
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="0.001"} 0
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="0.01"} 0
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="0.1"} 0
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="+Inf"} 0
+node_mountstats_nfs_operations_request_time_seconds_sum{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp"} 0
+node_mountstats_nfs_operations_request_time_seconds_count{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp"} 0
+# HELP node_mountstats_nfs_operations_response_time_seconds Histogram of the average duration requests of a given operation took to get a reply back after being transmitted, per interval between scrapes.
+# TYPE node_mountstats_nfs_operations_response_time_seconds histogram
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.001"} 0
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.01"} 0
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.1"} 0
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="+Inf"} 0
+node_mountstats_nfs_operations_response_time_seconds_sum{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 0
+node_mountstats_nfs_operations_response_time_seconds_count{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 0
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="0.001"} 0
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="0.01"} 0
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="0.1"} 0
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="+Inf"} 0
+node_mountstats_nfs_operations_response_time_seconds_sum{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp"} 0
+node_mountstats_nfs_operations_response_time_seconds_count{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp"} 0
+`,
+		`# HELP node_mountstats_nfs_operations_request_time_seconds Histogram of the average duration requests of a given operation took from being enqueued to being completely handled, per interval between scrapes.
+# TYPE node_mountstats_nfs_operations_request_time_seconds histogram
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.001"} 0
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.01"} 10
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.1"} 10
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="+Inf"} 10
+node_mountstats_nfs_operations_request_time_seconds_sum{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 0.08
+node_mountstats_nfs_operations_request_time_seconds_count{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 10
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="0.001"} 0
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="0.01"} 0
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="0.1"} 0
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="+Inf"} 2
+node_mountstats_nfs_operations_request_time_seconds_sum{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp"} 1
+node_mountstats_nfs_operations_request_time_seconds_count{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp"} 2
+# HELP node_mountstats_nfs_operations_response_time_seconds Histogram of the average duration requests of a given operation took to get a reply back after being transmitted, per interval between scrapes.
+# TYPE node_mountstats_nfs_operations_response_time_seconds histogram
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.001"} 0
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.01"} 10
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.1"} 10
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="+Inf"} 10
+node_mountstats_nfs_operations_response_time_seconds_sum{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 0.05
+node_mountstats_nfs_operations_response_time_seconds_count{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 10
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="0.001"} 0
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="0.01"} 0
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="0.1"} 2
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp",le="+Inf"} 2
+node_mountstats_nfs_operations_response_time_seconds_sum{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp"} 0.1
+node_mountstats_nfs_operations_response_time_seconds_count{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="WRITE",protocol="tcp"} 2
+`,
+		`# HELP node_mountstats_nfs_operations_request_time_seconds Histogram of the average duration requests of a given operation took from being enqueued to being completely handled, per interval between scrapes.
+# TYPE node_mountstats_nfs_operations_request_time_seconds histogram
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.001"} 0
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.01"} 10
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.1"} 10
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="+Inf"} 10
+node_mountstats_nfs_operations_request_time_seconds_sum{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 0.08
+node_mountstats_nfs_operations_request_time_seconds_count{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 10
+# HELP node_mountstats_nfs_operations_response_time_seconds Histogram of the average duration requests of a given operation took to get a reply back after being transmitted, per interval between scrapes.
+# TYPE node_mountstats_nfs_operations_response_time_seconds histogram
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.001"} 0
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.01"} 10
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.1"} 10
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="+Inf"} 10
+node_mountstats_nfs_operations_response_time_seconds_sum{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 0.05
+node_mountstats_nfs_operations_response_time_seconds_count{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 10
+`,
+		`# HELP node_mountstats_nfs_operations_request_time_seconds Histogram of the average duration requests of a given operation took from being enqueued to being completely handled, per interval between scrapes.
+# TYPE node_mountstats_nfs_operations_request_time_seconds histogram
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.001"} 4
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.01"} 14
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.1"} 14
+node_mountstats_nfs_operations_request_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="+Inf"} 14
+node_mountstats_nfs_operations_request_time_seconds_sum{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 0.082
+node_mountstats_nfs_operations_request_time_seconds_count{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 14
+# HELP node_mountstats_nfs_operations_response_time_seconds Histogram of the average duration requests of a given operation took to get a reply back after being transmitted, per interval between scrapes.
+# TYPE node_mountstats_nfs_operations_response_time_seconds histogram
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.001"} 4
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.01"} 14
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="0.1"} 14
+node_mountstats_nfs_operations_response_time_seconds_bucket{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp",le="+Inf"} 14
+node_mountstats_nfs_operations_response_time_seconds_sum{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 0.052
+node_mountstats_nfs_operations_response_time_seconds_count{export="192.168.1.1:/srv/test",mountaddr="192.168.1.1",operation="READ",protocol="tcp"} 14
+`,
+	} {
+		if err := testutil.GatherAndCompare(registry, strings.NewReader(want), names...); err != nil {
+			t.Errorf("scrape %d: %s", i, err)
+		}
+	}
+}
+
+func TestParseLatencyBuckets(t *testing.T) {
+	for _, tc := range []struct {
+		in    string
+		valid bool
+	}{
+		{"0.001,0.01,1", true},
+		{"1", true},
+		{"0.01,0.001", false},
+		{"0.01,fast", false},
+	} {
+		_, err := parseLatencyBuckets(tc.in)
+		if valid := err == nil; valid != tc.valid {
+			t.Errorf("parseLatencyBuckets(%q): got err %v", tc.in, err)
+		}
+	}
+}
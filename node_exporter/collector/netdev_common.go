@@ -41,6 +41,8 @@ type netDevCollector struct {
 	subsystem    string
 	deviceFilter netDevFilter
 	metricDescs  map[string]*prometheus.Desc
+	resetsDesc   *prometheus.Desc
+	counters     *counterTracker
 	logger       log.Logger
 }
 
@@ -86,7 +88,14 @@ func NewNetDevCollector(logger log.Logger) (Collector, error) {
 		subsystem:    "network",
 		deviceFilter: newNetDevFilter(*netdevDeviceExclude, *netdevDeviceInclude),
 		metricDescs:  map[string]*prometheus.Desc{},
-		logger:       logger,
+		resetsDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "network", "counter_resets_total"),
+			"Number of scrapes in which a network device statistic wrapped around or was reset.",
+			[]string{"device"},
+			nil,
+		),
+		counters: newCounterTracker(),
+		logger:   logger,
 	}, nil
 }
 
@@ -95,7 +104,11 @@ func (c *netDevCollector) Update(ch chan<- prometheus.Metric) error {
 	if err != nil {
 		return fmt.Errorf("couldn't get netstats: %w", err)
 	}
+	devices := make(map[string]struct{}, len(netDev))
 	for dev, devStats := range netDev {
+		devices[dev] = struct{}{}
+		devStats, resets := c.counters.observe(dev, devStats)
+		ch <- prometheus.MustNewConstMetric(c.resetsDesc, prometheus.CounterValue, float64(resets), dev)
 		for key, value := range devStats {
 			desc, ok := c.metricDescs[key]
 			if !ok {
@@ -110,6 +123,7 @@ func (c *netDevCollector) Update(ch chan<- prometheus.Metric) error {
 			ch <- prometheus.MustNewConstMetric(desc, prometheus.CounterValue, float64(value), dev)
 		}
 	}
+	c.counters.forget(devices)
 	if *netdevAddressInfo {
 		interfaces, err := net.Interfaces()
 		if err != nil {
@@ -14,10 +14,12 @@
 package collector
 
 import (
+	"fmt"
 	"os"
 	"testing"
 
 	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
 )
 
 func TestNetDevStatsIgnore(t *testing.T) {
@@ -83,3 +85,69 @@ func TestNetDevStatsAccept(t *testing.T) {
 		t.Error("want fixture interface 💩0 to exist, but it does not")
 	}
 }
+
+func TestNetDevCounterWraps(t *testing.T) {
+	defer func(path string) { *procPath = path }(*procPath)
+
+	c, err := NewNetDevCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectorAdapter{c})
+
+	for i, want := range []map[string]map[string]float64{
+		{
+			"eth0": {"node_network_receive_bytes_total": 4294967000, "node_network_transmit_packets_total": 10, "node_network_counter_resets_total": 0},
+			"eth1": {"node_network_receive_bytes_total": 10000000000, "node_network_transmit_packets_total": 20, "node_network_counter_resets_total": 0},
+		},
+		{
+			// eth0 wrapped around at 32 bits, eth1 was reset.
+			"eth0": {"node_network_receive_bytes_total": 4294967496, "node_network_transmit_packets_total": 11, "node_network_counter_resets_total": 1},
+			"eth1": {"node_network_receive_bytes_total": 10000000500, "node_network_transmit_packets_total": 21, "node_network_counter_resets_total": 1},
+		},
+		{
+			"eth0": {"node_network_receive_bytes_total": 4294968296, "node_network_transmit_packets_total": 12, "node_network_counter_resets_total": 1},
+			"eth1": {"node_network_receive_bytes_total": 10000000700, "node_network_transmit_packets_total": 22, "node_network_counter_resets_total": 1},
+		},
+	} {
+		*procPath = fmt.Sprintf("fixtures/netdev_wrap/%d", i+1)
+
+		got, err := collectNetDevCounters(reg)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for dev, metrics := range want {
+			for name, value := range metrics {
+				if got[dev][name] != value {
+					t.Errorf("scrape %d: want %s{device=%q} %v, got %v", i+1, name, dev, value, got[dev][name])
+				}
+			}
+		}
+	}
+}
+
+// collectNetDevCounters returns the counter values of a single scrape by
+// device and metric name.
+func collectNetDevCounters(reg *prometheus.Registry) (map[string]map[string]float64, error) {
+	mfs, err := reg.Gather()
+	if err != nil {
+		return nil, err
+	}
+
+	result := map[string]map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			for _, l := range m.GetLabel() {
+				if l.GetName() != "device" {
+					continue
+				}
+				if _, ok := result[l.GetValue()]; !ok {
+					result[l.GetValue()] = map[string]float64{}
+				}
+				result[l.GetValue()][mf.GetName()] = m.GetCounter().GetValue()
+			}
+		}
+	}
+	return result, nil
+}
@@ -0,0 +1,327 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nonetqueue && !noethtool
+// +build !nonetqueue,!noethtool
+
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/safchain/ethtool"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+const netQueueSubsystem = "netqueue"
+
+var (
+	netQueueDeviceInclude = kingpin.Flag("collector.netqueue.device-include", "Regexp of network devices to include (mutually exclusive to device-exclude).").String()
+	netQueueDeviceExclude = kingpin.Flag("collector.netqueue.device-exclude", "Regexp of network devices to exclude (mutually exclusive to device-include).").String()
+
+	// netQueueStatPatterns match the per-queue ethtool stats of common
+	// drivers, capturing direction, queue and counter in named groups:
+	//   rx_queue_0_packets (virtio_net, igb, ixgbe, ice, hv_netvsc)
+	//   rx0_bytes          (mlx4, mlx5)
+	//   rx-0.rx_packets    (i40e, sfc)
+	//   queue_0_rx_cnt     (ena)
+	netQueueStatPatterns = []*regexp.Regexp{
+		regexp.MustCompile(`^(?P<dir>rx|tx)_queue_(?P<queue>\d+)_(?P<stat>packets|bytes)$`),
+		regexp.MustCompile(`^(?P<dir>rx|tx)(?P<queue>\d+)_(?P<stat>packets|bytes)$`),
+		regexp.MustCompile(`^(?P<dir>rx|tx)-(?P<queue>\d+)\.(?:rx_|tx_)?(?P<stat>packets|bytes)$`),
+		regexp.MustCompile(`^queue_(?P<queue>\d+)_(?P<dir>rx|tx)_(?P<stat>cnt|bytes)$`),
+	}
+	netQueueIRQNumber = regexp.MustCompile(`(\d+)$`)
+)
+
+type netQueueCollector struct {
+	ethtool      Ethtool
+	deviceFilter netDevFilter
+	packets      typedDesc
+	bytes        typedDesc
+	rpsInfo      typedDesc
+	xpsInfo      typedDesc
+	irqInfo      typedDesc
+	logger       log.Logger
+}
+
+// netQueueStat identifies a per-queue counter.
+type netQueueStat struct {
+	direction string
+	queue     string
+	stat      string
+}
+
+func init() {
+	registerCollector("netqueue", defaultDisabled, NewNetQueueCollector)
+}
+
+// NewNetQueueCollector returns a new Collector exposing per-queue packet and
+// byte counters of network interfaces, together with the CPUs their packets
+// are steered to and the affinity of their interrupts.
+func NewNetQueueCollector(logger log.Logger) (Collector, error) {
+	if *netQueueDeviceExclude != "" && *netQueueDeviceInclude != "" {
+		return nil, errors.New("device-exclude & device-include are mutually exclusive")
+	}
+
+	labels := []string{"device", "direction", "queue"}
+	c := &netQueueCollector{
+		deviceFilter: newNetDevFilter(*netQueueDeviceExclude, *netQueueDeviceInclude),
+		packets: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, netQueueSubsystem, "packets_total"),
+			"Number of packets received or transmitted by a network interface queue, as reported by the driver.",
+			labels, nil,
+		), prometheus.CounterValue},
+		bytes: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, netQueueSubsystem, "bytes_total"),
+			"Number of bytes received or transmitted by a network interface queue, as reported by the driver.",
+			labels, nil,
+		), prometheus.CounterValue},
+		rpsInfo: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, netQueueSubsystem, "rps_cpus_info"),
+			"A metric with a constant '1' value labeled by device, queue and the list of CPUs receive packet steering hands packets of the queue to. Empty if RPS is disabled.",
+			[]string{"device", "queue", "cpus"}, nil,
+		), prometheus.GaugeValue},
+		xpsInfo: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, netQueueSubsystem, "xps_cpus_info"),
+			"A metric with a constant '1' value labeled by device, queue and the list of CPUs transmit packet steering assigns to the queue. Empty if XPS is disabled.",
+			[]string{"device", "queue", "cpus"}, nil,
+		), prometheus.GaugeValue},
+		irqInfo: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, netQueueSubsystem, "irq_affinity_info"),
+			"A metric with a constant '1' value labeled by device, irq, name, queue and the list of CPUs the interrupt may be handled on. The queue is derived from the interrupt name and empty if it has none.",
+			[]string{"device", "irq", "name", "queue", "cpus"}, nil,
+		), prometheus.GaugeValue},
+		logger: logger,
+	}
+
+	e, err := ethtool.NewEthtool()
+	if err != nil {
+		level.Debug(logger).Log("msg", "Not collecting per-queue counters, failed to initialize ethtool library", "err", err)
+	} else {
+		c.ethtool = &ethtoolLibrary{e}
+	}
+	return c, nil
+}
+
+// Update implements Collector.
+func (c *netQueueCollector) Update(ch chan<- prometheus.Metric) error {
+	root := sysFilePath("class/net")
+	devices, err := ioutil.ReadDir(root)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "Not collecting network queues, directory does not exist", "path", root)
+			return ErrNoData
+		}
+		return fmt.Errorf("failed to read network interfaces: %w", err)
+	}
+
+	irqs, err := readIRQNames(procFilePath("interrupts"))
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "Not collecting interrupt affinity, failed to read interrupts", "err", err)
+	}
+
+	for _, device := range devices {
+		name := device.Name()
+		if c.deviceFilter.ignored(name) {
+			continue
+		}
+		queues, err := ioutil.ReadDir(filepath.Join(root, name, "queues"))
+		if err != nil {
+			// Not a network interface, e.g. bonding_masters.
+			continue
+		}
+
+		for _, queue := range queues {
+			var (
+				file = "rps_cpus"
+				desc = c.rpsInfo
+			)
+			parts := strings.SplitN(queue.Name(), "-", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			index := parts[1]
+			if parts[0] == "tx" {
+				file, desc = "xps_cpus", c.xpsInfo
+			}
+			// xps_cpus is missing on single queue devices and can't be read
+			// on some virtual devices.
+			mask, err := ioutil.ReadFile(filepath.Join(root, name, "queues", queue.Name(), file))
+			if err != nil {
+				continue
+			}
+			cpus, err := parseCPUMask(strings.TrimSpace(string(mask)))
+			if err != nil {
+				return fmt.Errorf("invalid %s of %s queue %s: %w", file, name, queue.Name(), err)
+			}
+			ch <- desc.mustNewConstMetric(1.0, name, index, cpus)
+		}
+
+		if c.ethtool != nil {
+			c.updateStats(ch, name)
+		}
+		if irqs != nil {
+			if err := c.updateIRQs(ch, filepath.Join(root, name), name, irqs); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *netQueueCollector) updateStats(ch chan<- prometheus.Metric, device string) {
+	stats, err := c.ethtool.Stats(device)
+	if err != nil {
+		level.Debug(c.logger).Log("msg", "ethtool stats error", "err", err, "device", device)
+		return
+	}
+	for stat, value := range parseNetQueueStats(stats) {
+		desc := c.bytes
+		if stat.stat == "packets" {
+			desc = c.packets
+		}
+		ch <- desc.mustNewConstMetric(float64(value), device, stat.direction, stat.queue)
+	}
+}
+
+// parseNetQueueStats picks the per-queue packet and byte counters out of the
+// ethtool stats of a device.
+func parseNetQueueStats(stats map[string]uint64) map[netQueueStat]uint64 {
+	queues := make(map[netQueueStat]uint64)
+	for name, value := range stats {
+		for _, re := range netQueueStatPatterns {
+			match := re.FindStringSubmatch(name)
+			if match == nil {
+				continue
+			}
+			var s netQueueStat
+			for i, group := range re.SubexpNames() {
+				switch group {
+				case "dir":
+					s.direction = match[i]
+				case "queue":
+					s.queue = match[i]
+				case "stat":
+					s.stat = match[i]
+				}
+			}
+			if s.stat == "cnt" {
+				s.stat = "packets"
+			}
+			queues[s] = value
+			break
+		}
+	}
+	return queues
+}
+
+// updateIRQs exposes the affinity of the interrupts of a device. These are
+// the MSI interrupts of its PCI device, and interrupts named after the
+// device, as used by drivers of virtual devices.
+func (c *netQueueCollector) updateIRQs(ch chan<- prometheus.Metric, path, device string, irqs map[string]string) error {
+	msi := make(map[string]struct{})
+	if entries, err := ioutil.ReadDir(filepath.Join(path, "device", "msi_irqs")); err == nil {
+		for _, entry := range entries {
+			msi[entry.Name()] = struct{}{}
+		}
+	}
+
+	for irq, name := range irqs {
+		if _, ok := msi[irq]; !ok && !strings.HasPrefix(name, device+"-") {
+			continue
+		}
+		affinity, err := ioutil.ReadFile(procFilePath(filepath.Join("irq", irq, "smp_affinity_list")))
+		if err != nil {
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return fmt.Errorf("failed to read affinity of IRQ %s: %w", irq, err)
+		}
+		// Names like "mlx5_comp3@pci:0000:01:00.0" carry the bus address
+		// after the queue.
+		queue := netQueueIRQNumber.FindString(strings.SplitN(name, "@", 2)[0])
+		ch <- c.irqInfo.mustNewConstMetric(1.0, device, irq, name, queue, strings.TrimSpace(string(affinity)))
+	}
+	return nil
+}
+
+// readIRQNames returns the name of the handler of each numbered interrupt in
+// /proc/interrupts. For shared interrupts only the last handler is returned.
+func readIRQNames(path string) (map[string]string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	names := make(map[string]string)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+		irq := strings.TrimSuffix(fields[0], ":")
+		if _, err := strconv.Atoi(irq); err != nil {
+			continue
+		}
+		names[irq] = fields[len(fields)-1]
+	}
+	return names, scanner.Err()
+}
+
+// parseCPUMask converts a hexadecimal CPU mask in the format used by sysfs,
+// e.g. "00000000,0000000f", to a CPU list like "0-3".
+func parseCPUMask(mask string) (string, error) {
+	var cpus []int
+	words := strings.Split(mask, ",")
+	for i := range words {
+		// The least significant word comes last.
+		word, err := strconv.ParseUint(words[len(words)-1-i], 16, 32)
+		if err != nil {
+			return "", err
+		}
+		for bit := 0; bit < 32; bit++ {
+			if word&(1<<bit) != 0 {
+				cpus = append(cpus, i*32+bit)
+			}
+		}
+	}
+
+	var ranges []string
+	for i := 0; i < len(cpus); {
+		j := i
+		for j+1 < len(cpus) && cpus[j+1] == cpus[j]+1 {
+			j++
+		}
+		if i == j {
+			ranges = append(ranges, strconv.Itoa(cpus[i]))
+		} else {
+			ranges = append(ranges, fmt.Sprintf("%d-%d", cpus[i], cpus[j]))
+		}
+		i = j + 1
+	}
+	return strings.Join(ranges, ","), nil
+}
@@ -0,0 +1,143 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nonetqueue && !noethtool
+// +build !nonetqueue,!noethtool
+
+package collector
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseCPUMask(t *testing.T) {
+	for mask, want := range map[string]string{
+		"0":                 "",
+		"00000000,00000000": "",
+		"1":                 "0",
+		"0000000f":          "0-3",
+		"00000001,00000005": "0,2,32",
+		"80000000,0000ff0a": "1,3,8-15,63",
+	} {
+		got, err := parseCPUMask(mask)
+		if err != nil {
+			t.Errorf("%s: %v", mask, err)
+		}
+		if got != want {
+			t.Errorf("%s: want %q, got %q", mask, want, got)
+		}
+	}
+	if _, err := parseCPUMask("0000000g"); err == nil {
+		t.Error("expected error for invalid mask")
+	}
+}
+
+func TestParseNetQueueStats(t *testing.T) {
+	got := parseNetQueueStats(map[string]uint64{
+		"rx_packets":         10,
+		"rx_queue_1_packets": 1,
+		"tx3_bytes":          2,
+		"rx-0.rx_bytes":      3,
+		"tx-2.packets":       4,
+		"queue_5_rx_cnt":     5,
+		"queue_5_tx_bytes":   6,
+		"rx0_cache_reuse":    7,
+	})
+	want := map[netQueueStat]uint64{
+		{"rx", "1", "packets"}: 1,
+		{"tx", "3", "bytes"}:   2,
+		{"rx", "0", "bytes"}:   3,
+		{"tx", "2", "packets"}: 4,
+		{"rx", "5", "packets"}: 5,
+		{"tx", "5", "bytes"}:   6,
+	}
+	if len(got) != len(want) {
+		t.Errorf("want %v, got %v", want, got)
+	}
+	for stat, value := range want {
+		if got[stat] != value {
+			t.Errorf("%v: want %d, got %d", stat, value, got[stat])
+		}
+	}
+}
+
+func TestNetQueueCollector(t *testing.T) {
+	defer func(sys, proc string) {
+		*sysPath = sys
+		*procPath = proc
+	}(*sysPath, *procPath)
+	*sysPath = "fixtures/netqueue/sys"
+	*procPath = "fixtures/netqueue/proc"
+
+	c, err := NewNetQueueCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.(*netQueueCollector).ethtool = &EthtoolFixture{fixturePath: "fixtures/netqueue/ethtool/"}
+
+	want := `# HELP node_netqueue_bytes_total Number of bytes received or transmitted by a network interface queue, as reported by the driver.
+# TYPE node_netqueue_bytes_total counter
+node_netqueue_bytes_total{device="eth0",direction="rx",queue="0"} 290000
+node_netqueue_bytes_total{device="eth0",direction="rx",queue="1"} 10000
+node_netqueue_bytes_total{device="eth0",direction="tx",queue="0"} 75000
+node_netqueue_bytes_total{device="eth0",direction="tx",queue="1"} 76000
+node_netqueue_bytes_total{device="eth1",direction="rx",queue="0"} 4200
+node_netqueue_bytes_total{device="eth1",direction="tx",queue="0"} 2400
+# HELP node_netqueue_irq_affinity_info A metric with a constant '1' value labeled by device, irq, name, queue and the list of CPUs the interrupt may be handled on. The queue is derived from the interrupt name and empty if it has none.
+# TYPE node_netqueue_irq_affinity_info gauge
+node_netqueue_irq_affinity_info{cpus="0",device="eth1",irq="50",name="eth1-rx-0",queue="0"} 1
+node_netqueue_irq_affinity_info{cpus="1",device="eth0",irq="41",name="mlx5_comp1@pci:0000:01:00.0",queue="1"} 1
+node_netqueue_irq_affinity_info{cpus="2-3",device="eth0",irq="40",name="mlx5_comp0@pci:0000:01:00.0",queue="0"} 1
+# HELP node_netqueue_packets_total Number of packets received or transmitted by a network interface queue, as reported by the driver.
+# TYPE node_netqueue_packets_total counter
+node_netqueue_packets_total{device="eth0",direction="rx",queue="0"} 2900
+node_netqueue_packets_total{device="eth0",direction="rx",queue="1"} 100
+node_netqueue_packets_total{device="eth0",direction="tx",queue="0"} 750
+node_netqueue_packets_total{device="eth0",direction="tx",queue="1"} 750
+node_netqueue_packets_total{device="eth1",direction="rx",queue="0"} 42
+node_netqueue_packets_total{device="eth1",direction="tx",queue="0"} 24
+# HELP node_netqueue_rps_cpus_info A metric with a constant '1' value labeled by device, queue and the list of CPUs receive packet steering hands packets of the queue to. Empty if RPS is disabled.
+# TYPE node_netqueue_rps_cpus_info gauge
+node_netqueue_rps_cpus_info{cpus="",device="eth0",queue="1"} 1
+node_netqueue_rps_cpus_info{cpus="",device="eth1",queue="0"} 1
+node_netqueue_rps_cpus_info{cpus="2-3",device="eth0",queue="0"} 1
+# HELP node_netqueue_xps_cpus_info A metric with a constant '1' value labeled by device, queue and the list of CPUs transmit packet steering assigns to the queue. Empty if XPS is disabled.
+# TYPE node_netqueue_xps_cpus_info gauge
+node_netqueue_xps_cpus_info{cpus="0",device="eth1",queue="0"} 1
+node_netqueue_xps_cpus_info{cpus="0,2,32",device="eth0",queue="0"} 1
+node_netqueue_xps_cpus_info{cpus="1,3",device="eth0",queue="1"} 1
+`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestNetQueueDeviceFilterExclusive(t *testing.T) {
+	defer func(include, exclude string) {
+		*netQueueDeviceInclude = include
+		*netQueueDeviceExclude = exclude
+	}(*netQueueDeviceInclude, *netQueueDeviceExclude)
+	*netQueueDeviceInclude = "^eth"
+	*netQueueDeviceExclude = "^lo$"
+
+	if _, err := NewNetQueueCollector(log.NewNopLogger()); err == nil {
+		t.Error("want error with both device-include and device-exclude, got none")
+	}
+}
@@ -0,0 +1,378 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nonfsd
+// +build !nonfsd
+
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var nfsdClientLimit = kingpin.Flag("collector.nfsd.client-limit", "Maximum number of NFSv4 clients exposed individually, those holding the most states first. 0 disables per-client metrics.").Default("100").Int()
+
+// nfsdExportStats are the statistics of an export from
+// /proc/fs/nfsd/export_stats, available since Linux 6.2.
+type nfsdExportStats struct {
+	path    string
+	client  string
+	fhStale uint64
+	ioRead  uint64
+	ioWrite uint64
+}
+
+// nfsdClient is the NFSv4 client state from /proc/fs/nfsd/clients/<id>,
+// available since Linux 5.3. The kernel doesn't count operations or bytes
+// per client.
+type nfsdClient struct {
+	address   string
+	info      nfsdClientInfo
+	lastRenew float64
+	states    map[string]uint64
+}
+
+type nfsdClientInfo struct {
+	name         string
+	minorVersion string
+	status       string
+}
+
+// nfsdClientGroup are the clients sharing an address, e.g. containers behind
+// NAT. Clients are exposed by address.
+type nfsdClientGroup struct {
+	address   string
+	infos     []nfsdClientInfo
+	lastRenew float64
+	states    map[string]uint64
+}
+
+func (g nfsdClientGroup) totalStates() uint64 {
+	var n uint64
+	for _, v := range g.states {
+		n += v
+	}
+	return n
+}
+
+// updateNFSdExportStats collects the statistics of exports.
+func (c *nfsdCollector) updateNFSdExportStats(ch chan<- prometheus.Metric) error {
+	exports, err := parseNFSdExportStats(procFilePath("fs/nfsd/export_stats"))
+	if err != nil {
+		// Reading the export statistics may be restricted to root.
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+			level.Debug(c.logger).Log("msg", "Not collecting NFSd export metrics", "err", err)
+			return nil
+		}
+		return fmt.Errorf("failed to retrieve nfsd export stats: %w", err)
+	}
+
+	labels := []string{"export", "client"}
+	readDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, nfsdSubsystem, "export_read_bytes_total"),
+		"Total NFSd bytes read from an export by the clients it is exported to.",
+		labels, nil,
+	)
+	writeDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, nfsdSubsystem, "export_written_bytes_total"),
+		"Total NFSd bytes written to an export by the clients it is exported to.",
+		labels, nil,
+	)
+	staleDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, nfsdSubsystem, "export_file_handles_stale_total"),
+		"Total number of NFSd stale file handles of an export.",
+		labels, nil,
+	)
+	for _, e := range exports {
+		ch <- prometheus.MustNewConstMetric(readDesc, prometheus.CounterValue, float64(e.ioRead), e.path, e.client)
+		ch <- prometheus.MustNewConstMetric(writeDesc, prometheus.CounterValue, float64(e.ioWrite), e.path, e.client)
+		ch <- prometheus.MustNewConstMetric(staleDesc, prometheus.CounterValue, float64(e.fhStale), e.path, e.client)
+	}
+	return nil
+}
+
+// updateNFSdClients collects the number of NFSv4 clients and the states they
+// hold, keeping at most --collector.nfsd.client-limit clients.
+func (c *nfsdCollector) updateNFSdClients(ch chan<- prometheus.Metric) error {
+	clients, err := readNFSdClients(procFilePath("fs/nfsd/clients"))
+	if err != nil {
+		// The info and states files of clients are only readable by root.
+		if errors.Is(err, os.ErrNotExist) || errors.Is(err, os.ErrPermission) {
+			level.Debug(c.logger).Log("msg", "Not collecting NFSd client metrics", "err", err)
+			return nil
+		}
+		return fmt.Errorf("failed to retrieve nfsd clients: %w", err)
+	}
+
+	ch <- prometheus.MustNewConstMetric(
+		prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, nfsdSubsystem, "clients"),
+			"Number of NFSv4 clients known to NFSd.",
+			nil,
+			nil,
+		),
+		prometheus.GaugeValue,
+		float64(len(clients)))
+
+	groups := groupNFSdClients(clients)
+	if len(groups) > *nfsdClientLimit {
+		level.Debug(c.logger).Log("msg", "Limiting NFSd client metrics", "clients", len(groups), "limit", *nfsdClientLimit)
+		groups = groups[:*nfsdClientLimit]
+	}
+
+	infoDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, nfsdSubsystem, "client_info"),
+		"A metric with a constant '1' value labeled by the address, name, NFSv4 minor version and status of a client.",
+		[]string{"client", "name", "minor_version", "status"}, nil,
+	)
+	renewDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, nfsdSubsystem, "client_last_renew_seconds"),
+		"Number of seconds since a client last renewed its lease.",
+		[]string{"client"}, nil,
+	)
+	statesDesc := prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, nfsdSubsystem, "client_states"),
+		"Number of states like opens, locks and delegations held by a client.",
+		[]string{"client", "type"}, nil,
+	)
+	for _, g := range groups {
+		for _, info := range g.infos {
+			ch <- prometheus.MustNewConstMetric(infoDesc, prometheus.GaugeValue, 1, g.address, info.name, info.minorVersion, info.status)
+		}
+		ch <- prometheus.MustNewConstMetric(renewDesc, prometheus.GaugeValue, g.lastRenew, g.address)
+		for _, typ := range []string{"open", "lock", "deleg", "layout"} {
+			ch <- prometheus.MustNewConstMetric(statesDesc, prometheus.GaugeValue, float64(g.states[typ]), g.address, typ)
+		}
+	}
+	return nil
+}
+
+// groupNFSdClients groups the clients by address and sorts the groups by
+// the number of states they hold.
+func groupNFSdClients(clients []nfsdClient) []nfsdClientGroup {
+	var groups []nfsdClientGroup
+	byAddress := map[string]int{}
+	for _, c := range clients {
+		i, ok := byAddress[c.address]
+		if !ok {
+			i = len(groups)
+			byAddress[c.address] = i
+			groups = append(groups, nfsdClientGroup{
+				address:   c.address,
+				lastRenew: c.lastRenew,
+				states:    map[string]uint64{},
+			})
+		}
+		g := &groups[i]
+		if !containsNFSdClientInfo(g.infos, c.info) {
+			g.infos = append(g.infos, c.info)
+		}
+		if c.lastRenew < g.lastRenew {
+			g.lastRenew = c.lastRenew
+		}
+		for typ, n := range c.states {
+			g.states[typ] += n
+		}
+	}
+	sort.SliceStable(groups, func(i, j int) bool {
+		if a, b := groups[i].totalStates(), groups[j].totalStates(); a != b {
+			return a > b
+		}
+		return groups[i].address < groups[j].address
+	})
+	return groups
+}
+
+func containsNFSdClientInfo(infos []nfsdClientInfo, info nfsdClientInfo) bool {
+	for _, i := range infos {
+		if i == info {
+			return true
+		}
+	}
+	return false
+}
+
+func readNFSdClients(dir string) ([]nfsdClient, error) {
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var clients []nfsdClient
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		client, err := parseNFSdClientInfo(filepath.Join(dir, entry.Name(), "info"))
+		if err != nil {
+			// Clients can expire while being read.
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			return nil, err
+		}
+		client.states, err = parseNFSdClientStates(filepath.Join(dir, entry.Name(), "states"))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+		clients = append(clients, client)
+	}
+	return clients, nil
+}
+
+func parseNFSdClientInfo(path string) (nfsdClient, error) {
+	var client nfsdClient
+	f, err := os.Open(path)
+	if err != nil {
+		return client, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ": ", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value := strings.Trim(parts[1], `"`)
+		switch parts[0] {
+		case "address":
+			client.address = value
+			if host, _, err := net.SplitHostPort(value); err == nil {
+				client.address = host
+			}
+		case "name":
+			client.info.name = value
+		case "minor version":
+			client.info.minorVersion = value
+		case "status":
+			client.info.status = value
+		case "seconds from last renew":
+			if client.lastRenew, err = strconv.ParseFloat(value, 64); err != nil {
+				return client, fmt.Errorf("invalid last renew in %s: %w", path, err)
+			}
+		}
+	}
+	return client, scanner.Err()
+}
+
+// parseNFSdClientStates counts the states by type. Each state is a line like
+// "- 0x...: { type: open, access: rw, ... }".
+func parseNFSdClientStates(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	states := map[string]uint64{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.Index(line, "{ type: ")
+		if i < 0 {
+			continue
+		}
+		typ := line[i+len("{ type: "):]
+		if j := strings.IndexAny(typ, ", }"); j >= 0 {
+			typ = typ[:j]
+		}
+		states[typ]++
+	}
+	return states, scanner.Err()
+}
+
+// parseNFSdExportStats parses the export table with statistics. Exports
+// start with a line of the tab-separated path, client and start time,
+// followed by indented statistics.
+func parseNFSdExportStats(path string) ([]nfsdExportStats, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var exports []nfsdExportStats
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		line := scanner.Text()
+		switch {
+		case line == "" || strings.HasPrefix(line, "#"):
+			continue
+		case !strings.HasPrefix(line, "\t"):
+			fields := strings.Split(line, "\t")
+			if len(fields) < 2 {
+				return nil, fmt.Errorf("invalid export line %q", line)
+			}
+			exports = append(exports, nfsdExportStats{
+				path:   unescapeOctal(fields[0]),
+				client: unescapeOctal(fields[1]),
+			})
+		default:
+			if len(exports) == 0 {
+				return nil, fmt.Errorf("statistics outside of an export: %q", line)
+			}
+			parts := strings.SplitN(strings.TrimSpace(line), ": ", 2)
+			if len(parts) != 2 {
+				continue
+			}
+			value, err := strconv.ParseUint(parts[1], 10, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid export statistic %q: %w", line, err)
+			}
+			e := &exports[len(exports)-1]
+			switch parts[0] {
+			case "fh_stale":
+				e.fhStale = value
+			case "io_read":
+				e.ioRead = value
+			case "io_write":
+				e.ioWrite = value
+			}
+		}
+	}
+	return exports, scanner.Err()
+}
+
+// unescapeOctal reverts the octal escapes like \040 the kernel uses for
+// whitespace and backslashes in paths.
+func unescapeOctal(s string) string {
+	if !strings.Contains(s, `\`) {
+		return s
+	}
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\\' && i+3 < len(s) {
+			if n, err := strconv.ParseUint(s[i+1:i+4], 8, 8); err == nil {
+				b.WriteByte(byte(n))
+				i += 3
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	return b.String()
+}
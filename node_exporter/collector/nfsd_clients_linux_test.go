@@ -0,0 +1,76 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nonfsd
+// +build !nonfsd
+
+package collector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGroupNFSdClients(t *testing.T) {
+	web := nfsdClientInfo{name: "Linux NFSv4.2 web", minorVersion: "2", status: "confirmed"}
+	groups := groupNFSdClients([]nfsdClient{
+		{address: "10.0.0.1", info: web, lastRenew: 5, states: map[string]uint64{"open": 1}},
+		{address: "10.0.0.2", info: web, lastRenew: 9, states: map[string]uint64{"open": 2, "lock": 1}},
+		{address: "10.0.0.1", info: web, lastRenew: 3, states: map[string]uint64{"open": 4}},
+		{address: "10.0.0.3", info: web, lastRenew: 1},
+	})
+
+	want := []nfsdClientGroup{
+		{address: "10.0.0.1", infos: []nfsdClientInfo{web}, lastRenew: 3, states: map[string]uint64{"open": 5}},
+		{address: "10.0.0.2", infos: []nfsdClientInfo{web}, lastRenew: 9, states: map[string]uint64{"open": 2, "lock": 1}},
+		{address: "10.0.0.3", infos: []nfsdClientInfo{web}, lastRenew: 1, states: map[string]uint64{}},
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("want %+v, got %+v", want, groups)
+	}
+}
+
+func TestNFSdClientLimit(t *testing.T) {
+	defer func(proc string, limit int) {
+		*procPath = proc
+		*nfsdClientLimit = limit
+	}(*procPath, *nfsdClientLimit)
+	*procPath = "fixtures/proc"
+	*nfsdClientLimit = 1
+
+	c, err := NewNFSdCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP node_nfsd_client_last_renew_seconds Number of seconds since a client last renewed its lease.
+# TYPE node_nfsd_client_last_renew_seconds gauge
+node_nfsd_client_last_renew_seconds{client="192.168.1.10"} 2
+# HELP node_nfsd_clients Number of NFSv4 clients known to NFSd.
+# TYPE node_nfsd_clients gauge
+node_nfsd_clients 3
+`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+	err = testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"node_nfsd_client_last_renew_seconds",
+		"node_nfsd_clients",
+	)
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -45,6 +45,9 @@ const (
 
 // NewNFSdCollector returns a new Collector exposing /proc/net/rpc/nfsd statistics.
 func NewNFSdCollector(logger log.Logger) (Collector, error) {
+	if *nfsdClientLimit < 0 {
+		return nil, fmt.Errorf("invalid nfsd client limit %d", *nfsdClientLimit)
+	}
 	fs, err := nfs.NewFS(*procPath)
 	if err != nil {
 		return nil, fmt.Errorf("failed to open procfs: %w", err)
@@ -83,7 +86,10 @@ func (c *nfsdCollector) Update(ch chan<- prometheus.Metric) error {
 	c.updateNFSdRequestsv3Stats(ch, &stats.V3Stats)
 	c.updateNFSdRequestsv4Stats(ch, &stats.V4Ops)
 
-	return nil
+	if err := c.updateNFSdExportStats(ch); err != nil {
+		return err
+	}
+	return c.updateNFSdClients(ch)
 }
 
 // updateNFSdReplyCacheStats collects statistics for the reply cache.
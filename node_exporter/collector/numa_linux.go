@@ -0,0 +1,241 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nonuma
+// +build !nonuma
+
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const numaSubsystem = "numa"
+
+type numaCollector struct {
+	cpuInfo          typedDesc
+	stat             typedDesc
+	distance         typedDesc
+	hugepages        typedDesc
+	hugepagesFree    typedDesc
+	hugepagesSurplus typedDesc
+	logger           log.Logger
+}
+
+func init() {
+	registerCollector("numa", defaultDisabled, NewNUMACollector)
+}
+
+// NewNUMACollector returns a new Collector exposing the NUMA topology, and
+// per-node allocation statistics and huge pages.
+func NewNUMACollector(logger log.Logger) (Collector, error) {
+	hugepageLabels := []string{"node", "size_bytes"}
+	return &numaCollector{
+		cpuInfo: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, numaSubsystem, "cpu_info"),
+			"A metric with a constant '1' value labeled by cpu and the NUMA node it belongs to.",
+			[]string{"cpu", "node"}, nil,
+		), prometheus.GaugeValue},
+		stat: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, numaSubsystem, "stat_pages_total"),
+			"Number of pages allocated by type of allocation from numastat, e.g. numa_hit, numa_miss or numa_foreign.",
+			[]string{"node", "type"}, nil,
+		), prometheus.CounterValue},
+		distance: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, numaSubsystem, "distance"),
+			"Relative distance of memory accesses from a NUMA node to a target node, as reported by the firmware. Accesses to the local node have a distance of 10.",
+			[]string{"node", "target"}, nil,
+		), prometheus.GaugeValue},
+		hugepages: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, numaSubsystem, "hugepages"),
+			"Number of huge pages in the pool of a NUMA node.",
+			hugepageLabels, nil,
+		), prometheus.GaugeValue},
+		hugepagesFree: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, numaSubsystem, "hugepages_free"),
+			"Number of free huge pages in the pool of a NUMA node.",
+			hugepageLabels, nil,
+		), prometheus.GaugeValue},
+		hugepagesSurplus: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, numaSubsystem, "hugepages_surplus"),
+			"Number of surplus huge pages in the pool of a NUMA node.",
+			hugepageLabels, nil,
+		), prometheus.GaugeValue},
+		logger: logger,
+	}, nil
+}
+
+// Update implements Collector.
+func (c *numaCollector) Update(ch chan<- prometheus.Metric) error {
+	nodes, err := filepath.Glob(sysFilePath("devices/system/node/node[0-9]*"))
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		level.Debug(c.logger).Log("msg", "Not collecting NUMA metrics, no NUMA nodes found")
+		return ErrNoData
+	}
+
+	for _, path := range nodes {
+		node := strings.TrimPrefix(filepath.Base(path), "node")
+
+		cpulist, err := ioutil.ReadFile(filepath.Join(path, "cpulist"))
+		if err != nil {
+			return fmt.Errorf("failed to read CPUs of NUMA node %s: %w", node, err)
+		}
+		cpus, err := parseCPUList(strings.TrimSpace(string(cpulist)))
+		if err != nil {
+			return fmt.Errorf("invalid CPU list of NUMA node %s: %w", node, err)
+		}
+		for _, cpu := range cpus {
+			ch <- c.cpuInfo.mustNewConstMetric(1.0, strconv.Itoa(cpu), node)
+		}
+
+		stats, err := readNUMAStat(filepath.Join(path, "numastat"))
+		if err != nil {
+			return fmt.Errorf("failed to read numastat of NUMA node %s: %w", node, err)
+		}
+		for name, value := range stats {
+			ch <- c.stat.mustNewConstMetric(value, node, name)
+		}
+
+		if err := c.updateDistances(ch, path, node); err != nil {
+			return err
+		}
+		if err := c.updateHugepages(ch, path, node); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateDistances exposes a row of the distance matrix. The n-th distance is
+// to the n-th online node, which isn't necessarily node n.
+func (c *numaCollector) updateDistances(ch chan<- prometheus.Metric, path, node string) error {
+	data, err := ioutil.ReadFile(filepath.Join(path, "distance"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read distances of NUMA node %s: %w", node, err)
+	}
+	online, err := ioutil.ReadFile(sysFilePath("devices/system/node/online"))
+	if err != nil {
+		return fmt.Errorf("failed to read online NUMA nodes: %w", err)
+	}
+	targets, err := parseCPUList(strings.TrimSpace(string(online)))
+	if err != nil {
+		return fmt.Errorf("invalid list of online NUMA nodes: %w", err)
+	}
+
+	distances := strings.Fields(string(data))
+	if len(distances) != len(targets) {
+		return fmt.Errorf("NUMA node %s has %d distances for %d online nodes", node, len(distances), len(targets))
+	}
+	for i, d := range distances {
+		value, err := strconv.ParseFloat(d, 64)
+		if err != nil {
+			return fmt.Errorf("invalid distance of NUMA node %s: %w", node, err)
+		}
+		ch <- c.distance.mustNewConstMetric(value, node, strconv.Itoa(targets[i]))
+	}
+	return nil
+}
+
+func (c *numaCollector) updateHugepages(ch chan<- prometheus.Metric, path, node string) error {
+	pools, err := filepath.Glob(filepath.Join(path, "hugepages", "hugepages-*kB"))
+	if err != nil {
+		return err
+	}
+	for _, pool := range pools {
+		size, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(filepath.Base(pool), "hugepages-"), "kB"), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid huge page pool %s: %w", pool, err)
+		}
+		sizeBytes := strconv.FormatUint(size*1024, 10)
+		for desc, file := range map[*typedDesc]string{
+			&c.hugepages:        "nr_hugepages",
+			&c.hugepagesFree:    "free_hugepages",
+			&c.hugepagesSurplus: "surplus_hugepages",
+		} {
+			value, err := readUintFromFile(filepath.Join(pool, file))
+			if err != nil {
+				return fmt.Errorf("failed to read huge pages of NUMA node %s: %w", node, err)
+			}
+			ch <- desc.mustNewConstMetric(float64(value), node, sizeBytes)
+		}
+	}
+	return nil
+}
+
+func readNUMAStat(path string) (map[string]float64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	stats := make(map[string]float64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		value, err := strconv.ParseFloat(fields[1], 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in %s: %w", path, err)
+		}
+		stats[fields[0]] = value
+	}
+	return stats, scanner.Err()
+}
+
+// parseCPUList parses lists in the kernel's list format like "0-3,8,10-11".
+func parseCPUList(list string) ([]int, error) {
+	var cpus []int
+	if list == "" {
+		return cpus, nil
+	}
+	for _, r := range strings.Split(list, ",") {
+		bounds := strings.SplitN(r, "-", 2)
+		first, err := strconv.Atoi(bounds[0])
+		if err != nil {
+			return nil, err
+		}
+		last := first
+		if len(bounds) == 2 {
+			if last, err = strconv.Atoi(bounds[1]); err != nil {
+				return nil, err
+			}
+		}
+		if last < first {
+			return nil, fmt.Errorf("invalid range %q", r)
+		}
+		for cpu := first; cpu <= last; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
@@ -0,0 +1,110 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nonuma
+// +build !nonuma
+
+package collector
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestParseCPUList(t *testing.T) {
+	for list, want := range map[string][]int{
+		"":            nil,
+		"0":           {0},
+		"0-3":         {0, 1, 2, 3},
+		"0-1,8,10-11": {0, 1, 8, 10, 11},
+	} {
+		got, err := parseCPUList(list)
+		if err != nil {
+			t.Errorf("%q: %v", list, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: want %v, got %v", list, want, got)
+		}
+	}
+	for _, list := range []string{"a", "3-1", "0-"} {
+		if _, err := parseCPUList(list); err == nil {
+			t.Errorf("%q: expected error", list)
+		}
+	}
+}
+
+func TestNUMACollector(t *testing.T) {
+	defer func(path string) { *sysPath = path }(*sysPath)
+	*sysPath = "fixtures/sys"
+
+	c, err := NewNUMACollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP node_numa_cpu_info A metric with a constant '1' value labeled by cpu and the NUMA node it belongs to.
+# TYPE node_numa_cpu_info gauge
+node_numa_cpu_info{cpu="0",node="0"} 1
+node_numa_cpu_info{cpu="1",node="0"} 1
+node_numa_cpu_info{cpu="2",node="1"} 1
+node_numa_cpu_info{cpu="3",node="1"} 1
+# HELP node_numa_distance Relative distance of memory accesses from a NUMA node to a target node, as reported by the firmware. Accesses to the local node have a distance of 10.
+# TYPE node_numa_distance gauge
+node_numa_distance{node="0",target="0"} 10
+node_numa_distance{node="0",target="1"} 21
+node_numa_distance{node="0",target="2"} 31
+node_numa_distance{node="1",target="0"} 21
+node_numa_distance{node="1",target="1"} 10
+node_numa_distance{node="1",target="2"} 21
+node_numa_distance{node="2",target="0"} 31
+node_numa_distance{node="2",target="1"} 21
+node_numa_distance{node="2",target="2"} 10
+# HELP node_numa_hugepages_free Number of free huge pages in the pool of a NUMA node.
+# TYPE node_numa_hugepages_free gauge
+node_numa_hugepages_free{node="0",size_bytes="1073741824"} 1
+node_numa_hugepages_free{node="0",size_bytes="2097152"} 128
+node_numa_hugepages_free{node="1",size_bytes="1073741824"} 0
+node_numa_hugepages_free{node="1",size_bytes="2097152"} 500
+# HELP node_numa_stat_pages_total Number of pages allocated by type of allocation from numastat, e.g. numa_hit, numa_miss or numa_foreign.
+# TYPE node_numa_stat_pages_total counter
+node_numa_stat_pages_total{node="0",type="interleave_hit"} 57146
+node_numa_stat_pages_total{node="0",type="local_node"} 1.93454780853e+11
+node_numa_stat_pages_total{node="0",type="numa_foreign"} 5.98586233e+10
+node_numa_stat_pages_total{node="0",type="numa_hit"} 1.93460335812e+11
+node_numa_stat_pages_total{node="0",type="numa_miss"} 1.2624528e+07
+node_numa_stat_pages_total{node="0",type="other_node"} 1.8179487e+07
+node_numa_stat_pages_total{node="1",type="interleave_hit"} 57286
+node_numa_stat_pages_total{node="1",type="local_node"} 3.2671904655e+11
+node_numa_stat_pages_total{node="1",type="numa_foreign"} 1.2624528e+07
+node_numa_stat_pages_total{node="1",type="numa_hit"} 3.26720946761e+11
+node_numa_stat_pages_total{node="1",type="numa_miss"} 5.9858626709e+10
+node_numa_stat_pages_total{node="1",type="other_node"} 5.986052692e+10
+node_numa_stat_pages_total{node="2",type="interleave_hit"} 7286
+node_numa_stat_pages_total{node="2",type="local_node"} 2.671904655e+10
+node_numa_stat_pages_total{node="2",type="numa_foreign"} 2.624528e+06
+node_numa_stat_pages_total{node="2",type="numa_hit"} 2.6720946761e+10
+node_numa_stat_pages_total{node="2",type="numa_miss"} 9.858626709e+09
+node_numa_stat_pages_total{node="2",type="other_node"} 9.86052692e+09
+`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+	err = testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"node_numa_cpu_info", "node_numa_distance", "node_numa_hugepages_free", "node_numa_stat_pages_total")
+	if err != nil {
+		t.Error(err)
+	}
+}
@@ -28,6 +28,16 @@ var (
 	rootfsPath = kingpin.Flag("path.rootfs", "rootfs mountpoint.").Default("/").String()
 )
 
+// ProcPath returns the procfs mountpoint the collectors read from.
+func ProcPath() string {
+	return *procPath
+}
+
+// SysPath returns the sysfs mountpoint the collectors read from.
+func SysPath() string {
+	return *sysPath
+}
+
 func procFilePath(name string) string {
 	return filepath.Join(*procPath, name)
 }
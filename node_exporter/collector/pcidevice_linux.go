@@ -0,0 +1,274 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nopcidevice
+// +build !nopcidevice
+
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const pciDeviceSubsystem = "pcidevice"
+
+type pciDeviceCollector struct {
+	info             typedDesc
+	currentLinkSpeed typedDesc
+	maxLinkSpeed     typedDesc
+	currentLinkWidth typedDesc
+	maxLinkWidth     typedDesc
+	aerErrors        typedDesc
+	logger           log.Logger
+}
+
+// pciDevice holds the sysfs attributes of a PCI device.
+type pciDevice struct {
+	address          string
+	vendor           string
+	device           string
+	subsystemVendor  string
+	subsystemDevice  string
+	class            string
+	driver           string
+	currentLinkSpeed *float64 // in transfers per second
+	maxLinkSpeed     *float64 // in transfers per second
+	currentLinkWidth *float64
+	maxLinkWidth     *float64
+	aerErrors        map[string]map[string]uint64 // by severity and error
+}
+
+func init() {
+	registerCollector("pcidevice", defaultDisabled, NewPCIDeviceCollector)
+}
+
+// NewPCIDeviceCollector returns a new Collector exposing PCI device
+// information, link status and AER error counters.
+func NewPCIDeviceCollector(logger log.Logger) (Collector, error) {
+	labels := []string{"address"}
+	return &pciDeviceCollector{
+		info: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, pciDeviceSubsystem, "info"),
+			"A metric with a constant '1' value labeled by address, vendor_id, device_id, subsystem_vendor_id, subsystem_device_id, class_id and driver of a PCI device.",
+			[]string{"address", "vendor_id", "device_id", "subsystem_vendor_id", "subsystem_device_id", "class_id", "driver"}, nil,
+		), prometheus.GaugeValue},
+		currentLinkSpeed: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, pciDeviceSubsystem, "current_link_transfers_per_second"),
+			"Negotiated PCIe link speed in transfers per second per lane.",
+			labels, nil,
+		), prometheus.GaugeValue},
+		maxLinkSpeed: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, pciDeviceSubsystem, "max_link_transfers_per_second"),
+			"Maximum PCIe link speed in transfers per second per lane.",
+			labels, nil,
+		), prometheus.GaugeValue},
+		currentLinkWidth: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, pciDeviceSubsystem, "current_link_width"),
+			"Negotiated number of PCIe lanes.",
+			labels, nil,
+		), prometheus.GaugeValue},
+		maxLinkWidth: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, pciDeviceSubsystem, "max_link_width"),
+			"Maximum number of PCIe lanes.",
+			labels, nil,
+		), prometheus.GaugeValue},
+		aerErrors: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, pciDeviceSubsystem, "aer_errors_total"),
+			"Number of PCIe Advanced Error Reporting errors by severity and error type.",
+			[]string{"address", "severity", "error"}, nil,
+		), prometheus.CounterValue},
+		logger: logger,
+	}, nil
+}
+
+// Update implements Collector.
+func (c *pciDeviceCollector) Update(ch chan<- prometheus.Metric) error {
+	devices, err := readPCIDevices(sysFilePath("bus/pci/devices"), c.logger)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "Not collecting PCI devices, directory does not exist", "err", err)
+			return ErrNoData
+		}
+		return fmt.Errorf("failed to read PCI devices: %w", err)
+	}
+
+	for _, d := range devices {
+		ch <- c.info.mustNewConstMetric(1.0, d.address, d.vendor, d.device, d.subsystemVendor, d.subsystemDevice, d.class, d.driver)
+		for desc, value := range map[*typedDesc]*float64{
+			&c.currentLinkSpeed: d.currentLinkSpeed,
+			&c.maxLinkSpeed:     d.maxLinkSpeed,
+			&c.currentLinkWidth: d.currentLinkWidth,
+			&c.maxLinkWidth:     d.maxLinkWidth,
+		} {
+			if value != nil {
+				ch <- desc.mustNewConstMetric(*value, d.address)
+			}
+		}
+		for severity, errs := range d.aerErrors {
+			for name, value := range errs {
+				ch <- c.aerErrors.mustNewConstMetric(float64(value), d.address, severity, name)
+			}
+		}
+	}
+	return nil
+}
+
+// readPCIDevices reads all PCI devices below the given sysfs directory,
+// usually /sys/bus/pci/devices. Devices which can't be read, e.g. because
+// they were just removed, are skipped.
+func readPCIDevices(root string, logger log.Logger) ([]pciDevice, error) {
+	entries, err := ioutil.ReadDir(root)
+	if err != nil {
+		return nil, err
+	}
+
+	devices := make([]pciDevice, 0, len(entries))
+	for _, entry := range entries {
+		d, err := readPCIDevice(filepath.Join(root, entry.Name()))
+		if err != nil {
+			level.Debug(logger).Log("msg", "Skipping PCI device", "device", entry.Name(), "err", err)
+			continue
+		}
+		d.address = entry.Name()
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+func readPCIDevice(path string) (pciDevice, error) {
+	var (
+		d   pciDevice
+		err error
+	)
+	for _, attr := range []struct {
+		name  string
+		value *string
+	}{
+		{"vendor", &d.vendor},
+		{"device", &d.device},
+		{"subsystem_vendor", &d.subsystemVendor},
+		{"subsystem_device", &d.subsystemDevice},
+		{"class", &d.class},
+	} {
+		*attr.value, err = readPCIAttribute(path, attr.name)
+		if err != nil {
+			return d, err
+		}
+	}
+
+	if driver, err := os.Readlink(filepath.Join(path, "driver")); err == nil {
+		d.driver = filepath.Base(driver)
+	}
+
+	// Link attributes only exist for PCIe devices, and may contain "Unknown"
+	// if the link is down.
+	if value, err := readPCIAttribute(path, "current_link_speed"); err == nil {
+		d.currentLinkSpeed = parsePCILinkSpeed(value)
+	}
+	if value, err := readPCIAttribute(path, "max_link_speed"); err == nil {
+		d.maxLinkSpeed = parsePCILinkSpeed(value)
+	}
+	if value, err := readPCIAttribute(path, "current_link_width"); err == nil {
+		d.currentLinkWidth = parsePCILinkWidth(value)
+	}
+	if value, err := readPCIAttribute(path, "max_link_width"); err == nil {
+		d.maxLinkWidth = parsePCILinkWidth(value)
+	}
+
+	for severity, file := range map[string]string{
+		"correctable": "aer_dev_correctable",
+		"fatal":       "aer_dev_fatal",
+		"nonfatal":    "aer_dev_nonfatal",
+	} {
+		errs, err := readPCIAERErrors(filepath.Join(path, file))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return d, err
+		}
+		if d.aerErrors == nil {
+			d.aerErrors = make(map[string]map[string]uint64)
+		}
+		d.aerErrors[severity] = errs
+	}
+	return d, nil
+}
+
+func readPCIAttribute(path, name string) (string, error) {
+	data, err := ioutil.ReadFile(filepath.Join(path, name))
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// parsePCILinkSpeed parses link speeds like "8.0 GT/s PCIe" or "5 GT/s".
+func parsePCILinkSpeed(value string) *float64 {
+	fields := strings.Fields(value)
+	if len(fields) < 2 || fields[1] != "GT/s" {
+		return nil
+	}
+	speed, err := strconv.ParseFloat(fields[0], 64)
+	if err != nil {
+		return nil
+	}
+	speed *= 1e9
+	return &speed
+}
+
+func parsePCILinkWidth(value string) *float64 {
+	width, err := strconv.ParseFloat(value, 64)
+	if err != nil || width == 0 || width == 255 {
+		// A width of 0 or 255 means the link is down or the width unknown.
+		return nil
+	}
+	return &width
+}
+
+// readPCIAERErrors parses an AER statistics file, which consists of lines
+// with an error name and its count. The TOTAL_* lines are skipped, they are
+// the sum of the other lines.
+func readPCIAERErrors(path string) (map[string]uint64, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	errs := make(map[string]uint64)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 || strings.HasPrefix(fields[0], "TOTAL_") {
+			continue
+		}
+		value, err := strconv.ParseUint(fields[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("invalid value in %s: %w", path, err)
+		}
+		errs[fields[0]] = value
+	}
+	return errs, scanner.Err()
+}
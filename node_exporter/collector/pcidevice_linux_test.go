@@ -0,0 +1,109 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nopcidevice
+// +build !nopcidevice
+
+package collector
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-kit/log"
+)
+
+func TestParsePCILink(t *testing.T) {
+	for value, want := range map[string]float64{
+		"8.0 GT/s PCIe": 8e9,
+		"2.5 GT/s":      2.5e9,
+		"16 GT/s PCIe":  16e9,
+		"Unknown":       -1,
+		"":              -1,
+	} {
+		got := parsePCILinkSpeed(value)
+		if (got == nil) != (want < 0) || (got != nil && *got != want) {
+			t.Errorf("link speed %q: want %v, got %v", value, want, got)
+		}
+	}
+	for value, want := range map[string]float64{
+		"8":   8,
+		"1":   1,
+		"0":   -1,
+		"255": -1,
+	} {
+		got := parsePCILinkWidth(value)
+		if (got == nil) != (want < 0) || (got != nil && *got != want) {
+			t.Errorf("link width %q: want %v, got %v", value, want, got)
+		}
+	}
+}
+
+func TestReadPCIDevices(t *testing.T) {
+	devices, err := readPCIDevices("fixtures/sys/bus/pci/devices", log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 2 {
+		t.Fatalf("want 2 devices, got %d", len(devices))
+	}
+
+	nic := devices[1]
+	if nic.address != "0000:03:00.0" || nic.driver != "igb" || nic.class != "0x020000" {
+		t.Errorf("unexpected device %+v", nic)
+	}
+	if got := nic.aerErrors["correctable"]["RxErr"]; got != 3 {
+		t.Errorf("want 3 correctable RxErr errors, got %d", got)
+	}
+	if _, ok := nic.aerErrors["correctable"]["TOTAL_ERR_COR"]; ok {
+		t.Error("TOTAL_ERR_COR should be skipped")
+	}
+	if devices[0].aerErrors != nil {
+		t.Errorf("want no AER errors for %s, got %v", devices[0].address, devices[0].aerErrors)
+	}
+}
+
+func TestReadPCIDevicesSkipsUnreadable(t *testing.T) {
+	root, err := ioutil.TempDir("", "pcidevice")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	// The second device lacks its attributes, as if it was being removed.
+	for _, address := range []string{"0000:00:00.0", "0000:01:00.0"} {
+		if err := os.Mkdir(filepath.Join(root, address), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for name, value := range map[string]string{
+		"vendor":           "0x8086",
+		"device":           "0x1237",
+		"subsystem_vendor": "0x0000",
+		"subsystem_device": "0x0000",
+		"class":            "0x060000",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, "0000:00:00.0", name), []byte(value+"\n"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	devices, err := readPCIDevices(root, log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(devices) != 1 || devices[0].address != "0000:00:00.0" {
+		t.Errorf("want only device 0000:00:00.0, got %+v", devices)
+	}
+}
@@ -0,0 +1,242 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bufio"
+	"os"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// profileSamples is the number of recent scrapes kept per collector.
+const profileSamples = 100
+
+var (
+	profilingEnabled bool
+	profileBuckets   = prometheus.DefBuckets
+
+	profilesMtx = sync.Mutex{}
+	profiles    = make(map[string]*collectorProfile)
+
+	// profileUpdateMtx makes profiled collectors run one at a time, so that
+	// the stop-the-world pauses of runtime.ReadMemStats don't pile up and
+	// the allocations of one collector don't count towards another.
+	profileUpdateMtx = sync.Mutex{}
+)
+
+// EnableProfiling makes every collector execution record its cost. It must be
+// called before the first scrape.
+func EnableProfiling() {
+	profilingEnabled = true
+}
+
+// CollectorProfile describes the cost of a collector over its recent scrapes.
+type CollectorProfile struct {
+	Name    string `json:"name"`
+	Scrapes uint64 `json:"scrapes"`
+	// Duration is a histogram of the durations of the recent scrapes.
+	Duration DurationHistogram `json:"duration_seconds"`
+	// Series is the number of series returned by the last scrape.
+	Series int `json:"series"`
+	// AllocatedBytes is the number of bytes allocated during the last scrape.
+	// This includes allocations of other goroutines of the exporter, like
+	// the HTTP handlers, and is only an upper bound.
+	AllocatedBytes uint64 `json:"allocated_bytes"`
+	// ReadSyscalls and ReadBytes are the number of read system calls and
+	// bytes read by the thread running the last scrape. They approximate the
+	// number of files read and are only available on Linux.
+	ReadSyscalls *uint64 `json:"read_syscalls,omitempty"`
+	ReadBytes    *uint64 `json:"read_bytes,omitempty"`
+}
+
+// DurationHistogram is a cumulative histogram of scrape durations.
+type DurationHistogram struct {
+	Count   int               `json:"count"`
+	Sum     float64           `json:"sum"`
+	Buckets []HistogramBucket `json:"buckets"`
+}
+
+// HistogramBucket is a single cumulative histogram bucket. The +Inf bucket is
+// omitted, its count equals the histogram count.
+type HistogramBucket struct {
+	UpperBound float64 `json:"le"`
+	Count      int     `json:"count"`
+}
+
+type collectorProfile struct {
+	durations []float64
+	next      int
+	scrapes   uint64
+	last      profileSample
+}
+
+// profileSample holds the cost of a single collector execution.
+type profileSample struct {
+	// duration excludes the time spent waiting for other profiled
+	// collectors.
+	duration   time.Duration
+	series     int
+	allocBytes uint64
+	threadIO   *threadIO
+}
+
+// Profiles returns the profiles of all collectors executed so far, sorted by
+// name.
+func Profiles() []CollectorProfile {
+	profilesMtx.Lock()
+	defer profilesMtx.Unlock()
+
+	result := make([]CollectorProfile, 0, len(profiles))
+	for name, p := range profiles {
+		cp := CollectorProfile{
+			Name:           name,
+			Scrapes:        p.scrapes,
+			Duration:       newDurationHistogram(p.durations, profileBuckets),
+			Series:         p.last.series,
+			AllocatedBytes: p.last.allocBytes,
+		}
+		if p.last.threadIO != nil {
+			syscr, rchar := p.last.threadIO.syscr, p.last.threadIO.rchar
+			cp.ReadSyscalls = &syscr
+			cp.ReadBytes = &rchar
+		}
+		result = append(result, cp)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func newDurationHistogram(durations []float64, buckets []float64) DurationHistogram {
+	h := DurationHistogram{
+		Count:   len(durations),
+		Buckets: make([]HistogramBucket, len(buckets)),
+	}
+	for i, b := range buckets {
+		h.Buckets[i].UpperBound = b
+	}
+	for _, d := range durations {
+		h.Sum += d
+		for i, b := range buckets {
+			if d <= b {
+				h.Buckets[i].Count++
+			}
+		}
+	}
+	return h
+}
+
+func recordProfile(name string, duration time.Duration, sample profileSample) {
+	profilesMtx.Lock()
+	defer profilesMtx.Unlock()
+
+	p, ok := profiles[name]
+	if !ok {
+		p = &collectorProfile{durations: make([]float64, 0, profileSamples)}
+		profiles[name] = p
+	}
+	if len(p.durations) < profileSamples {
+		p.durations = append(p.durations, duration.Seconds())
+	} else {
+		p.durations[p.next] = duration.Seconds()
+	}
+	p.next = (p.next + 1) % profileSamples
+	p.scrapes++
+	p.last = sample
+}
+
+// profileUpdate runs the Update method of the given collector and measures
+// its cost, after other profiled collectors finished. The calling goroutine
+// is locked to its thread, so that the I/O accounting of the thread can be
+// attributed to the collector.
+func profileUpdate(c Collector, ch chan<- prometheus.Metric) (profileSample, error) {
+	profileUpdateMtx.Lock()
+	defer profileUpdateMtx.Unlock()
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	var sample profileSample
+	var memBefore, memAfter runtime.MemStats
+	ioBefore, ioErr := readThreadIO()
+	runtime.ReadMemStats(&memBefore)
+	begin := time.Now()
+
+	counted := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for m := range counted {
+			sample.series++
+			ch <- m
+		}
+		close(done)
+	}()
+	err := c.Update(counted)
+	close(counted)
+	<-done
+	sample.duration = time.Since(begin)
+
+	runtime.ReadMemStats(&memAfter)
+	sample.allocBytes = memAfter.TotalAlloc - memBefore.TotalAlloc
+	if ioAfter, err := readThreadIO(); ioErr == nil && err == nil {
+		sample.threadIO = &threadIO{
+			syscr: ioAfter.syscr - ioBefore.syscr,
+			rchar: ioAfter.rchar - ioBefore.rchar,
+		}
+	}
+	return sample, err
+}
+
+type threadIO struct {
+	syscr uint64
+	rchar uint64
+}
+
+// readThreadIO reads the I/O accounting of the current thread. It always
+// reads the procfs of the node_exporter process itself, not the one
+// configured with --path.procfs.
+func readThreadIO() (*threadIO, error) {
+	f, err := os.Open("/proc/thread-self/io")
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var tio threadIO
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		parts := strings.SplitN(scanner.Text(), ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		value, err := strconv.ParseUint(strings.TrimSpace(parts[1]), 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		switch parts[0] {
+		case "syscr":
+			tio.syscr = value
+		case "rchar":
+			tio.rchar = value
+		}
+	}
+	return &tio, scanner.Err()
+}
@@ -0,0 +1,149 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"io/ioutil"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var profileTestDesc = prometheus.NewDesc("profile_test", "Test metric.", []string{"n"}, nil)
+
+type profileTestCollector struct{}
+
+func (profileTestCollector) Update(ch chan<- prometheus.Metric) error {
+	if _, err := ioutil.ReadFile("fixtures/proc/loadavg"); err != nil {
+		return err
+	}
+	for _, n := range []string{"a", "b", "c"} {
+		ch <- prometheus.MustNewConstMetric(profileTestDesc, prometheus.GaugeValue, 1, n)
+	}
+	return nil
+}
+
+func TestProfileExecute(t *testing.T) {
+	profilingEnabled = true
+	defer func() {
+		profilingEnabled = false
+		profiles = make(map[string]*collectorProfile)
+	}()
+
+	for i := 0; i < profileSamples+5; i++ {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			execute("profile_test", profileTestCollector{}, ch, log.NewNopLogger())
+			close(ch)
+		}()
+		var got int
+		for range ch {
+			got++
+		}
+		// Three metrics from the collector plus duration and success.
+		if got != 5 {
+			t.Fatalf("expected 5 metrics, got %d", got)
+		}
+	}
+
+	ps := Profiles()
+	if len(ps) != 1 {
+		t.Fatalf("expected 1 profile, got %d", len(ps))
+	}
+	p := ps[0]
+	if p.Name != "profile_test" {
+		t.Errorf("unexpected profile name %q", p.Name)
+	}
+	if p.Scrapes != profileSamples+5 {
+		t.Errorf("expected %d scrapes, got %d", profileSamples+5, p.Scrapes)
+	}
+	if p.Duration.Count != profileSamples {
+		t.Errorf("expected %d durations, got %d", profileSamples, p.Duration.Count)
+	}
+	if p.Series != 3 {
+		t.Errorf("expected 3 series, got %d", p.Series)
+	}
+	if p.ReadSyscalls != nil && *p.ReadSyscalls == 0 {
+		t.Errorf("expected read syscalls to be recorded")
+	}
+}
+
+func TestNewDurationHistogram(t *testing.T) {
+	h := newDurationHistogram([]float64{0.05, 0.2, 3}, []float64{0.1, 1})
+	if h.Count != 3 {
+		t.Errorf("expected count 3, got %d", h.Count)
+	}
+	if h.Sum != 3.25 {
+		t.Errorf("expected sum 3.25, got %f", h.Sum)
+	}
+	want := []HistogramBucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 1, Count: 2}}
+	for i, b := range want {
+		if h.Buckets[i] != b {
+			t.Errorf("bucket %d: want %+v, got %+v", i, b, h.Buckets[i])
+		}
+	}
+}
+
+// overlapTestCollector records how many of its instances run at the same time.
+type overlapTestCollector struct {
+	running, max *int32
+}
+
+func (c overlapTestCollector) Update(ch chan<- prometheus.Metric) error {
+	n := atomic.AddInt32(c.running, 1)
+	for {
+		max := atomic.LoadInt32(c.max)
+		if n <= max || atomic.CompareAndSwapInt32(c.max, max, n) {
+			break
+		}
+	}
+	time.Sleep(10 * time.Millisecond)
+	atomic.AddInt32(c.running, -1)
+	return nil
+}
+
+func TestProfileExecuteSerialized(t *testing.T) {
+	profilingEnabled = true
+	defer func() {
+		profilingEnabled = false
+		profiles = make(map[string]*collectorProfile)
+	}()
+
+	var running, max int32
+	c := overlapTestCollector{running: &running, max: &max}
+	wg := sync.WaitGroup{}
+	for _, name := range []string{"a", "b", "c", "d"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			ch := make(chan prometheus.Metric, 2)
+			execute(name, c, ch, log.NewNopLogger())
+		}(name)
+	}
+	wg.Wait()
+
+	if max != 1 {
+		t.Errorf("expected profiled collectors to run one at a time, %d ran concurrently", max)
+	}
+	for _, p := range Profiles() {
+		// The time spent waiting for the others is not part of the duration.
+		if p.Duration.Sum > 0.035 {
+			t.Errorf("%s: duration %fs includes waiting for other collectors", p.Name, p.Duration.Sum)
+		}
+	}
+}
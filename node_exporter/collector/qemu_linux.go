@@ -0,0 +1,356 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noqemu && !nonetdev
+// +build !noqemu,!nonetdev
+
+package collector
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs"
+)
+
+const qemuSubsystem = "qemu"
+
+var (
+	// qemuNetDevStats are the statistics of /proc/net/dev exposed for the
+	// tap interfaces of a VM.
+	qemuNetDevStats = []string{
+		"receive_bytes", "receive_packets", "receive_drop",
+		"transmit_bytes", "transmit_packets", "transmit_drop",
+	}
+
+	// qemuKVMStats are the per-VM files in the kvm debugfs directory,
+	// and the metric and scale they are exposed with.
+	qemuKVMStats = []struct {
+		file   string
+		metric string
+		help   string
+		scale  float64
+	}{
+		{"halt_attempted_poll", "kvm_halt_attempted_polls_total", "Number of times a vCPU of the VM polled before halting.", 1},
+		{"halt_successful_poll", "kvm_halt_successful_polls_total", "Number of times polling before halting found a wakeup event.", 1},
+		{"halt_wakeup", "kvm_halt_wakeups_total", "Number of times a halted vCPU of the VM was woken up.", 1},
+		{"halt_poll_success_ns", "kvm_halt_poll_success_seconds_total", "Time vCPUs of the VM spent in successful polls before halting.", 1e-9},
+		{"halt_poll_fail_ns", "kvm_halt_poll_fail_seconds_total", "Time vCPUs of the VM spent in failed polls before halting.", 1e-9},
+	}
+)
+
+type qemuCollector struct {
+	info      typedDesc
+	vcpuTime  typedDesc
+	vcpuWait  typedDesc
+	rss       typedDesc
+	netDev    map[string]*typedDesc
+	kvm       map[string]*typedDesc
+	netFilter netDevFilter
+	logger    log.Logger
+}
+
+// qemuVM is a running qemu process.
+type qemuVM struct {
+	name string
+	proc procfs.Proc
+	ifs  []string
+}
+
+func init() {
+	registerCollector("qemu", defaultDisabled, NewQEMUCollector)
+}
+
+// NewQEMUCollector returns a new Collector exposing statistics of qemu
+// virtual machines, discovered from the running processes.
+func NewQEMUCollector(logger log.Logger) (Collector, error) {
+	c := &qemuCollector{
+		info: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, qemuSubsystem, "vm_info"),
+			"A metric with a constant '1' value labeled by the name and process ID of a qemu virtual machine.",
+			[]string{"vm", "pid"}, nil,
+		), prometheus.GaugeValue},
+		vcpuTime: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, qemuSubsystem, "vcpu_seconds_total"),
+			"Host CPU time spent running a vCPU thread, only available if qemu runs with -name debug-threads=on.",
+			[]string{"vm", "vcpu"}, nil,
+		), prometheus.CounterValue},
+		vcpuWait: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, qemuSubsystem, "vcpu_wait_seconds_total"),
+			"Time a vCPU thread was runnable but waiting for a host CPU, seen as steal time by the guest, only available if qemu runs with -name debug-threads=on.",
+			[]string{"vm", "vcpu"}, nil,
+		), prometheus.CounterValue},
+		rss: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, qemuSubsystem, "memory_rss_bytes"),
+			"Resident set size of the qemu process.",
+			[]string{"vm"}, nil,
+		), prometheus.GaugeValue},
+		netDev:    make(map[string]*typedDesc, len(qemuNetDevStats)),
+		kvm:       make(map[string]*typedDesc, len(qemuKVMStats)),
+		netFilter: newNetDevFilter("", ""),
+		logger:    logger,
+	}
+	for _, stat := range qemuNetDevStats {
+		c.netDev[stat] = &typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, qemuSubsystem, "network_"+stat+"_total"),
+			fmt.Sprintf("Network device statistic %s of a tap interface of the VM, from the perspective of the host.", stat),
+			[]string{"vm", "device"}, nil,
+		), prometheus.CounterValue}
+	}
+	for _, stat := range qemuKVMStats {
+		c.kvm[stat.file] = &typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, qemuSubsystem, stat.metric),
+			stat.help,
+			[]string{"vm"}, nil,
+		), prometheus.CounterValue}
+	}
+	return c, nil
+}
+
+// Update implements Collector.
+func (c *qemuCollector) Update(ch chan<- prometheus.Metric) error {
+	fs, err := procfs.NewFS(*procPath)
+	if err != nil {
+		return fmt.Errorf("failed to open procfs: %w", err)
+	}
+	vms, err := c.findVMs(fs)
+	if err != nil {
+		return err
+	}
+	if len(vms) == 0 {
+		return nil
+	}
+
+	netDev, err := getNetDevStats(&c.netFilter, c.logger)
+	if err != nil {
+		return fmt.Errorf("couldn't get netstats: %w", err)
+	}
+
+	for _, vm := range vms {
+		ch <- c.info.mustNewConstMetric(1.0, vm.name, strconv.Itoa(vm.proc.PID))
+
+		stat, err := vm.proc.Stat()
+		if err != nil {
+			// The VM has been shut down since it was found.
+			level.Debug(c.logger).Log("msg", "failed to read qemu process stat", "vm", vm.name, "err", err)
+			continue
+		}
+		ch <- c.rss.mustNewConstMetric(float64(stat.ResidentMemory()), vm.name)
+
+		if err := c.updateVCPUs(ch, vm); err != nil {
+			level.Debug(c.logger).Log("msg", "failed to read qemu vCPU threads", "vm", vm.name, "err", err)
+		}
+
+		for _, ifname := range vm.ifs {
+			stats, ok := netDev[ifname]
+			if !ok {
+				continue
+			}
+			for _, stat := range qemuNetDevStats {
+				if value, ok := stats[stat]; ok {
+					ch <- c.netDev[stat].mustNewConstMetric(float64(value), vm.name, ifname)
+				}
+			}
+		}
+
+		c.updateKVM(ch, vm)
+	}
+	return nil
+}
+
+// findVMs returns the running qemu processes, named after their -name
+// argument or their PID if they have none.
+func (c *qemuCollector) findVMs(fs procfs.FS) ([]qemuVM, error) {
+	procs, err := fs.AllProcs()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list processes: %w", err)
+	}
+
+	var vms []qemuVM
+	names := make(map[string]struct{})
+	for _, p := range procs {
+		cmdline, err := p.CmdLine()
+		if err != nil || len(cmdline) == 0 || !isQEMUBinary(cmdline[0]) {
+			continue
+		}
+		name, ifs := parseQEMUCmdLine(cmdline)
+		if name == "" {
+			name = strconv.Itoa(p.PID)
+		}
+		if _, ok := names[name]; ok {
+			level.Debug(c.logger).Log("msg", "ignoring qemu process with duplicate VM name", "vm", name, "pid", p.PID)
+			continue
+		}
+		names[name] = struct{}{}
+
+		// Tap devices opened by a management tool and passed to qemu
+		// as file descriptors aren't named on the command line.
+		tuns, err := readTunInterfaces(filepath.Join(*procPath, strconv.Itoa(p.PID), "fdinfo"))
+		if err != nil {
+			level.Debug(c.logger).Log("msg", "failed to read qemu file descriptors", "vm", name, "err", err)
+		}
+		for _, tun := range tuns {
+			if !containsString(ifs, tun) {
+				ifs = append(ifs, tun)
+			}
+		}
+		sort.Strings(ifs)
+		vms = append(vms, qemuVM{name: name, proc: p, ifs: ifs})
+	}
+	return vms, nil
+}
+
+func (c *qemuCollector) updateVCPUs(ch chan<- prometheus.Metric, vm qemuVM) error {
+	// Threads are read through a procfs rooted at /proc/<pid>/task, as
+	// they aren't listed in /proc.
+	fs, err := procfs.NewFS(filepath.Join(*procPath, strconv.Itoa(vm.proc.PID), "task"))
+	if err != nil {
+		return err
+	}
+	threads, err := fs.AllProcs()
+	if err != nil {
+		return err
+	}
+	found := false
+	for _, thread := range threads {
+		comm, err := thread.Comm()
+		if err != nil {
+			continue
+		}
+		// qemu names vCPU threads like "CPU 0/KVM".
+		var vcpu int
+		if _, err := fmt.Sscanf(comm, "CPU %d/KVM", &vcpu); err != nil {
+			continue
+		}
+		found = true
+		stat, err := thread.Stat()
+		if err != nil {
+			continue
+		}
+		ch <- c.vcpuTime.mustNewConstMetric(stat.CPUTime(), vm.name, strconv.Itoa(vcpu))
+
+		schedstat, err := thread.Schedstat()
+		if err != nil {
+			continue
+		}
+		ch <- c.vcpuWait.mustNewConstMetric(float64(schedstat.WaitingNanoseconds)/1e9, vm.name, strconv.Itoa(vcpu))
+	}
+	if !found {
+		level.Debug(c.logger).Log("msg", "no qemu vCPU threads found, qemu only names them when started with -name debug-threads=on", "vm", vm.name)
+	}
+	return nil
+}
+
+// updateKVM exposes the halt polling statistics of the kvm debugfs, which is
+// usually only readable by root. Its VM directories are named <pid>-<fd>.
+func (c *qemuCollector) updateKVM(ch chan<- prometheus.Metric, vm qemuVM) {
+	dirs, err := filepath.Glob(sysFilePath(fmt.Sprintf("kernel/debug/kvm/%d-*", vm.proc.PID)))
+	if err != nil || len(dirs) == 0 {
+		return
+	}
+	for _, stat := range qemuKVMStats {
+		value, err := readUintFromFile(filepath.Join(dirs[0], stat.file))
+		if err != nil {
+			if !errors.Is(err, os.ErrNotExist) {
+				level.Debug(c.logger).Log("msg", "failed to read kvm statistic", "vm", vm.name, "file", stat.file, "err", err)
+			}
+			continue
+		}
+		ch <- c.kvm[stat.file].mustNewConstMetric(float64(value)*stat.scale, vm.name)
+	}
+}
+
+func isQEMUBinary(path string) bool {
+	base := filepath.Base(path)
+	return strings.HasPrefix(base, "qemu-system-") || base == "qemu-kvm"
+}
+
+// parseQEMUCmdLine returns the VM name given with -name, which is either
+// "name" or "guest=name" followed by more options, and the tap interfaces
+// given with -netdev tap,ifname=... or -net tap,ifname=....
+func parseQEMUCmdLine(cmdline []string) (string, []string) {
+	var (
+		name string
+		ifs  []string
+	)
+	for i := 1; i < len(cmdline)-1; i++ {
+		arg, value := strings.TrimPrefix(cmdline[i], "-"), cmdline[i+1]
+		switch arg {
+		case "-name", "name":
+			for j, opt := range strings.Split(value, ",") {
+				if strings.HasPrefix(opt, "guest=") {
+					name = strings.TrimPrefix(opt, "guest=")
+					break
+				}
+				if j == 0 && !strings.Contains(opt, "=") {
+					name = opt
+				}
+			}
+		case "-netdev", "netdev", "-net", "net":
+			opts := strings.Split(value, ",")
+			if opts[0] != "tap" {
+				continue
+			}
+			for _, opt := range opts[1:] {
+				if strings.HasPrefix(opt, "ifname=") {
+					ifs = append(ifs, strings.TrimPrefix(opt, "ifname="))
+				}
+			}
+		}
+	}
+	return name, ifs
+}
+
+// readTunInterfaces returns the tun/tap interfaces attached to the file
+// descriptors of a process, which the kernel shows as "iff:" in their fdinfo.
+func readTunInterfaces(dir string) ([]string, error) {
+	fds, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var ifs []string
+	for _, fd := range fds {
+		f, err := os.Open(filepath.Join(dir, fd.Name()))
+		if err != nil {
+			continue
+		}
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			fields := strings.Fields(scanner.Text())
+			if len(fields) == 2 && fields[0] == "iff:" {
+				ifs = append(ifs, fields[1])
+			}
+		}
+		f.Close()
+	}
+	return ifs, nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,166 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !noqemu && !nonetdev
+// +build !noqemu,!nonetdev
+
+package collector
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/prometheus/procfs"
+)
+
+func TestParseQEMUCmdLine(t *testing.T) {
+	for _, tc := range []struct {
+		cmdline []string
+		name    string
+		ifs     []string
+	}{
+		{
+			cmdline: []string{"qemu-system-x86_64", "-name", "guest=db1,debug-threads=on", "-netdev", "tap,id=n0,ifname=tap0", "-netdev", "user,id=n1"},
+			name:    "db1",
+			ifs:     []string{"tap0"},
+		},
+		{
+			cmdline: []string{"qemu-system-aarch64", "--name", "db2,process=qemu:db2", "-net", "tap,ifname=tap1,script=no", "-netdev", "tap,id=n1,fd=23"},
+			name:    "db2",
+			ifs:     []string{"tap1"},
+		},
+		{
+			cmdline: []string{"qemu-kvm", "-m", "1024"},
+		},
+	} {
+		name, ifs := parseQEMUCmdLine(tc.cmdline)
+		if name != tc.name || !reflect.DeepEqual(ifs, tc.ifs) {
+			t.Errorf("%v: want %q %v, got %q %v", tc.cmdline, tc.name, tc.ifs, name, ifs)
+		}
+	}
+}
+
+func TestQEMUCollector(t *testing.T) {
+	defer func(sys, proc string) {
+		*sysPath = sys
+		*procPath = proc
+	}(*sysPath, *procPath)
+	*sysPath = "fixtures/qemu/sys"
+	*procPath = "fixtures/qemu/proc"
+
+	c, err := NewQEMUCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	pageSize := os.Getpagesize()
+	want := `# HELP node_qemu_kvm_halt_poll_success_seconds_total Time vCPUs of the VM spent in successful polls before halting.
+# TYPE node_qemu_kvm_halt_poll_success_seconds_total counter
+node_qemu_kvm_halt_poll_success_seconds_total{vm="web1"} 2.5
+# HELP node_qemu_kvm_halt_wakeups_total Number of times a halted vCPU of the VM was woken up.
+# TYPE node_qemu_kvm_halt_wakeups_total counter
+node_qemu_kvm_halt_wakeups_total{vm="web1"} 5000
+# HELP node_qemu_memory_rss_bytes Resident set size of the qemu process.
+# TYPE node_qemu_memory_rss_bytes gauge
+` + fmt.Sprintf(`node_qemu_memory_rss_bytes{vm="2000"} %d
+node_qemu_memory_rss_bytes{vm="web1"} %d
+`, 131072*pageSize, 262144*pageSize) + `# HELP node_qemu_network_receive_bytes_total Network device statistic receive_bytes of a tap interface of the VM, from the perspective of the host.
+# TYPE node_qemu_network_receive_bytes_total counter
+node_qemu_network_receive_bytes_total{device="tap0",vm="web1"} 1.5e+06
+node_qemu_network_receive_bytes_total{device="vnet3",vm="2000"} 64000
+# HELP node_qemu_network_transmit_drop_total Network device statistic transmit_drop of a tap interface of the VM, from the perspective of the host.
+# TYPE node_qemu_network_transmit_drop_total counter
+node_qemu_network_transmit_drop_total{device="tap0",vm="web1"} 1
+node_qemu_network_transmit_drop_total{device="vnet3",vm="2000"} 0
+# HELP node_qemu_vcpu_seconds_total Host CPU time spent running a vCPU thread, only available if qemu runs with -name debug-threads=on.
+# TYPE node_qemu_vcpu_seconds_total counter
+node_qemu_vcpu_seconds_total{vcpu="0",vm="2000"} 6
+node_qemu_vcpu_seconds_total{vcpu="0",vm="web1"} 123
+node_qemu_vcpu_seconds_total{vcpu="1",vm="web1"} 82
+# HELP node_qemu_vcpu_wait_seconds_total Time a vCPU thread was runnable but waiting for a host CPU, seen as steal time by the guest, only available if qemu runs with -name debug-threads=on.
+# TYPE node_qemu_vcpu_wait_seconds_total counter
+node_qemu_vcpu_wait_seconds_total{vcpu="0",vm="2000"} 0
+node_qemu_vcpu_wait_seconds_total{vcpu="0",vm="web1"} 4.5
+node_qemu_vcpu_wait_seconds_total{vcpu="1",vm="web1"} 1.5
+# HELP node_qemu_vm_info A metric with a constant '1' value labeled by the name and process ID of a qemu virtual machine.
+# TYPE node_qemu_vm_info gauge
+node_qemu_vm_info{pid="1000",vm="web1"} 1
+node_qemu_vm_info{pid="2000",vm="2000"} 1
+`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+	err = testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"node_qemu_kvm_halt_poll_success_seconds_total",
+		"node_qemu_kvm_halt_wakeups_total",
+		"node_qemu_memory_rss_bytes",
+		"node_qemu_network_receive_bytes_total",
+		"node_qemu_network_transmit_drop_total",
+		"node_qemu_vcpu_seconds_total",
+		"node_qemu_vcpu_wait_seconds_total",
+		"node_qemu_vm_info",
+	)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestQEMUVCPUsWithoutThreadNames(t *testing.T) {
+	defer func(proc string) { *procPath = proc }(*procPath)
+	dir, err := ioutil.TempDir("", "qemu")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	*procPath = dir
+
+	// Without debug-threads=on, vCPU threads keep the name of the process.
+	task := filepath.Join(dir, "4000/task/4001")
+	if err := os.MkdirAll(task, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(task, "comm"), []byte("qemu-kvm\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	fs, err := procfs.NewFS(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	proc, err := fs.Proc(4000)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var logs bytes.Buffer
+	c, err := NewQEMUCollector(log.NewLogfmtLogger(&logs))
+	if err != nil {
+		t.Fatal(err)
+	}
+	ch := make(chan prometheus.Metric, 10)
+	if err := c.(*qemuCollector).updateVCPUs(ch, qemuVM{name: "db1", proc: proc}); err != nil {
+		t.Fatal(err)
+	}
+	if len(ch) != 0 {
+		t.Errorf("want no vCPU metrics, got %d", len(ch))
+	}
+	if !strings.Contains(logs.String(), "debug-threads=on") {
+		t.Errorf("want the missing vCPU threads logged, got %q", logs.String())
+	}
+}
@@ -20,17 +20,52 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
 	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/procfs/sysfs"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
 
+var raplPowerInterval = kingpin.Flag(
+	"collector.rapl.power-interval",
+	"Minimum interval the RAPL power in watts is averaged over. More frequent scrapes, e.g. by several Prometheus servers, return the previous value.",
+).Default("10s").Duration()
+
+// raplMaxPlausibleWatts is far more power than a single RAPL zone uses.
+const raplMaxPlausibleWatts = 10000
+
 type raplCollector struct {
-	fs     sysfs.FS
-	logger log.Logger
+	fs       sysfs.FS
+	zoneInfo *prometheus.Desc
+	logger   log.Logger
+
+	// now returns the current time, it is replaced in tests.
+	now           func() time.Time
+	powerInterval time.Duration
+	mtx           sync.Mutex
+	zones         map[string]*raplZoneState
+}
+
+// raplZoneState tracks the energy counter of a zone between scrapes, to
+// handle its wraparound at max_energy_range_uj and compute the power.
+type raplZoneState struct {
+	raw         uint64
+	rawTime     time.Time
+	microjoules float64
+
+	// The power is averaged from powerMicrojoules at powerTime on, which
+	// only advance after the power interval.
+	powerMicrojoules float64
+	powerTime        time.Time
+	watts            float64
+	hasPower         bool
 }
 
 func init() {
@@ -46,8 +81,16 @@ func NewRaplCollector(logger log.Logger) (Collector, error) {
 	}
 
 	collector := raplCollector{
-		fs:     fs,
-		logger: logger,
+		fs: fs,
+		zoneInfo: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "rapl", "zone_info"),
+			"A metric with a constant '1' value labeled by the name and index of a RAPL zone and of its parent zone, if it is a subzone.",
+			[]string{"index", "path", "name", "parent_name", "parent_index"}, nil,
+		),
+		logger:        logger,
+		now:           time.Now,
+		powerInterval: *raplPowerInterval,
+		zones:         make(map[string]*raplZoneState),
 	}
 	return &collector, nil
 }
@@ -68,6 +111,16 @@ func (c *raplCollector) Update(ch chan<- prometheus.Metric) error {
 		return fmt.Errorf("failed to retrieve rapl stats: %w", err)
 	}
 
+	c.mtx.Lock()
+	defer c.mtx.Unlock()
+
+	now := c.now()
+	// Zones are identified by their directory, e.g. intel-rapl:0.
+	byDir := make(map[string]sysfs.RaplZone, len(zones))
+	for _, rz := range zones {
+		byDir[filepath.Base(rz.Path)] = rz
+	}
+
 	for _, rz := range zones {
 		newMicrojoules, err := rz.GetEnergyMicrojoules()
 		if err != nil {
@@ -85,13 +138,89 @@ func (c *raplCollector) Update(ch chan<- prometheus.Metric) error {
 			[]string{"index", "path"}, nil,
 		)
 
+		microjoules, watts, ok := c.observe(rz, newMicrojoules, now)
 		ch <- prometheus.MustNewConstMetric(
 			descriptor,
 			prometheus.CounterValue,
-			float64(newMicrojoules)/1000000.0,
+			microjoules/1000000.0,
 			index,
 			rz.Path,
 		)
+
+		if ok {
+			ch <- prometheus.MustNewConstMetric(
+				prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "rapl", rz.Name+"_watts"),
+					"Average RAPL "+rz.Name+" power in watts over at least the power interval before the last update",
+					[]string{"index", "path"}, nil,
+				),
+				prometheus.GaugeValue,
+				watts,
+				index,
+				rz.Path,
+			)
+		}
+
+		// Subzones like core, uncore and dram are named after their parent
+		// zone, e.g. intel-rapl:0:0 is a subzone of intel-rapl:0.
+		var parentName, parentIndex string
+		dir := filepath.Base(rz.Path)
+		if i := strings.LastIndex(dir, ":"); i > 0 {
+			if parent, ok := byDir[dir[:i]]; ok {
+				parentName, parentIndex = parent.Name, strconv.Itoa(parent.Index)
+			}
+		}
+		ch <- prometheus.MustNewConstMetric(c.zoneInfo, prometheus.GaugeValue, 1, index, rz.Path, rz.Name, parentName, parentIndex)
+	}
+
+	for dir := range c.zones {
+		if _, ok := byDir[dir]; !ok {
+			delete(c.zones, dir)
+		}
 	}
 	return nil
 }
+
+// observe records the raw energy counter of a zone and returns the energy
+// accumulated across wraparounds, in microjoules, as well as the average
+// power over at least the power interval, if that much time has passed since
+// the first observation. Averaging over a minimum interval instead of the time
+// since the previous observation keeps frequent scrapes, e.g. by several
+// Prometheus servers, from reporting the power over a few milliseconds.
+func (c *raplCollector) observe(rz sysfs.RaplZone, raw uint64, now time.Time) (float64, float64, bool) {
+	dir := filepath.Base(rz.Path)
+	state, ok := c.zones[dir]
+	if !ok {
+		c.zones[dir] = &raplZoneState{raw: raw, rawTime: now, microjoules: float64(raw), powerMicrojoules: float64(raw), powerTime: now}
+		return float64(raw), 0, false
+	}
+
+	delta := raw - state.raw
+	if raw < state.raw {
+		// The counter wrapped around, it counts up to max_energy_range_uj
+		// inclusive.
+		delta = rz.MaxMicrojoules - state.raw + raw + 1
+		// A counter reset, e.g. by reloading the driver, looks like a wrap
+		// with more energy than the zone can use in the meantime.
+		if float64(delta) > raplMaxPlausibleWatts*1000000.0*now.Sub(state.rawTime).Seconds() {
+			level.Debug(c.logger).Log("msg", "Discarding implausible RAPL energy counter decrease", "zone", dir, "previous", state.raw, "current", raw)
+			state.raw = raw
+			state.rawTime = now
+			state.powerMicrojoules = state.microjoules
+			state.powerTime = now
+			return state.microjoules, state.watts, state.hasPower
+		}
+	}
+	state.raw = raw
+	state.rawTime = now
+	state.microjoules += float64(delta)
+
+	elapsed := now.Sub(state.powerTime)
+	if elapsed > 0 && elapsed >= c.powerInterval {
+		state.watts = (state.microjoules - state.powerMicrojoules) / 1000000.0 / elapsed.Seconds()
+		state.powerMicrojoules = state.microjoules
+		state.powerTime = now
+		state.hasPower = true
+	}
+	return state.microjoules, state.watts, state.hasPower
+}
@@ -0,0 +1,139 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !norapl
+// +build !norapl
+
+package collector
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/procfs/sysfs"
+)
+
+func TestRaplWraparound(t *testing.T) {
+	defer func(path string) { *sysPath = path }(*sysPath)
+	*sysPath = "fixtures/rapl_wrap/1"
+
+	c, err := NewRaplCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rc := c.(*raplCollector)
+	now := time.Unix(1650000000, 0)
+	rc.now = func() time.Time { return now }
+	rc.powerInterval = 10 * time.Second
+
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectorAdapter{c})
+
+	for i, want := range []map[string]float64{
+		{
+			"node_rapl_package_joules_total": 262000,
+			"node_rapl_core_joules_total":    100000,
+			"node_rapl_dram_joules_total":    262143,
+		},
+		{
+			// The package counter wrapped around at max_energy_range_uj.
+			"node_rapl_package_joules_total": 263300,
+			"node_rapl_package_watts":        130,
+			"node_rapl_core_joules_total":    100900,
+			"node_rapl_core_watts":           90,
+			"node_rapl_dram_joules_total":    262143.15,
+			"node_rapl_dram_watts":           0.015,
+		},
+		{
+			// The dram counter wrapped around.
+			"node_rapl_package_joules_total": 264800,
+			"node_rapl_package_watts":        150,
+			"node_rapl_core_joules_total":    101800,
+			"node_rapl_core_watts":           90,
+			"node_rapl_dram_joules_total":    262293,
+			"node_rapl_dram_watts":           14.985,
+		},
+	} {
+		rc.fs, err = sysfs.NewFS(fmt.Sprintf("fixtures/rapl_wrap/%d", i+1))
+		if err != nil {
+			t.Fatal(err)
+		}
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got := make(map[string]float64)
+		for _, mf := range mfs {
+			for _, m := range mf.GetMetric() {
+				switch {
+				case m.GetCounter() != nil:
+					got[mf.GetName()] = m.GetCounter().GetValue()
+				case m.GetGauge() != nil:
+					got[mf.GetName()] = m.GetGauge().GetValue()
+				}
+			}
+		}
+		for name, value := range want {
+			if math.Abs(got[name]-value) > 1e-6 {
+				t.Errorf("scrape %d: want %s %v, got %v", i+1, name, value, got[name])
+			}
+		}
+		if _, ok := got["node_rapl_package_watts"]; ok && i == 0 {
+			t.Errorf("scrape %d: want no power before the second scrape", i+1)
+		}
+		now = now.Add(10 * time.Second)
+	}
+
+	// A scrape shortly after the previous one, e.g. by a second Prometheus
+	// server, keeps the power averaged over the power interval.
+	now = now.Add(-9 * time.Second)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		if mf.GetName() == "node_rapl_package_watts" {
+			if got := mf.GetMetric()[0].GetGauge().GetValue(); got != 150 {
+				t.Errorf("want package power 150 after a scrape within the power interval, got %v", got)
+			}
+		}
+	}
+
+	// The dram counter was reset, which is not mistaken for a wraparound.
+	now = now.Add(10 * time.Second)
+	rc.fs, err = sysfs.NewFS("fixtures/rapl_wrap/4")
+	if err != nil {
+		t.Fatal(err)
+	}
+	mfs, err = reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, mf := range mfs {
+		switch mf.GetName() {
+		case "node_rapl_dram_joules_total":
+			if got := mf.GetMetric()[0].GetCounter().GetValue(); got != 262293 {
+				t.Errorf("want dram energy 262293 after a counter reset, got %v", got)
+			}
+		case "node_rapl_package_joules_total":
+			if got := mf.GetMetric()[0].GetCounter().GetValue(); got != 264810 {
+				t.Errorf("want package energy 264810, got %v", got)
+			}
+		}
+	}
+}
@@ -0,0 +1,341 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+var (
+	ratesInterval = kingpin.Flag(
+		"collector.rates.interval",
+		"Interval at which the counters selected with --collector.rates.metric are sampled in the background. Use 0 to disable.",
+	).Default("0s").Duration()
+	ratesWindow = kingpin.Flag(
+		"collector.rates.window",
+		"Window the per-second rates are averaged over, usually the scrape interval.",
+	).Default("5m").Duration()
+	ratesMetrics = kingpin.Flag(
+		"collector.rates.metric",
+		"Counter whose per-second rate is exported as a gauge named like the counter with _per_second instead of _total (e.g. node_cpu_seconds_total). Can be repeated.",
+	).Strings()
+
+	// rates is the background sampler, started by the first NodeCollector.
+	rates *rateSampler
+)
+
+// startRateSampler starts the background sampler if rates are configured and
+// it doesn't run yet. The caller must hold initiatedCollectorsMtx.
+func startRateSampler(logger log.Logger) (*rateSampler, error) {
+	if rates != nil || (*ratesInterval == 0 && len(*ratesMetrics) == 0) {
+		return rates, nil
+	}
+	if *ratesInterval <= 0 {
+		return nil, errors.New("--collector.rates.metric requires a positive --collector.rates.interval")
+	}
+	if len(*ratesMetrics) == 0 {
+		return nil, errors.New("--collector.rates.interval requires at least one --collector.rates.metric")
+	}
+	if *ratesWindow < 2**ratesInterval {
+		return nil, errors.New("--collector.rates.window must be at least twice --collector.rates.interval")
+	}
+	for _, name := range *ratesMetrics {
+		if !model.IsValidMetricName(model.LabelValue(name)) {
+			return nil, fmt.Errorf("invalid metric name for rates: %q", name)
+		}
+	}
+
+	// Every enabled collector is a candidate, not only those of the
+	// NodeCollector at hand, which may be filtered.
+	collectors := make(map[string]Collector)
+	for key, enabled := range collectorState {
+		if !*enabled {
+			continue
+		}
+		c, err := initiateCollector(key, logger)
+		if err != nil {
+			return nil, err
+		}
+		collectors[key] = c
+	}
+
+	s := newRateSampler(*ratesMetrics, *ratesWindow, collectors, log.With(logger, "component", "rates"))
+	go s.run(*ratesInterval)
+	rates = s
+	return s, nil
+}
+
+type rateSample struct {
+	time  time.Time
+	value float64
+}
+
+// rateSeries holds the recent samples of a single counter.
+type rateSeries struct {
+	desc        *prometheus.Desc
+	labelValues []string
+	samples     []rateSample
+}
+
+// rate returns the per-second rate over the samples, treating decreasing
+// values as counter resets.
+func (s *rateSeries) rate() (float64, bool) {
+	if len(s.samples) < 2 {
+		return 0, false
+	}
+	var increase float64
+	for i := 1; i < len(s.samples); i++ {
+		delta := s.samples[i].value - s.samples[i-1].value
+		if delta < 0 {
+			delta = s.samples[i].value
+		}
+		increase += delta
+	}
+	elapsed := s.samples[len(s.samples)-1].time.Sub(s.samples[0].time).Seconds()
+	if elapsed <= 0 {
+		return 0, false
+	}
+	return increase / elapsed, true
+}
+
+// rateSampler runs the collectors exposing the selected counters at a fixed
+// interval and keeps their samples over a window, so that the per-second
+// rates can be exported with a resolution finer than the scrape interval.
+type rateSampler struct {
+	families map[string]bool
+	window   time.Duration
+	logger   log.Logger
+
+	mtx sync.Mutex
+	// collectors are the collectors sampled. Until the first sample they are
+	// all candidates, afterwards only those exposing a selected counter.
+	collectors map[string]*prometheus.Registry
+	discovered bool
+	// series maps collector names to the keys of their series.
+	series map[string]map[string]*rateSeries
+	descs  map[string]*prometheus.Desc
+}
+
+func newRateSampler(families []string, window time.Duration, collectors map[string]Collector, logger log.Logger) *rateSampler {
+	s := &rateSampler{
+		families:   make(map[string]bool, len(families)),
+		window:     window,
+		logger:     logger,
+		collectors: make(map[string]*prometheus.Registry, len(collectors)),
+		series:     make(map[string]map[string]*rateSeries),
+		descs:      make(map[string]*prometheus.Desc),
+	}
+	for _, f := range families {
+		s.families[f] = true
+	}
+	for name, c := range collectors {
+		r := prometheus.NewRegistry()
+		r.MustRegister(rateSource{c})
+		s.collectors[name] = r
+	}
+	return s
+}
+
+func (s *rateSampler) run(interval time.Duration) {
+	s.sample(time.Now())
+	ticker := time.NewTicker(interval)
+	for now := range ticker.C {
+		s.sample(now)
+	}
+}
+
+// sample runs the sampled collectors once and records the values of the
+// selected counters. The collectors run without holding the lock, so that
+// slow collectors don't block scrapes.
+func (s *rateSampler) sample(now time.Time) {
+	s.mtx.Lock()
+	collectors := make(map[string]*prometheus.Registry, len(s.collectors))
+	for name, r := range s.collectors {
+		collectors[name] = r
+	}
+	s.mtx.Unlock()
+
+	gathered := make(map[string][]*dto.MetricFamily, len(collectors))
+	for name, r := range collectors {
+		// Gather returns what it could gather alongside errors.
+		families, err := r.Gather()
+		if err != nil {
+			level.Debug(s.logger).Log("msg", "error sampling collector", "name", name, "err", err)
+		}
+		gathered[name] = families
+	}
+
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+
+	found := make(map[string]bool)
+	for name, families := range gathered {
+		exposes := false
+		for _, mf := range families {
+			if !s.families[mf.GetName()] {
+				continue
+			}
+			if mf.GetType() != dto.MetricType_COUNTER {
+				if !s.discovered {
+					level.Warn(s.logger).Log("msg", "metric selected for rates is not a counter", "metric", mf.GetName(), "type", mf.GetType())
+				}
+				continue
+			}
+			exposes = true
+			found[mf.GetName()] = true
+			for _, m := range mf.GetMetric() {
+				s.add(name, mf.GetName(), m, now)
+			}
+		}
+		if !s.discovered && !exposes {
+			delete(s.collectors, name)
+		}
+	}
+	if !s.discovered {
+		s.discovered = true
+		for f := range s.families {
+			if !found[f] {
+				level.Warn(s.logger).Log("msg", "no enabled collector exposes the counter selected for rates", "metric", f)
+			}
+		}
+	}
+
+	// Forget samples which fell out of the window, and series without any.
+	for name, series := range s.series {
+		for key, rs := range series {
+			i := 0
+			for i < len(rs.samples) && now.Sub(rs.samples[i].time) > s.window {
+				i++
+			}
+			rs.samples = rs.samples[i:]
+			if len(rs.samples) == 0 {
+				delete(series, key)
+			}
+		}
+		if len(series) == 0 {
+			delete(s.series, name)
+		}
+	}
+}
+
+func (s *rateSampler) add(collector, family string, m *dto.Metric, now time.Time) {
+	labels := m.GetLabel()
+	names := make([]string, len(labels))
+	values := make([]string, len(labels))
+	for i, l := range labels {
+		names[i] = l.GetName()
+		values[i] = l.GetValue()
+	}
+	key := family + "\xff" + strings.Join(names, "\xff") + "\xff" + strings.Join(values, "\xff")
+
+	series, ok := s.series[collector]
+	if !ok {
+		series = make(map[string]*rateSeries)
+		s.series[collector] = series
+	}
+	rs, ok := series[key]
+	if !ok {
+		rs = &rateSeries{desc: s.desc(family, names), labelValues: values}
+		series[key] = rs
+	}
+	rs.samples = append(rs.samples, rateSample{time: now, value: m.GetCounter().GetValue()})
+}
+
+// desc returns the descriptor of the per-second gauge of a counter family.
+func (s *rateSampler) desc(family string, labelNames []string) *prometheus.Desc {
+	key := family + "\xff" + strings.Join(labelNames, "\xff")
+	if d, ok := s.descs[key]; ok {
+		return d
+	}
+	d := prometheus.NewDesc(
+		strings.TrimSuffix(family, "_total")+"_per_second",
+		fmt.Sprintf("Per-second rate of %s averaged over %s.", family, s.window),
+		labelNames,
+		nil,
+	)
+	s.descs[key] = d
+	return d
+}
+
+// hasSeries returns whether counters of a collector were sampled.
+func (s *rateSampler) hasSeries(collector string) bool {
+	s.mtx.Lock()
+	defer s.mtx.Unlock()
+	return len(s.series[collector]) > 0
+}
+
+// collect sends the per-second gauges of the counters exposed by a collector.
+func (s *rateSampler) collect(collector string, ch chan<- prometheus.Metric) {
+	s.mtx.Lock()
+	var metrics []prometheus.Metric
+	keys := make([]string, 0, len(s.series[collector]))
+	for key := range s.series[collector] {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		rs := s.series[collector][key]
+		if rate, ok := rs.rate(); ok {
+			metrics = append(metrics, prometheus.MustNewConstMetric(rs.desc, prometheus.GaugeValue, rate, rs.labelValues...))
+		}
+	}
+	s.mtx.Unlock()
+
+	for _, m := range metrics {
+		ch <- m
+	}
+}
+
+// rateSource adapts a Collector to a prometheus.Collector, so that its
+// metrics can be gathered into families. It doesn't describe its metrics,
+// which makes it an unchecked collector.
+type rateSource struct {
+	Collector
+}
+
+// Describe implements the prometheus.Collector interface.
+func (rateSource) Describe(chan<- *prometheus.Desc) {}
+
+// Collect implements the prometheus.Collector interface.
+func (s rateSource) Collect(ch chan<- prometheus.Metric) {
+	// Errors are reported by the regular scrapes.
+	s.Update(ch)
+}
+
+// rateCollector wraps a Collector and adds the per-second gauges of its
+// counters sampled in the background to its output.
+type rateCollector struct {
+	Collector
+	name    string
+	sampler *rateSampler
+}
+
+// Update implements the Collector interface.
+func (c rateCollector) Update(ch chan<- prometheus.Metric) error {
+	err := c.Collector.Update(ch)
+	c.sampler.collect(c.name, ch)
+	return err
+}
@@ -0,0 +1,138 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// counterTestCollector exposes a counter per CPU with the values it is given.
+type counterTestCollector struct {
+	desc   typedDesc
+	values *[2]float64
+}
+
+func (c counterTestCollector) Update(ch chan<- prometheus.Metric) error {
+	ch <- c.desc.mustNewConstMetric(c.values[0], "0")
+	ch <- c.desc.mustNewConstMetric(c.values[1], "1")
+	return nil
+}
+
+func TestRateSampler(t *testing.T) {
+	values := &[2]float64{}
+	counter := counterTestCollector{
+		desc:   typedDesc{prometheus.NewDesc("node_test_seconds_total", "Test counter.", []string{"cpu"}, nil), prometheus.CounterValue},
+		values: values,
+	}
+	gauge := counterTestCollector{
+		desc:   typedDesc{prometheus.NewDesc("node_test_other", "Test gauge.", []string{"cpu"}, nil), prometheus.GaugeValue},
+		values: values,
+	}
+	s := newRateSampler(
+		[]string{"node_test_seconds_total"},
+		time.Minute,
+		map[string]Collector{"counter": counter, "gauge": gauge},
+		log.NewNopLogger(),
+	)
+
+	begin := time.Unix(1000, 0)
+	for i, v := range [][2]float64{{0, 100}, {30, 130}, {15, 160}} {
+		*values = v
+		s.sample(begin.Add(time.Duration(i) * 15 * time.Second))
+	}
+	if _, ok := s.collectors["gauge"]; ok {
+		t.Error("collector not exposing the counter should not be sampled")
+	}
+	if !s.hasSeries("counter") || s.hasSeries("gauge") {
+		t.Error("want series of the counter collector only")
+	}
+
+	// The reset of cpu 0 counts as an increase by 15.
+	*values = [2]float64{20, 170}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(collectorAdapter{rateCollector{Collector: counter, name: "counter", sampler: s}})
+	want := `# HELP node_test_seconds_per_second Per-second rate of node_test_seconds_total averaged over 1m0s.
+# TYPE node_test_seconds_per_second gauge
+node_test_seconds_per_second{cpu="0"} 1.5
+node_test_seconds_per_second{cpu="1"} 2
+# HELP node_test_seconds_total Test counter.
+# TYPE node_test_seconds_total counter
+node_test_seconds_total{cpu="0"} 20
+node_test_seconds_total{cpu="1"} 170
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+
+	// After a gap longer than the window, a single sample remains and
+	// there is no rate.
+	s.sample(begin.Add(5 * time.Minute))
+	ch := make(chan prometheus.Metric, 10)
+	s.collect("counter", ch)
+	if len(ch) != 0 {
+		t.Errorf("want no rates after the window expired, got %d", len(ch))
+	}
+}
+
+// blockingTestCollector blocks in Update until release is closed.
+type blockingTestCollector struct {
+	counterTestCollector
+	started chan struct{}
+	release chan struct{}
+}
+
+func (c blockingTestCollector) Update(ch chan<- prometheus.Metric) error {
+	close(c.started)
+	<-c.release
+	return c.counterTestCollector.Update(ch)
+}
+
+func TestRateSamplerCollectWhileSampling(t *testing.T) {
+	c := blockingTestCollector{
+		counterTestCollector: counterTestCollector{
+			desc:   typedDesc{prometheus.NewDesc("node_test_seconds_total", "Test counter.", []string{"cpu"}, nil), prometheus.CounterValue},
+			values: &[2]float64{},
+		},
+		started: make(chan struct{}),
+		release: make(chan struct{}),
+	}
+	s := newRateSampler([]string{"node_test_seconds_total"}, time.Minute, map[string]Collector{"counter": c}, log.NewNopLogger())
+
+	sampled := make(chan struct{})
+	go func() {
+		s.sample(time.Unix(1000, 0))
+		close(sampled)
+	}()
+	<-c.started
+
+	// Scrapes get the rates while a collector is slow to sample.
+	collected := make(chan struct{})
+	go func() {
+		s.collect("counter", make(chan prometheus.Metric, 10))
+		close(collected)
+	}()
+	select {
+	case <-collected:
+	case <-time.After(5 * time.Second):
+		t.Error("collect blocked by a running sample")
+	}
+	close(c.release)
+	<-sampled
+}
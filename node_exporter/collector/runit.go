@@ -19,19 +19,17 @@ package collector
 import (
 	"github.com/go-kit/log"
 	"github.com/go-kit/log/level"
-	"github.com/prometheus/client_golang/prometheus"
 	"github.com/soundcloud/go-runit/runit"
 	"gopkg.in/alecthomas/kingpin.v2"
 )
 
 var runitServiceDir = kingpin.Flag("collector.runit.servicedir", "Path to runit service directory.").Default("/etc/service").String()
 
-type runitCollector struct {
-	state          typedDesc
-	stateDesired   typedDesc
-	stateNormal    typedDesc
-	stateTimestamp typedDesc
-	logger         log.Logger
+// runitBackend reads the services of runit from the supervise directories of
+// its service directory.
+type runitBackend struct {
+	dir    string
+	logger log.Logger
 }
 
 func init() {
@@ -40,59 +38,38 @@ func init() {
 
 // NewRunitCollector returns a new Collector exposing runit statistics.
 func NewRunitCollector(logger log.Logger) (Collector, error) {
-	var (
-		subsystem   = "service"
-		constLabels = prometheus.Labels{"supervisor": "runit"}
-		labelNames  = []string{"service"}
-	)
-
-	return &runitCollector{
-		state: typedDesc{prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, subsystem, "state"),
-			"State of runit service.",
-			labelNames, constLabels,
-		), prometheus.GaugeValue},
-		stateDesired: typedDesc{prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, subsystem, "desired_state"),
-			"Desired state of runit service.",
-			labelNames, constLabels,
-		), prometheus.GaugeValue},
-		stateNormal: typedDesc{prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, subsystem, "normal_state"),
-			"Normal state of runit service.",
-			labelNames, constLabels,
-		), prometheus.GaugeValue},
-		stateTimestamp: typedDesc{prometheus.NewDesc(
-			prometheus.BuildFQName(namespace, subsystem, "state_last_change_timestamp_seconds"),
-			"Unix timestamp of the last runit service state change.",
-			labelNames, constLabels,
-		), prometheus.GaugeValue},
-		logger: logger,
+	return &supervisorCollector{
+		backend: &runitBackend{dir: *runitServiceDir, logger: logger},
+		metrics: newSupervisorMetrics("runit"),
 	}, nil
 }
 
-func (c *runitCollector) Update(ch chan<- prometheus.Metric) error {
-	services, err := runit.GetServices(*runitServiceDir)
+// Services implements supervisorBackend.
+func (b *runitBackend) Services() ([]supervisorService, error) {
+	services, err := runit.GetServices(b.dir)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
+	result := make([]supervisorService, 0, len(services))
 	for _, service := range services {
 		status, err := service.Status()
 		if err != nil {
-			level.Debug(c.logger).Log("msg", "Couldn't get status", "service", service.Name, "err", err)
+			level.Debug(b.logger).Log("msg", "Couldn't get status", "service", service.Name, "err", err)
 			continue
 		}
 
-		level.Debug(c.logger).Log("msg", "duration", "service", service.Name, "status", status.State, "pid", status.Pid, "duration_seconds", status.Duration)
-		ch <- c.state.mustNewConstMetric(float64(status.State), service.Name)
-		ch <- c.stateDesired.mustNewConstMetric(float64(status.Want), service.Name)
-		ch <- c.stateTimestamp.mustNewConstMetric(float64(status.Timestamp.Unix()), service.Name)
-		if status.NormallyUp {
-			ch <- c.stateNormal.mustNewConstMetric(1, service.Name)
-		} else {
-			ch <- c.stateNormal.mustNewConstMetric(0, service.Name)
-		}
+		level.Debug(b.logger).Log("msg", "duration", "service", service.Name, "status", status.State, "pid", status.Pid, "duration_seconds", status.Duration)
+		// runit's states are the ones shared by all supervisors.
+		want, normallyUp := status.Want, status.NormallyUp
+		result = append(result, supervisorService{
+			name:       service.Name,
+			state:      status.State,
+			pid:        status.Pid,
+			since:      status.Timestamp,
+			desired:    &want,
+			normallyUp: &normallyUp,
+		})
 	}
-	return nil
+	return result, nil
 }
@@ -0,0 +1,68 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !norunit
+// +build !norunit
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRunitCollector(t *testing.T) {
+	defer func(dir string) { *runitServiceDir = dir }(*runitServiceDir)
+	*runitServiceDir = "fixtures/supervisor/runit"
+
+	c, err := NewRunitCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.(*supervisorCollector).metrics.now = func() time.Time { return time.Unix(1650000100, 0) }
+
+	want := `# HELP node_service_desired_state Desired state of a supervised service, 0 for down and 1 for up.
+# TYPE node_service_desired_state gauge
+node_service_desired_state{name="cron",supervisor="runit"} 0
+node_service_desired_state{name="sshd",supervisor="runit"} 1
+# HELP node_service_normal_state Whether a supervised service is started when the supervisor starts.
+# TYPE node_service_normal_state gauge
+node_service_normal_state{name="cron",supervisor="runit"} 0
+node_service_normal_state{name="sshd",supervisor="runit"} 1
+# HELP node_service_restarts_total Number of restarts of a supervised service observed by the exporter.
+# TYPE node_service_restarts_total counter
+node_service_restarts_total{name="cron",supervisor="runit"} 0
+node_service_restarts_total{name="sshd",supervisor="runit"} 0
+# HELP node_service_state State of a supervised service, 0 for down, 1 for up and 2 while starting or stopping.
+# TYPE node_service_state gauge
+node_service_state{name="cron",supervisor="runit"} 0
+node_service_state{name="sshd",supervisor="runit"} 1
+# HELP node_service_state_last_change_timestamp_seconds Unix timestamp of the last state change of a supervised service.
+# TYPE node_service_state_last_change_timestamp_seconds gauge
+node_service_state_last_change_timestamp_seconds{name="cron",supervisor="runit"} 1.64999e+09
+node_service_state_last_change_timestamp_seconds{name="sshd",supervisor="runit"} 1.65e+09
+# HELP node_service_uptime_seconds Number of seconds a supervised service has been up.
+# TYPE node_service_uptime_seconds gauge
+node_service_uptime_seconds{name="sshd",supervisor="runit"} 100
+`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
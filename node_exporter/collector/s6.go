@@ -0,0 +1,129 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nos6
+// +build !nos6
+
+package collector
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+var s6ScanDir = kingpin.Flag("collector.s6.scandir", "Path to the s6-svscan scan directory.").Default("/run/service").String()
+
+// The supervise/status file written by s6-supervise, as read by s6-svstat.
+// s6 2.11 added the process group, growing the file from 35 to 43 bytes.
+const (
+	s6StatusLen         = 35
+	s6StatusLenWithPgid = 43
+
+	s6FlagFinishing = 1 << 1
+	s6FlagWantUp    = 1 << 2
+
+	// s6TAIOffset converts TAI64 labels to Unix timestamps.
+	s6TAIOffset = 4611686018427387914
+)
+
+// s6Backend reads the services of s6 from the supervise directories of the
+// services in its scan directory.
+type s6Backend struct {
+	dir    string
+	logger log.Logger
+}
+
+func init() {
+	registerCollector("s6", defaultDisabled, NewS6Collector)
+}
+
+// NewS6Collector returns a new Collector exposing the state of s6 services.
+func NewS6Collector(logger log.Logger) (Collector, error) {
+	return &supervisorCollector{
+		backend: &s6Backend{dir: *s6ScanDir, logger: logger},
+		metrics: newSupervisorMetrics("s6"),
+	}, nil
+}
+
+// Services implements supervisorBackend.
+func (b *s6Backend) Services() ([]supervisorService, error) {
+	entries, err := ioutil.ReadDir(b.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var services []supervisorService
+	for _, entry := range entries {
+		// .s6-svscan holds the control files of s6-svscan itself.
+		if strings.HasPrefix(entry.Name(), ".") {
+			continue
+		}
+		path := filepath.Join(b.dir, entry.Name())
+		status, err := ioutil.ReadFile(filepath.Join(path, "supervise", "status"))
+		if err != nil {
+			level.Debug(b.logger).Log("msg", "Couldn't get status", "service", entry.Name(), "err", err)
+			continue
+		}
+		s, err := parseS6Status(status)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status of s6 service %s: %w", entry.Name(), err)
+		}
+		s.name = entry.Name()
+
+		_, err = os.Stat(filepath.Join(path, "down"))
+		normallyUp := errors.Is(err, os.ErrNotExist)
+		s.normallyUp = &normallyUp
+		services = append(services, s)
+	}
+	return services, nil
+}
+
+// parseS6Status parses a supervise/status file, which consists of the TAI64N
+// timestamp of the last state change, the TAI64N timestamp the service
+// became ready, the big-endian 64-bit PID, on newer versions the process
+// group, the wait status of the last exit and a flags byte.
+func parseS6Status(b []byte) (supervisorService, error) {
+	var s supervisorService
+	if len(b) != s6StatusLen && len(b) != s6StatusLenWithPgid {
+		return s, fmt.Errorf("unexpected length %d", len(b))
+	}
+
+	s.since = time.Unix(int64(binary.BigEndian.Uint64(b[0:8])-s6TAIOffset), int64(binary.BigEndian.Uint32(b[8:12])))
+	s.pid = int(binary.BigEndian.Uint64(b[24:32]))
+	flags := b[len(b)-1]
+
+	switch {
+	case flags&s6FlagFinishing != 0:
+		s.state = serviceStateTransition
+	case s.pid != 0:
+		s.state = serviceStateUp
+	default:
+		s.state = serviceStateDown
+	}
+	desired := serviceStateDown
+	if flags&s6FlagWantUp != 0 {
+		desired = serviceStateUp
+	}
+	s.desired = &desired
+	return s, nil
+}
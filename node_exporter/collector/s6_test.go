@@ -0,0 +1,73 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nos6
+// +build !nos6
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestS6Collector(t *testing.T) {
+	defer func(dir string) { *s6ScanDir = dir }(*s6ScanDir)
+	*s6ScanDir = "fixtures/supervisor/s6"
+
+	c, err := NewS6Collector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.(*supervisorCollector).metrics.now = func() time.Time { return time.Unix(1650000100, 0) }
+
+	want := `# HELP node_service_desired_state Desired state of a supervised service, 0 for down and 1 for up.
+# TYPE node_service_desired_state gauge
+node_service_desired_state{name="disabled",supervisor="s6"} 0
+node_service_desired_state{name="nginx",supervisor="s6"} 1
+node_service_desired_state{name="worker",supervisor="s6"} 1
+# HELP node_service_normal_state Whether a supervised service is started when the supervisor starts.
+# TYPE node_service_normal_state gauge
+node_service_normal_state{name="disabled",supervisor="s6"} 0
+node_service_normal_state{name="nginx",supervisor="s6"} 1
+node_service_normal_state{name="worker",supervisor="s6"} 1
+# HELP node_service_restarts_total Number of restarts of a supervised service observed by the exporter.
+# TYPE node_service_restarts_total counter
+node_service_restarts_total{name="disabled",supervisor="s6"} 0
+node_service_restarts_total{name="nginx",supervisor="s6"} 0
+node_service_restarts_total{name="worker",supervisor="s6"} 0
+# HELP node_service_state State of a supervised service, 0 for down, 1 for up and 2 while starting or stopping.
+# TYPE node_service_state gauge
+node_service_state{name="disabled",supervisor="s6"} 0
+node_service_state{name="nginx",supervisor="s6"} 1
+node_service_state{name="worker",supervisor="s6"} 2
+# HELP node_service_state_last_change_timestamp_seconds Unix timestamp of the last state change of a supervised service.
+# TYPE node_service_state_last_change_timestamp_seconds gauge
+node_service_state_last_change_timestamp_seconds{name="disabled",supervisor="s6"} 1.649e+09
+node_service_state_last_change_timestamp_seconds{name="nginx",supervisor="s6"} 1.65e+09
+node_service_state_last_change_timestamp_seconds{name="worker",supervisor="s6"} 1.65000005e+09
+# HELP node_service_uptime_seconds Number of seconds a supervised service has been up.
+# TYPE node_service_uptime_seconds gauge
+node_service_uptime_seconds{name="nginx",supervisor="s6"} 100
+`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+	if err := testutil.GatherAndCompare(registry, strings.NewReader(want)); err != nil {
+		t.Error(err)
+	}
+}
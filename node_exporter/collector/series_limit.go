@@ -0,0 +1,170 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	seriesLimitActionDrop     = "drop"
+	seriesLimitActionTruncate = "truncate"
+)
+
+var (
+	seriesLimitDefault = kingpin.Flag(
+		"collector.series-limit",
+		"Maximum number of series a single collector may return per scrape. Use 0 to disable.",
+	).Default("0").Int()
+	seriesLimitPerCollector = kingpin.Flag(
+		"collector.series-limit.per-collector",
+		"Series limit for a specific collector, overriding --collector.series-limit (e.g. netdev=5000). Can be repeated.",
+	).PlaceHolder("COLLECTOR=LIMIT").StringMap()
+	seriesLimitAction = kingpin.Flag(
+		"collector.series-limit.action",
+		"What to do with the output of a collector exceeding its series limit: drop it entirely or truncate it to the limit.",
+	).Default(seriesLimitActionDrop).Enum(seriesLimitActionDrop, seriesLimitActionTruncate)
+
+	seriesLimitExceededDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "scrape", "collector_series_limit_exceeded"),
+		"node_exporter: Whether a collector returned more series than its limit.",
+		[]string{"collector"},
+		nil,
+	)
+)
+
+// seriesLimits returns the effective series limit of each given collector.
+// Collectors without a limit are omitted.
+func seriesLimits(collectors map[string]Collector) (map[string]int, error) {
+	limits := make(map[string]int)
+	for name, value := range *seriesLimitPerCollector {
+		if _, ok := collectorState[name]; !ok {
+			return nil, fmt.Errorf("series limit for unknown collector: %s", name)
+		}
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 0 {
+			return nil, fmt.Errorf("invalid series limit %q for collector %s", value, name)
+		}
+		if _, ok := collectors[name]; ok && limit > 0 {
+			limits[name] = limit
+		}
+	}
+	if *seriesLimitDefault <= 0 {
+		return limits, nil
+	}
+	for name := range collectors {
+		if _, ok := (*seriesLimitPerCollector)[name]; !ok {
+			limits[name] = *seriesLimitDefault
+		}
+	}
+	return limits, nil
+}
+
+// executeWithSeriesLimit executes the given collector like execute, but drops
+// or truncates its output if it returns more than limit series.
+func executeWithSeriesLimit(name string, c Collector, limit int, ch chan<- prometheus.Metric, logger log.Logger) error {
+	l := &seriesLimiter{
+		Collector: c,
+		name:      name,
+		limit:     limit,
+		action:    *seriesLimitAction,
+		logger:    logger,
+	}
+	err := execute(name, l, ch, logger)
+
+	var exceeded float64
+	if l.exceeded {
+		exceeded = 1
+	}
+	ch <- prometheus.MustNewConstMetric(seriesLimitExceededDesc, prometheus.GaugeValue, exceeded, name)
+	return err
+}
+
+// seriesLimiter wraps a Collector and buffers its output, so that it can be
+// dropped or truncated if it exceeds the limit.
+type seriesLimiter struct {
+	Collector
+	name     string
+	limit    int
+	action   string
+	exceeded bool
+	logger   log.Logger
+}
+
+// Update implements the Collector interface.
+func (l *seriesLimiter) Update(ch chan<- prometheus.Metric) error {
+	var metrics []prometheus.Metric
+	buffered := make(chan prometheus.Metric)
+	done := make(chan struct{})
+	go func() {
+		for m := range buffered {
+			metrics = append(metrics, m)
+		}
+		close(done)
+	}()
+	err := l.Collector.Update(buffered)
+	close(buffered)
+	<-done
+
+	if len(metrics) > l.limit {
+		l.exceeded = true
+		label, values := worstLabel(metrics)
+		level.Warn(l.logger).Log("msg", "collector exceeded its series limit", "name", l.name, "series", len(metrics), "limit", l.limit, "action", l.action, "worst_label", label, "worst_label_values", values)
+		if l.action == seriesLimitActionTruncate {
+			metrics = metrics[:l.limit]
+		} else {
+			metrics = nil
+		}
+	}
+	for _, m := range metrics {
+		ch <- m
+	}
+	return err
+}
+
+// worstLabel returns the name of the label with the most distinct values
+// among the given metrics, together with the number of values.
+func worstLabel(metrics []prometheus.Metric) (string, int) {
+	values := make(map[string]map[string]struct{})
+	for _, m := range metrics {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			continue
+		}
+		for _, l := range pb.GetLabel() {
+			if _, ok := values[l.GetName()]; !ok {
+				values[l.GetName()] = make(map[string]struct{})
+			}
+			values[l.GetName()][l.GetValue()] = struct{}{}
+		}
+	}
+
+	var (
+		worst string
+		count int
+	)
+	for name, v := range values {
+		if len(v) > count || (len(v) == count && name < worst) {
+			worst, count = name, len(v)
+		}
+	}
+	return worst, count
+}
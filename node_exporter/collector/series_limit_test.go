@@ -0,0 +1,133 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var seriesLimitTestDesc = prometheus.NewDesc("node_series_limit_test", "Test metric.", []string{"device", "type"}, nil)
+
+type seriesLimitTestCollector struct {
+	series int
+}
+
+func (c seriesLimitTestCollector) Update(ch chan<- prometheus.Metric) error {
+	for i := 0; i < c.series; i++ {
+		ch <- prometheus.MustNewConstMetric(seriesLimitTestDesc, prometheus.GaugeValue, 1, fmt.Sprintf("veth%d", i), fmt.Sprintf("type%d", i%2))
+	}
+	return nil
+}
+
+func TestSeriesLimit(t *testing.T) {
+	defer func(action string) {
+		*seriesLimitAction = action
+	}(*seriesLimitAction)
+
+	for _, test := range []struct {
+		action   string
+		series   int
+		want     int
+		exceeded float64
+	}{
+		{action: seriesLimitActionDrop, series: 5, want: 5},
+		{action: seriesLimitActionDrop, series: 20, want: 0, exceeded: 1},
+		{action: seriesLimitActionTruncate, series: 20, want: 10, exceeded: 1},
+	} {
+		*seriesLimitAction = test.action
+		nc := NodeCollector{
+			Collectors:   map[string]Collector{"netdev": seriesLimitTestCollector{series: test.series}},
+			seriesLimits: map[string]int{"netdev": 10},
+			logger:       log.NewNopLogger(),
+		}
+
+		reg := prometheus.NewRegistry()
+		reg.MustRegister(nc)
+		mfs, err := reg.Gather()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var (
+			got      int
+			exceeded float64 = -1
+		)
+		for _, mf := range mfs {
+			switch mf.GetName() {
+			case "node_series_limit_test":
+				got = len(mf.GetMetric())
+			case "node_scrape_collector_series_limit_exceeded":
+				exceeded = mf.GetMetric()[0].GetGauge().GetValue()
+			}
+		}
+		if got != test.want {
+			t.Errorf("%s with %d series: want %d series, got %d", test.action, test.series, test.want, got)
+		}
+		if exceeded != test.exceeded {
+			t.Errorf("%s with %d series: want exceeded %v, got %v", test.action, test.series, test.exceeded, exceeded)
+		}
+	}
+}
+
+func TestWorstLabel(t *testing.T) {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		seriesLimitTestCollector{series: 6}.Update(ch)
+		close(ch)
+	}()
+	var metrics []prometheus.Metric
+	for m := range ch {
+		metrics = append(metrics, m)
+	}
+
+	label, values := worstLabel(metrics)
+	if label != "device" || values != 6 {
+		t.Errorf("want worst label device with 6 values, got %s with %d values", label, values)
+	}
+}
+
+func TestSeriesLimits(t *testing.T) {
+	defer func(def int, per map[string]string) {
+		*seriesLimitDefault = def
+		*seriesLimitPerCollector = per
+	}(*seriesLimitDefault, *seriesLimitPerCollector)
+
+	collectors := map[string]Collector{"textfile": nil, "exec_helper": nil}
+	*seriesLimitDefault = 100
+	*seriesLimitPerCollector = map[string]string{"textfile": "0", "exec_helper": "5"}
+
+	limits, err := seriesLimits(collectors)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := limits["textfile"]; ok {
+		t.Errorf("expected no limit for textfile, got %d", limits["textfile"])
+	}
+	if limits["exec_helper"] != 5 {
+		t.Errorf("expected limit 5 for exec_helper, got %d", limits["exec_helper"])
+	}
+
+	*seriesLimitPerCollector = map[string]string{"textfile": "many"}
+	if _, err := seriesLimits(collectors); err == nil {
+		t.Error("expected error for invalid limit")
+	}
+	*seriesLimitPerCollector = map[string]string{"nonexistent": "1"}
+	if _, err := seriesLimits(collectors); err == nil {
+		t.Error("expected error for unknown collector")
+	}
+}
@@ -0,0 +1,85 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	lastScrapesMtx = sync.Mutex{}
+	lastScrapes    = make(map[string]ScrapeStatus)
+)
+
+// CollectorStatus describes a registered collector and its last scrape.
+type CollectorStatus struct {
+	Name    string `json:"name"`
+	Enabled bool   `json:"enabled"`
+	// Forced is true if the collector was explicitly enabled or disabled on
+	// the command line.
+	Forced bool `json:"forced"`
+	// LastScrape is nil if the collector wasn't scraped yet.
+	LastScrape *ScrapeStatus `json:"last_scrape,omitempty"`
+}
+
+// ScrapeStatus is the result of a collector execution.
+type ScrapeStatus struct {
+	Time            time.Time `json:"time"`
+	DurationSeconds float64   `json:"duration_seconds"`
+	// Success is false if the collector failed or returned no data, like
+	// node_scrape_collector_success.
+	Success bool   `json:"success"`
+	Error   string `json:"error,omitempty"`
+}
+
+// CollectorStatuses returns the status of all registered collectors, sorted
+// by name.
+func CollectorStatuses() []CollectorStatus {
+	lastScrapesMtx.Lock()
+	defer lastScrapesMtx.Unlock()
+
+	result := make([]CollectorStatus, 0, len(collectorState))
+	for name, enabled := range collectorState {
+		s := CollectorStatus{
+			Name:    name,
+			Enabled: *enabled,
+			Forced:  forcedCollectors[name],
+		}
+		if scrape, ok := lastScrapes[name]; ok {
+			s.LastScrape = &scrape
+		}
+		result = append(result, s)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result
+}
+
+func recordScrape(name string, begin time.Time, duration time.Duration, err error) {
+	s := ScrapeStatus{
+		Time:            begin,
+		DurationSeconds: duration.Seconds(),
+		Success:         err == nil,
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+
+	lastScrapesMtx.Lock()
+	defer lastScrapesMtx.Unlock()
+	lastScrapes[name] = s
+}
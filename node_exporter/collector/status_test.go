@@ -0,0 +1,47 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestCollectorStatuses(t *testing.T) {
+	ch := make(chan prometheus.Metric, 2)
+	execute("loadavg", errorTestCollector{err: errors.New("failure")}, ch, log.NewNopLogger())
+
+	var found bool
+	for _, s := range CollectorStatuses() {
+		if s.Name != "loadavg" {
+			continue
+		}
+		found = true
+		if s.Enabled != *collectorState["loadavg"] {
+			t.Errorf("want enabled %v, got %v", *collectorState["loadavg"], s.Enabled)
+		}
+		if s.LastScrape == nil {
+			t.Fatal("want last scrape, got none")
+		}
+		if s.LastScrape.Success || s.LastScrape.Error != "failure" {
+			t.Errorf("want failed scrape, got %+v", s.LastScrape)
+		}
+	}
+	if !found {
+		t.Error("loadavg collector missing")
+	}
+}
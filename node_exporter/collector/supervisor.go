@@ -0,0 +1,169 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Service states shared by all process supervisors. They match the states
+// runit has always been exposing.
+const (
+	serviceStateDown       = 0
+	serviceStateUp         = 1
+	serviceStateTransition = 2
+)
+
+// supervisorService is a service as seen by a process supervisor.
+type supervisorService struct {
+	name  string
+	state int
+	pid   int
+	// since is the time the service entered its current state, zero if the
+	// supervisor doesn't know.
+	since time.Time
+	// desired and normallyUp are nil if the supervisor has no such notion.
+	desired    *int
+	normallyUp *bool
+}
+
+// supervisorBackend reads the services of a process supervisor.
+type supervisorBackend interface {
+	Services() ([]supervisorService, error)
+}
+
+// supervisorCollector exposes the services of a supervisorBackend.
+type supervisorCollector struct {
+	backend supervisorBackend
+	metrics *supervisorMetrics
+}
+
+// Update implements Collector.
+func (c *supervisorCollector) Update(ch chan<- prometheus.Metric) error {
+	services, err := c.backend.Services()
+	if err != nil {
+		return err
+	}
+	c.metrics.update(ch, services)
+	return nil
+}
+
+// supervisorMetrics exposes the services of a supervisor with the metrics
+// common to all supervisors. Supervisors don't count restarts themselves, so
+// restarts are counted by watching the process IDs of services between
+// scrapes.
+type supervisorMetrics struct {
+	state          typedDesc
+	stateDesired   typedDesc
+	stateNormal    typedDesc
+	stateTimestamp typedDesc
+	uptime         typedDesc
+	restarts       typedDesc
+	now            func() time.Time
+
+	mtx      sync.Mutex
+	pids     map[string]int
+	restartN map[string]uint64
+}
+
+func newSupervisorMetrics(supervisor string) *supervisorMetrics {
+	var (
+		subsystem   = "service"
+		constLabels = prometheus.Labels{"supervisor": supervisor}
+		labelNames  = []string{"name"}
+	)
+	return &supervisorMetrics{
+		state: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "state"),
+			"State of a supervised service, 0 for down, 1 for up and 2 while starting or stopping.",
+			labelNames, constLabels,
+		), prometheus.GaugeValue},
+		stateDesired: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "desired_state"),
+			"Desired state of a supervised service, 0 for down and 1 for up.",
+			labelNames, constLabels,
+		), prometheus.GaugeValue},
+		stateNormal: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "normal_state"),
+			"Whether a supervised service is started when the supervisor starts.",
+			labelNames, constLabels,
+		), prometheus.GaugeValue},
+		stateTimestamp: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "state_last_change_timestamp_seconds"),
+			"Unix timestamp of the last state change of a supervised service.",
+			labelNames, constLabels,
+		), prometheus.GaugeValue},
+		uptime: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "uptime_seconds"),
+			"Number of seconds a supervised service has been up.",
+			labelNames, constLabels,
+		), prometheus.GaugeValue},
+		restarts: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, subsystem, "restarts_total"),
+			"Number of restarts of a supervised service observed by the exporter.",
+			labelNames, constLabels,
+		), prometheus.CounterValue},
+		now:      time.Now,
+		pids:     make(map[string]int),
+		restartN: make(map[string]uint64),
+	}
+}
+
+// update exposes the given services and forgets the restart counts of
+// services that no longer exist.
+func (m *supervisorMetrics) update(ch chan<- prometheus.Metric, services []supervisorService) {
+	m.mtx.Lock()
+	defer m.mtx.Unlock()
+
+	now := m.now()
+	seen := make(map[string]struct{}, len(services))
+	for _, s := range services {
+		seen[s.name] = struct{}{}
+		if s.pid != 0 {
+			if prev, ok := m.pids[s.name]; ok && prev != 0 && prev != s.pid {
+				m.restartN[s.name]++
+			}
+			m.pids[s.name] = s.pid
+		}
+
+		ch <- m.state.mustNewConstMetric(float64(s.state), s.name)
+		if s.desired != nil {
+			ch <- m.stateDesired.mustNewConstMetric(float64(*s.desired), s.name)
+		}
+		if s.normallyUp != nil {
+			normal := 0.0
+			if *s.normallyUp {
+				normal = 1
+			}
+			ch <- m.stateNormal.mustNewConstMetric(normal, s.name)
+		}
+		if !s.since.IsZero() {
+			ch <- m.stateTimestamp.mustNewConstMetric(float64(s.since.Unix()), s.name)
+			if s.state == serviceStateUp {
+				ch <- m.uptime.mustNewConstMetric(now.Sub(s.since).Seconds(), s.name)
+			}
+		}
+		ch <- m.restarts.mustNewConstMetric(float64(m.restartN[s.name]), s.name)
+	}
+
+	for name := range m.pids {
+		if _, ok := seen[name]; !ok {
+			delete(m.pids, name)
+			delete(m.restartN, name)
+		}
+	}
+}
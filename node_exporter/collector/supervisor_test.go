@@ -0,0 +1,94 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type fakeSupervisorBackend struct {
+	services []supervisorService
+}
+
+func (b *fakeSupervisorBackend) Services() ([]supervisorService, error) { return b.services, nil }
+
+func TestSupervisorRestarts(t *testing.T) {
+	backend := &fakeSupervisorBackend{}
+	c := &supervisorCollector{backend: backend, metrics: newSupervisorMetrics("test")}
+	c.metrics.now = func() time.Time { return time.Unix(1650000100, 0) }
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+
+	for _, step := range []struct {
+		services []supervisorService
+		want     string
+	}{
+		{
+			services: []supervisorService{
+				{name: "a", state: serviceStateUp, pid: 10, since: time.Unix(1650000000, 0)},
+				{name: "b", state: serviceStateUp, pid: 20},
+			},
+			want: `node_service_restarts_total{name="a",supervisor="test"} 0
+node_service_restarts_total{name="b",supervisor="test"} 0
+`,
+		},
+		{
+			// a crashed and is down, b was restarted.
+			services: []supervisorService{
+				{name: "a", state: serviceStateDown},
+				{name: "b", state: serviceStateUp, pid: 21},
+			},
+			want: `node_service_restarts_total{name="a",supervisor="test"} 0
+node_service_restarts_total{name="b",supervisor="test"} 1
+`,
+		},
+		{
+			services: []supervisorService{
+				{name: "a", state: serviceStateUp, pid: 11},
+				{name: "b", state: serviceStateUp, pid: 21},
+			},
+			want: `node_service_restarts_total{name="a",supervisor="test"} 1
+node_service_restarts_total{name="b",supervisor="test"} 1
+`,
+		},
+		{
+			// b was removed and added again.
+			services: []supervisorService{
+				{name: "a", state: serviceStateUp, pid: 11},
+			},
+			want: `node_service_restarts_total{name="a",supervisor="test"} 1
+`,
+		},
+		{
+			services: []supervisorService{
+				{name: "a", state: serviceStateUp, pid: 11},
+				{name: "b", state: serviceStateUp, pid: 30},
+			},
+			want: `node_service_restarts_total{name="a",supervisor="test"} 1
+node_service_restarts_total{name="b",supervisor="test"} 0
+`,
+		},
+	} {
+		backend.services = step.services
+		want := "# HELP node_service_restarts_total Number of restarts of a supervised service observed by the exporter.\n# TYPE node_service_restarts_total counter\n" + step.want
+		if err := testutil.GatherAndCompare(registry, strings.NewReader(want), "node_service_restarts_total"); err != nil {
+			t.Error(err)
+		}
+	}
+}
@@ -41,6 +41,7 @@ type supervisordCollector struct {
 	stateDesc      *prometheus.Desc
 	exitStatusDesc *prometheus.Desc
 	startTimeDesc  *prometheus.Desc
+	services       *supervisorMetrics
 	logger         log.Logger
 }
 
@@ -94,7 +95,8 @@ func NewSupervisordCollector(logger log.Logger) (Collector, error) {
 			labelNames,
 			nil,
 		),
-		logger: logger,
+		services: newSupervisorMetrics("supervisord"),
+		logger:   logger,
 	}, nil
 }
 
@@ -138,6 +140,7 @@ func (c *supervisordCollector) Update(ch chan<- prometheus.Metric) error {
 		return fmt.Errorf("unable to call supervisord: %w", err)
 	}
 
+	var services []supervisorService
 	for _, p := range res.(xmlrpc.Array) {
 		for k, v := range p.(xmlrpc.Struct) {
 			switch k {
@@ -173,7 +176,30 @@ func (c *supervisordCollector) Update(ch chan<- prometheus.Metric) error {
 			ch <- prometheus.MustNewConstMetric(c.upDesc, prometheus.GaugeValue, 0, labels...)
 		}
 		level.Debug(c.logger).Log("msg", "process info", "group", info.Group, "name", info.Name, "state", info.StateName, "pid", info.PID)
+
+		services = append(services, supervisordService(info.Name, info.Group, info.State, info.PID, info.Start))
 	}
+	c.services.update(ch, services)
 
 	return nil
 }
+
+// supervisordService converts a supervisord process to a service named like
+// supervisorctl names it, "group:name" for processes in a group of their own.
+func supervisordService(name, group string, state, pid, start int) supervisorService {
+	s := supervisorService{name: name, pid: pid}
+	if group != "" && group != name {
+		s.name = group + ":" + name
+	}
+	// http://supervisord.org/subprocess.html#process-states
+	switch state {
+	case 20: // RUNNING
+		s.state = serviceStateUp
+		s.since = time.Unix(int64(start), 0)
+	case 10, 30, 40: // STARTING, BACKOFF, STOPPING
+		s.state = serviceStateTransition
+	default:
+		s.state = serviceStateDown
+	}
+	return s
+}
@@ -0,0 +1,65 @@
+// Copyright 2015 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nosupervisord
+// +build !nosupervisord
+
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestSupervisordCollector(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "fixtures/supervisor/supervisord.xml")
+	}))
+	defer server.Close()
+
+	defer func(url string) { *supervisordURL = url }(*supervisordURL)
+	*supervisordURL = server.URL + "/RPC2"
+
+	c, err := NewSupervisordCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	c.(*supervisordCollector).services.now = func() time.Time { return time.Unix(1650000100, 0) }
+
+	want := `# HELP node_service_state State of a supervised service, 0 for down, 1 for up and 2 while starting or stopping.
+# TYPE node_service_state gauge
+node_service_state{name="web",supervisor="supervisord"} 1
+node_service_state{name="workers:worker_00",supervisor="supervisord"} 2
+# HELP node_service_uptime_seconds Number of seconds a supervised service has been up.
+# TYPE node_service_uptime_seconds gauge
+node_service_uptime_seconds{name="web",supervisor="supervisord"} 100
+# HELP node_supervisord_up Process Up
+# TYPE node_supervisord_up gauge
+node_supervisord_up{group="web",name="web"} 1
+node_supervisord_up{group="workers",name="worker_00"} 0
+`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+	err = testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"node_service_state", "node_service_uptime_seconds", "node_supervisord_up")
+	if err != nil {
+		t.Error(err)
+	}
+}
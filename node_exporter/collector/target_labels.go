@@ -0,0 +1,253 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+const (
+	hostLabelMachineID   = "machine_id"
+	hostLabelOSID        = "os_id"
+	hostLabelOSVersionID = "os_version_id"
+	hostLabelProductName = "product_name"
+)
+
+var (
+	targetLabelsStatic = kingpin.Flag(
+		"collector.target-label",
+		"Constant label added to all series of the collectors (e.g. rack=r12). Can be repeated.",
+	).PlaceHolder("NAME=VALUE").StringMap()
+	targetLabelsHost = kingpin.Flag(
+		"collector.target-label.host",
+		"Label derived from the host added to all series of the collectors, one of machine_id, os_id, os_version_id or product_name. Can be repeated.",
+	).Enums(hostLabelMachineID, hostLabelOSID, hostLabelOSVersionID, hostLabelProductName)
+	targetLabelsCollectors = kingpin.Flag(
+		"collector.target-label.collectors",
+		"Collector whose series get the target labels, including its node_scrape_collector_* series. Can be repeated, defaults to all collectors.",
+	).Strings()
+)
+
+// targetLabels are the labels added to the series of a set of collectors.
+type targetLabels struct {
+	pairs []*dto.LabelPair
+	// collectors is nil if the labels apply to all collectors.
+	collectors map[string]bool
+}
+
+// newTargetLabels returns the target labels configured on the command line,
+// or nil if there are none.
+func newTargetLabels() (*targetLabels, error) {
+	labels := make(map[string]string)
+	for name, value := range *targetLabelsStatic {
+		labels[name] = value
+	}
+	for _, name := range *targetLabelsHost {
+		if _, ok := labels[name]; ok {
+			return nil, fmt.Errorf("target label %s is both constant and derived from the host", name)
+		}
+		value, err := hostLabelValue(name)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't determine host label %s: %w", name, err)
+		}
+		labels[name] = value
+	}
+	if len(labels) == 0 {
+		return nil, nil
+	}
+
+	t := &targetLabels{}
+	for name, value := range labels {
+		name, value := name, value
+		if !model.LabelName(name).IsValid() || strings.HasPrefix(name, model.ReservedLabelPrefix) {
+			return nil, fmt.Errorf("invalid target label name: %q", name)
+		}
+		t.pairs = append(t.pairs, &dto.LabelPair{Name: &name, Value: &value})
+	}
+	sortLabelPairs(t.pairs)
+
+	if len(*targetLabelsCollectors) > 0 {
+		t.collectors = make(map[string]bool)
+		for _, name := range *targetLabelsCollectors {
+			if _, ok := collectorState[name]; !ok {
+				return nil, fmt.Errorf("target labels for unknown collector: %s", name)
+			}
+			t.collectors[name] = true
+		}
+	}
+	return t, nil
+}
+
+func (t *targetLabels) appliesTo(collector string) bool {
+	return t != nil && (t.collectors == nil || t.collectors[collector])
+}
+
+// hostLabelValue reads the value of a host-derived label.
+func hostLabelValue(name string) (string, error) {
+	switch name {
+	case hostLabelMachineID:
+		for _, path := range []string{"etc/machine-id", "var/lib/dbus/machine-id"} {
+			id, err := ioutil.ReadFile(rootfsFilePath(path))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			return strings.TrimSpace(string(id)), nil
+		}
+		return "", errors.New("no machine-id found")
+	case hostLabelOSID, hostLabelOSVersionID:
+		for _, path := range []string{etcOSRelease, usrLibOSRelease} {
+			f, err := os.Open(rootfsFilePath(path))
+			if errors.Is(err, os.ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return "", err
+			}
+			defer f.Close()
+			release, err := parseOSRelease(f)
+			if err != nil {
+				return "", err
+			}
+			if name == hostLabelOSID {
+				return release.ID, nil
+			}
+			return release.VersionID, nil
+		}
+		return "", errors.New("no os-release found")
+	case hostLabelProductName:
+		product, err := ioutil.ReadFile(sysFilePath("class/dmi/id/product_name"))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSpace(string(product)), nil
+	}
+	return "", fmt.Errorf("unknown host label: %s", name)
+}
+
+// targetLabelConflict is a target label conflicting with a label of the
+// series of a collector.
+type targetLabelConflict struct {
+	collector string
+	label     string
+}
+
+// reportedTargetLabelConflicts are the conflicts already logged, so that
+// each one is logged once rather than on every scrape.
+var reportedTargetLabelConflicts sync.Map
+
+// targetLabeler adds the target labels to the metrics sent to its channel and
+// forwards them.
+type targetLabeler struct {
+	ch        chan prometheus.Metric
+	done      chan struct{}
+	conflicts map[string]int
+}
+
+func newTargetLabeler(out chan<- prometheus.Metric, labels []*dto.LabelPair) *targetLabeler {
+	l := &targetLabeler{
+		ch:        make(chan prometheus.Metric),
+		done:      make(chan struct{}),
+		conflicts: make(map[string]int),
+	}
+	go func() {
+		for m := range l.ch {
+			out <- l.label(m, labels)
+		}
+		close(l.done)
+	}()
+	return l
+}
+
+// finish waits for all metrics to be forwarded and logs the target labels
+// which conflicted with labels of the series for the first time.
+func (l *targetLabeler) finish(name string, logger log.Logger) {
+	close(l.ch)
+	<-l.done
+	for label, series := range l.conflicts {
+		if _, reported := reportedTargetLabelConflicts.LoadOrStore(targetLabelConflict{name, label}, true); reported {
+			continue
+		}
+		level.Warn(logger).Log("msg", "target label conflicts with a label of the collector, keeping the collector's label", "name", name, "label", label, "series", series)
+	}
+}
+
+// label returns the metric with the target labels added. Labels the metric
+// already has take precedence.
+func (l *targetLabeler) label(m prometheus.Metric, labels []*dto.LabelPair) prometheus.Metric {
+	pb := &dto.Metric{}
+	if err := m.Write(pb); err != nil {
+		// Leave reporting the error to the registry.
+		return m
+	}
+	existing := make(map[string]bool, len(pb.Label))
+	for _, p := range pb.Label {
+		existing[p.GetName()] = true
+	}
+	for _, p := range labels {
+		if existing[p.GetName()] {
+			l.conflicts[p.GetName()]++
+			continue
+		}
+		pb.Label = append(pb.Label, p)
+	}
+	sortLabelPairs(pb.Label)
+	return labeledMetric{desc: m.Desc(), metric: pb}
+}
+
+// labeledMetric is a metric with labels added after it was collected. It
+// keeps the original Desc, which lacks the added labels, so it doesn't pass
+// the checks of a pedantic registry.
+type labeledMetric struct {
+	desc   *prometheus.Desc
+	metric *dto.Metric
+}
+
+// Desc implements the prometheus.Metric interface.
+func (m labeledMetric) Desc() *prometheus.Desc {
+	return m.desc
+}
+
+// Write implements the prometheus.Metric interface.
+func (m labeledMetric) Write(out *dto.Metric) error {
+	out.Label = m.metric.Label
+	out.Gauge = m.metric.Gauge
+	out.Counter = m.metric.Counter
+	out.Summary = m.metric.Summary
+	out.Untyped = m.metric.Untyped
+	out.Histogram = m.metric.Histogram
+	out.TimestampMs = m.metric.TimestampMs
+	return nil
+}
+
+func sortLabelPairs(pairs []*dto.LabelPair) {
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].GetName() < pairs[j].GetName()
+	})
+}
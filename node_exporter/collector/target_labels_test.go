@@ -0,0 +1,129 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+var targetLabelsTestDesc = prometheus.NewDesc("node_target_labels_test", "Test metric.", []string{"device", "rack"}, nil)
+
+type targetLabelsTestCollector struct{}
+
+func (targetLabelsTestCollector) Update(ch chan<- prometheus.Metric) error {
+	ch <- prometheus.MustNewConstMetric(targetLabelsTestDesc, prometheus.GaugeValue, 1, "eth0", "r1")
+	return nil
+}
+
+func TestTargetLabels(t *testing.T) {
+	defer func(static map[string]string, host, collectors []string, sys, rootfs string) {
+		*targetLabelsStatic = static
+		*targetLabelsHost = host
+		*targetLabelsCollectors = collectors
+		*sysPath = sys
+		*rootfsPath = rootfs
+	}(*targetLabelsStatic, *targetLabelsHost, *targetLabelsCollectors, *sysPath, *rootfsPath)
+
+	rootfs, err := ioutil.TempDir("", "node-exporter-rootfs")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(rootfs)
+	if err := os.MkdirAll(filepath.Join(rootfs, "etc"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "etc/machine-id"), []byte("b3a7b3e0b1c04b4c9d0e6c3d3f0a1b2c\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(rootfs, "etc/os-release"), []byte("ID=ubuntu\nVERSION_ID=\"22.04\"\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	*targetLabelsStatic = map[string]string{"rack": "r12", "dc": "fra1"}
+	*targetLabelsHost = []string{hostLabelMachineID, hostLabelOSID, hostLabelOSVersionID, hostLabelProductName}
+	*targetLabelsCollectors = []string{"netdev"}
+	*sysPath = "fixtures/sys"
+	*rootfsPath = rootfs
+
+	labels, err := newTargetLabels()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var logs bytes.Buffer
+	nc := NodeCollector{
+		Collectors: map[string]Collector{
+			"netdev":  targetLabelsTestCollector{},
+			"netstat": errorTestCollector{},
+		},
+		targetLabels: labels,
+		logger:       log.NewLogfmtLogger(log.NewSyncWriter(&logs)),
+	}
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(nc)
+
+	want := `# HELP node_scrape_collector_success node_exporter: Whether a collector succeeded.
+# TYPE node_scrape_collector_success gauge
+node_scrape_collector_success{collector="netdev",dc="fra1",machine_id="b3a7b3e0b1c04b4c9d0e6c3d3f0a1b2c",os_id="ubuntu",os_version_id="22.04",product_name="PowerEdge R6515",rack="r12"} 1
+node_scrape_collector_success{collector="netstat"} 1
+# HELP node_target_labels_test Test metric.
+# TYPE node_target_labels_test gauge
+node_target_labels_test{dc="fra1",device="eth0",machine_id="b3a7b3e0b1c04b4c9d0e6c3d3f0a1b2c",os_id="ubuntu",os_version_id="22.04",product_name="PowerEdge R6515",rack="r1"} 1
+`
+	if err := testutil.GatherAndCompare(reg, strings.NewReader(want), "node_scrape_collector_success", "node_target_labels_test"); err != nil {
+		t.Error(err)
+	}
+
+	// The conflicting rack label is only logged on the first scrape.
+	if _, err := reg.Gather(); err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(logs.String(), "target label conflicts"); n != 1 {
+		t.Errorf("want conflict logged once, got %d times:\n%s", n, logs.String())
+	}
+}
+
+func TestTargetLabelsInvalid(t *testing.T) {
+	defer func(static map[string]string, host, collectors []string) {
+		*targetLabelsStatic = static
+		*targetLabelsHost = host
+		*targetLabelsCollectors = collectors
+	}(*targetLabelsStatic, *targetLabelsHost, *targetLabelsCollectors)
+
+	for _, test := range []struct {
+		static     map[string]string
+		host       []string
+		collectors []string
+	}{
+		{static: map[string]string{"1rack": "r12"}},
+		{static: map[string]string{"__rack": "r12"}},
+		{static: map[string]string{"os_id": "debian"}, host: []string{hostLabelOSID}},
+		{static: map[string]string{"rack": "r12"}, collectors: []string{"unknown"}},
+	} {
+		*targetLabelsStatic = test.static
+		*targetLabelsHost = test.host
+		*targetLabelsCollectors = test.collectors
+		if _, err := newTargetLabels(); err == nil {
+			t.Errorf("want error for %v, %v, %v", test.static, test.host, test.collectors)
+		}
+	}
+}
@@ -0,0 +1,404 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nowireguard
+// +build !nowireguard
+
+package collector
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/jsimonetti/rtnetlink"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sys/unix"
+	"gopkg.in/alecthomas/kingpin.v2"
+	"gopkg.in/yaml.v2"
+)
+
+const wireguardSubsystem = "wireguard"
+
+var (
+	wireguardPeerNamesFile = kingpin.Flag("collector.wireguard.peer-names-file", "YAML file mapping base64 encoded peer public keys to names exposed in the name label.").Default("").String()
+	wireguardHashKeys      = kingpin.Flag("collector.wireguard.hash-public-keys", "Expose the first 16 hex digits of the SHA-256 hash of public keys instead of the keys themselves.").Default("false").Bool()
+)
+
+// Constants from include/uapi/linux/wireguard.h.
+const (
+	wgCmdGetDevice = 0
+
+	wgDeviceAIfname     = 2
+	wgDeviceAPublicKey  = 4
+	wgDeviceAListenPort = 6
+	wgDeviceAPeers      = 8
+
+	wgPeerAPublicKey         = 1
+	wgPeerAEndpoint          = 4
+	wgPeerALastHandshakeTime = 6
+	wgPeerARxBytes           = 7
+	wgPeerATxBytes           = 8
+	wgPeerAAllowedIPs        = 9
+)
+
+type wireguardCollector struct {
+	newClient func() (wireguardClient, error)
+	names     map[string]string
+	hashKeys  bool
+
+	deviceInfo          typedDesc
+	deviceListenPort    typedDesc
+	peerInfo            typedDesc
+	peerLastHandshake   typedDesc
+	peerReceiveBytes    typedDesc
+	peerTransmitBytes   typedDesc
+	peerAllowedIPsCount typedDesc
+	logger              log.Logger
+}
+
+// wireguardClient is an interface used to swap out the netlink client in tests.
+type wireguardClient interface {
+	Devices() ([]*wireguardDevice, error)
+	Close() error
+}
+
+type wireguardDevice struct {
+	Name       string
+	PublicKey  []byte
+	ListenPort int
+	Peers      []*wireguardPeer
+}
+
+type wireguardPeer struct {
+	PublicKey     []byte
+	Endpoint      *net.UDPAddr
+	LastHandshake time.Time
+	ReceiveBytes  uint64
+	TransmitBytes uint64
+	AllowedIPs    int
+}
+
+func init() {
+	registerCollector("wireguard", defaultDisabled, NewWireGuardCollector)
+}
+
+// NewWireGuardCollector returns a new Collector exposing WireGuard device
+// and peer statistics.
+func NewWireGuardCollector(logger log.Logger) (Collector, error) {
+	names, err := readWireGuardPeerNames(*wireguardPeerNamesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	peerLabels := []string{"device", "public_key", "name"}
+	return &wireguardCollector{
+		newClient: newWireGuardNetlinkClient,
+		names:     names,
+		hashKeys:  *wireguardHashKeys,
+		deviceInfo: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, wireguardSubsystem, "device_info"),
+			"A metric with a constant '1' value labeled by device and public_key of a WireGuard interface.",
+			[]string{"device", "public_key"}, nil,
+		), prometheus.GaugeValue},
+		deviceListenPort: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, wireguardSubsystem, "device_listen_port"),
+			"UDP port the WireGuard interface listens on.",
+			[]string{"device"}, nil,
+		), prometheus.GaugeValue},
+		peerInfo: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, wireguardSubsystem, "peer_info"),
+			"A metric with a constant '1' value labeled by device, public_key, name and current endpoint of a WireGuard peer.",
+			[]string{"device", "public_key", "name", "endpoint"}, nil,
+		), prometheus.GaugeValue},
+		peerLastHandshake: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, wireguardSubsystem, "peer_last_handshake_timestamp_seconds"),
+			"Time of the last handshake with the peer, UNIX timestamp. 0 if no handshake took place.",
+			peerLabels, nil,
+		), prometheus.GaugeValue},
+		peerReceiveBytes: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, wireguardSubsystem, "peer_receive_bytes_total"),
+			"Number of bytes received from the peer.",
+			peerLabels, nil,
+		), prometheus.CounterValue},
+		peerTransmitBytes: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, wireguardSubsystem, "peer_transmit_bytes_total"),
+			"Number of bytes transmitted to the peer.",
+			peerLabels, nil,
+		), prometheus.CounterValue},
+		peerAllowedIPsCount: typedDesc{prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, wireguardSubsystem, "peer_allowed_ips"),
+			"Number of allowed IP ranges of the peer.",
+			peerLabels, nil,
+		), prometheus.GaugeValue},
+		logger: logger,
+	}, nil
+}
+
+// readWireGuardPeerNames reads a YAML file mapping public keys to names.
+func readWireGuardPeerNames(path string) (map[string]string, error) {
+	if path == "" {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read WireGuard peer names: %w", err)
+	}
+	names := make(map[string]string)
+	if err := yaml.UnmarshalStrict(data, &names); err != nil {
+		return nil, fmt.Errorf("failed to parse WireGuard peer names file %s: %w", path, err)
+	}
+	return names, nil
+}
+
+// Update implements Collector.
+func (c *wireguardCollector) Update(ch chan<- prometheus.Metric) error {
+	client, err := c.newClient()
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			level.Debug(c.logger).Log("msg", "WireGuard is not available on this system", "err", err)
+			return ErrNoData
+		}
+		if errors.Is(err, os.ErrPermission) {
+			level.Debug(c.logger).Log("msg", "WireGuard collector got permission denied when accessing netlink", "err", err)
+			return ErrNoData
+		}
+		return fmt.Errorf("failed to connect to WireGuard netlink: %w", err)
+	}
+	defer client.Close()
+
+	devices, err := client.Devices()
+	if err != nil {
+		return fmt.Errorf("failed to retrieve WireGuard devices: %w", err)
+	}
+
+	for _, d := range devices {
+		ch <- c.deviceInfo.mustNewConstMetric(1.0, d.Name, c.keyLabel(d.PublicKey))
+		ch <- c.deviceListenPort.mustNewConstMetric(float64(d.ListenPort), d.Name)
+
+		for _, p := range d.Peers {
+			key := c.keyLabel(p.PublicKey)
+			name := c.names[base64.StdEncoding.EncodeToString(p.PublicKey)]
+			endpoint := ""
+			if p.Endpoint != nil {
+				endpoint = p.Endpoint.String()
+			}
+			ch <- c.peerInfo.mustNewConstMetric(1.0, d.Name, key, name, endpoint)
+
+			var handshake float64
+			if !p.LastHandshake.IsZero() {
+				handshake = float64(p.LastHandshake.UnixNano()) / 1e9
+			}
+			ch <- c.peerLastHandshake.mustNewConstMetric(handshake, d.Name, key, name)
+			ch <- c.peerReceiveBytes.mustNewConstMetric(float64(p.ReceiveBytes), d.Name, key, name)
+			ch <- c.peerTransmitBytes.mustNewConstMetric(float64(p.TransmitBytes), d.Name, key, name)
+			ch <- c.peerAllowedIPsCount.mustNewConstMetric(float64(p.AllowedIPs), d.Name, key, name)
+		}
+	}
+	return nil
+}
+
+// keyLabel returns the label value for a public key, either the key in base64
+// like wg(8) shows it, or a shortened hash of it.
+func (c *wireguardCollector) keyLabel(key []byte) string {
+	if c.hashKeys {
+		sum := sha256.Sum256(key)
+		return hex.EncodeToString(sum[:8])
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+// wireguardNetlinkClient queries WireGuard devices through generic netlink.
+type wireguardNetlinkClient struct {
+	rtnl   *rtnetlink.Conn
+	genl   *genetlink.Conn
+	family genetlink.Family
+}
+
+func newWireGuardNetlinkClient() (wireguardClient, error) {
+	genl, err := genetlink.Dial(nil)
+	if err != nil {
+		return nil, err
+	}
+	family, err := genl.GetFamily("wireguard")
+	if err != nil {
+		genl.Close()
+		return nil, err
+	}
+	rtnl, err := rtnetlink.Dial(nil)
+	if err != nil {
+		genl.Close()
+		return nil, err
+	}
+	return &wireguardNetlinkClient{rtnl: rtnl, genl: genl, family: family}, nil
+}
+
+func (c *wireguardNetlinkClient) Close() error {
+	c.rtnl.Close()
+	return c.genl.Close()
+}
+
+func (c *wireguardNetlinkClient) Devices() ([]*wireguardDevice, error) {
+	links, err := c.rtnl.Link.ListByKind("wireguard")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list links: %w", err)
+	}
+
+	devices := make([]*wireguardDevice, 0, len(links))
+	for _, link := range links {
+		d, err := c.device(link.Attributes.Name)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get device %s: %w", link.Attributes.Name, err)
+		}
+		devices = append(devices, d)
+	}
+	return devices, nil
+}
+
+func (c *wireguardNetlinkClient) device(name string) (*wireguardDevice, error) {
+	req, err := netlink.MarshalAttributes([]netlink.Attribute{{
+		Type: wgDeviceAIfname,
+		Data: nlenc.Bytes(name),
+	}})
+	if err != nil {
+		return nil, err
+	}
+	msgs, err := c.genl.Execute(genetlink.Message{
+		Header: genetlink.Header{Command: wgCmdGetDevice, Version: c.family.Version},
+		Data:   req,
+	}, c.family.ID, netlink.Request|netlink.Dump)
+	if err != nil {
+		return nil, err
+	}
+	return parseWireGuardDevice(msgs)
+}
+
+// parseWireGuardDevice parses the reply to a WG_CMD_GET_DEVICE request. Large
+// devices are split over several messages, each carrying a part of the peers.
+func parseWireGuardDevice(msgs []genetlink.Message) (*wireguardDevice, error) {
+	d := &wireguardDevice{}
+	for _, m := range msgs {
+		ad, err := netlink.NewAttributeDecoder(m.Data)
+		if err != nil {
+			return nil, err
+		}
+		for ad.Next() {
+			switch ad.Type() {
+			case wgDeviceAIfname:
+				d.Name = ad.String()
+			case wgDeviceAPublicKey:
+				d.PublicKey = ad.Bytes()
+			case wgDeviceAListenPort:
+				d.ListenPort = int(ad.Uint16())
+			case wgDeviceAPeers:
+				ad.Nested(func(nad *netlink.AttributeDecoder) error {
+					for nad.Next() {
+						p := &wireguardPeer{}
+						nad.Nested(p.decode)
+						// A peer whose allowed IPs don't fit in one message
+						// is continued in the next one.
+						if n := len(d.Peers); n > 0 && string(d.Peers[n-1].PublicKey) == string(p.PublicKey) {
+							d.Peers[n-1].AllowedIPs += p.AllowedIPs
+							continue
+						}
+						d.Peers = append(d.Peers, p)
+					}
+					return nil
+				})
+			}
+		}
+		if err := ad.Err(); err != nil {
+			return nil, err
+		}
+	}
+	return d, nil
+}
+
+func (p *wireguardPeer) decode(ad *netlink.AttributeDecoder) error {
+	for ad.Next() {
+		switch ad.Type() {
+		case wgPeerAPublicKey:
+			p.PublicKey = ad.Bytes()
+		case wgPeerAEndpoint:
+			ad.Do(func(b []byte) error {
+				var err error
+				p.Endpoint, err = parseWireGuardEndpoint(b)
+				return err
+			})
+		case wgPeerALastHandshakeTime:
+			ad.Do(func(b []byte) error {
+				// struct __kernel_timespec
+				if len(b) != 16 {
+					return fmt.Errorf("invalid handshake time length %d", len(b))
+				}
+				sec := int64(nlenc.Uint64(b[:8]))
+				nsec := int64(nlenc.Uint64(b[8:]))
+				if sec != 0 || nsec != 0 {
+					p.LastHandshake = time.Unix(sec, nsec)
+				}
+				return nil
+			})
+		case wgPeerARxBytes:
+			p.ReceiveBytes = ad.Uint64()
+		case wgPeerATxBytes:
+			p.TransmitBytes = ad.Uint64()
+		case wgPeerAAllowedIPs:
+			ad.Nested(func(nad *netlink.AttributeDecoder) error {
+				for nad.Next() {
+					p.AllowedIPs++
+				}
+				return nil
+			})
+		}
+	}
+	return nil
+}
+
+// parseWireGuardEndpoint parses a struct sockaddr_in or sockaddr_in6.
+func parseWireGuardEndpoint(b []byte) (*net.UDPAddr, error) {
+	if len(b) < 4 {
+		return nil, fmt.Errorf("invalid endpoint length %d", len(b))
+	}
+	port := int(binary.BigEndian.Uint16(b[2:4]))
+	switch family := nlenc.Uint16(b[:2]); family {
+	case unix.AF_INET:
+		if len(b) < unix.SizeofSockaddrInet4 {
+			return nil, fmt.Errorf("invalid IPv4 endpoint length %d", len(b))
+		}
+		return &net.UDPAddr{IP: net.IP(append([]byte(nil), b[4:8]...)), Port: port}, nil
+	case unix.AF_INET6:
+		if len(b) < unix.SizeofSockaddrInet6 {
+			return nil, fmt.Errorf("invalid IPv6 endpoint length %d", len(b))
+		}
+		addr := &net.UDPAddr{IP: net.IP(append([]byte(nil), b[8:24]...)), Port: port}
+		if scope := nlenc.Uint32(b[24:28]); scope != 0 {
+			addr.Zone = strconv.FormatUint(uint64(scope), 10)
+		}
+		return addr, nil
+	default:
+		return nil, fmt.Errorf("unknown endpoint address family %d", family)
+	}
+}
@@ -0,0 +1,239 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nowireguard
+// +build !nowireguard
+
+package collector
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/mdlayher/genetlink"
+	"github.com/mdlayher/netlink"
+	"github.com/mdlayher/netlink/nlenc"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"golang.org/x/sys/unix"
+)
+
+type fakeWireGuardClient struct {
+	devices []*wireguardDevice
+}
+
+func (c *fakeWireGuardClient) Devices() ([]*wireguardDevice, error) { return c.devices, nil }
+func (c *fakeWireGuardClient) Close() error                         { return nil }
+
+func wireguardKey(b byte) []byte {
+	return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestWireGuardCollector(t *testing.T) {
+	namesFile := filepath.Join(t.TempDir(), "names.yml")
+	if err := ioutil.WriteFile(namesFile, []byte("AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE=: office\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer func(file string, hash bool) {
+		*wireguardPeerNamesFile = file
+		*wireguardHashKeys = hash
+	}(*wireguardPeerNamesFile, *wireguardHashKeys)
+
+	client := &fakeWireGuardClient{devices: []*wireguardDevice{{
+		Name:       "wg0",
+		PublicKey:  wireguardKey(0),
+		ListenPort: 51820,
+		Peers: []*wireguardPeer{
+			{
+				PublicKey:     wireguardKey(1),
+				Endpoint:      &net.UDPAddr{IP: net.ParseIP("192.0.2.1"), Port: 51820},
+				LastHandshake: time.Unix(1650000000, 500000000),
+				ReceiveBytes:  1024,
+				TransmitBytes: 2048,
+				AllowedIPs:    2,
+			},
+			{
+				PublicKey:  wireguardKey(2),
+				AllowedIPs: 1,
+			},
+		},
+	}}}
+
+	for _, tc := range []struct {
+		hash bool
+		want string
+	}{
+		{
+			want: `# HELP node_wireguard_device_info A metric with a constant '1' value labeled by device and public_key of a WireGuard interface.
+# TYPE node_wireguard_device_info gauge
+node_wireguard_device_info{device="wg0",public_key="AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA="} 1
+# HELP node_wireguard_device_listen_port UDP port the WireGuard interface listens on.
+# TYPE node_wireguard_device_listen_port gauge
+node_wireguard_device_listen_port{device="wg0"} 51820
+# HELP node_wireguard_peer_allowed_ips Number of allowed IP ranges of the peer.
+# TYPE node_wireguard_peer_allowed_ips gauge
+node_wireguard_peer_allowed_ips{device="wg0",name="",public_key="AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI="} 1
+node_wireguard_peer_allowed_ips{device="wg0",name="office",public_key="AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="} 2
+# HELP node_wireguard_peer_info A metric with a constant '1' value labeled by device, public_key, name and current endpoint of a WireGuard peer.
+# TYPE node_wireguard_peer_info gauge
+node_wireguard_peer_info{device="wg0",endpoint="",name="",public_key="AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI="} 1
+node_wireguard_peer_info{device="wg0",endpoint="192.0.2.1:51820",name="office",public_key="AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="} 1
+# HELP node_wireguard_peer_last_handshake_timestamp_seconds Time of the last handshake with the peer, UNIX timestamp. 0 if no handshake took place.
+# TYPE node_wireguard_peer_last_handshake_timestamp_seconds gauge
+node_wireguard_peer_last_handshake_timestamp_seconds{device="wg0",name="",public_key="AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI="} 0
+node_wireguard_peer_last_handshake_timestamp_seconds{device="wg0",name="office",public_key="AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="} 1.6500000005e+09
+# HELP node_wireguard_peer_receive_bytes_total Number of bytes received from the peer.
+# TYPE node_wireguard_peer_receive_bytes_total counter
+node_wireguard_peer_receive_bytes_total{device="wg0",name="",public_key="AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI="} 0
+node_wireguard_peer_receive_bytes_total{device="wg0",name="office",public_key="AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="} 1024
+# HELP node_wireguard_peer_transmit_bytes_total Number of bytes transmitted to the peer.
+# TYPE node_wireguard_peer_transmit_bytes_total counter
+node_wireguard_peer_transmit_bytes_total{device="wg0",name="",public_key="AgICAgICAgICAgICAgICAgICAgICAgICAgICAgICAgI="} 0
+node_wireguard_peer_transmit_bytes_total{device="wg0",name="office",public_key="AQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQEBAQE="} 2048
+`,
+		},
+		{
+			hash: true,
+			want: `# HELP node_wireguard_device_info A metric with a constant '1' value labeled by device and public_key of a WireGuard interface.
+# TYPE node_wireguard_device_info gauge
+node_wireguard_device_info{device="wg0",public_key="66687aadf862bd77"} 1
+# HELP node_wireguard_peer_info A metric with a constant '1' value labeled by device, public_key, name and current endpoint of a WireGuard peer.
+# TYPE node_wireguard_peer_info gauge
+node_wireguard_peer_info{device="wg0",endpoint="",name="",public_key="75877bb41d393b5f"} 1
+node_wireguard_peer_info{device="wg0",endpoint="192.0.2.1:51820",name="office",public_key="72cd6e8422c407fb"} 1
+`,
+		},
+	} {
+		*wireguardPeerNamesFile = namesFile
+		*wireguardHashKeys = tc.hash
+		c, err := NewWireGuardCollector(log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		c.(*wireguardCollector).newClient = func() (wireguardClient, error) { return client, nil }
+
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(collectorAdapter{c})
+		names := []string{"node_wireguard_device_info", "node_wireguard_peer_info"}
+		if !tc.hash {
+			names = append(names,
+				"node_wireguard_device_listen_port",
+				"node_wireguard_peer_allowed_ips",
+				"node_wireguard_peer_last_handshake_timestamp_seconds",
+				"node_wireguard_peer_receive_bytes_total",
+				"node_wireguard_peer_transmit_bytes_total",
+			)
+		}
+		if err := testutil.GatherAndCompare(registry, strings.NewReader(tc.want), names...); err != nil {
+			t.Errorf("hash=%v: %v", tc.hash, err)
+		}
+	}
+}
+
+func TestParseWireGuardDevice(t *testing.T) {
+	sockaddr := make([]byte, unix.SizeofSockaddrInet6)
+	copy(sockaddr, nlenc.Uint16Bytes(unix.AF_INET6))
+	binary.BigEndian.PutUint16(sockaddr[2:], 51820)
+	copy(sockaddr[8:], net.ParseIP("2001:db8::1"))
+
+	handshake := make([]byte, 16)
+	nlenc.PutUint64(handshake[:8], 1650000000)
+	nlenc.PutUint64(handshake[8:], 250000000)
+
+	allowedIPs := func(n int) func(*netlink.AttributeEncoder) error {
+		return func(ae *netlink.AttributeEncoder) error {
+			for i := 0; i < n; i++ {
+				ae.Nested(uint16(i), func(ae *netlink.AttributeEncoder) error {
+					ae.Uint16(1, unix.AF_INET)
+					ae.Bytes(2, net.IPv4(10, 0, 0, byte(i)).To4())
+					ae.Uint8(3, 32)
+					return nil
+				})
+			}
+			return nil
+		}
+	}
+
+	// The first message carries the device and the first part of the
+	// peer, the second one the rest of its allowed IPs.
+	first := netlink.NewAttributeEncoder()
+	first.String(wgDeviceAIfname, "wg0")
+	first.Bytes(wgDeviceAPublicKey, wireguardKey(0))
+	first.Uint16(wgDeviceAListenPort, 51820)
+	first.Nested(wgDeviceAPeers, func(ae *netlink.AttributeEncoder) error {
+		ae.Nested(0, func(ae *netlink.AttributeEncoder) error {
+			ae.Bytes(wgPeerAPublicKey, wireguardKey(1))
+			ae.Bytes(wgPeerAEndpoint, sockaddr)
+			ae.Bytes(wgPeerALastHandshakeTime, handshake)
+			ae.Uint64(wgPeerARxBytes, 100)
+			ae.Uint64(wgPeerATxBytes, 200)
+			ae.Nested(wgPeerAAllowedIPs, allowedIPs(2))
+			return nil
+		})
+		return nil
+	})
+	second := netlink.NewAttributeEncoder()
+	second.String(wgDeviceAIfname, "wg0")
+	second.Nested(wgDeviceAPeers, func(ae *netlink.AttributeEncoder) error {
+		ae.Nested(0, func(ae *netlink.AttributeEncoder) error {
+			ae.Bytes(wgPeerAPublicKey, wireguardKey(1))
+			ae.Nested(wgPeerAAllowedIPs, allowedIPs(3))
+			return nil
+		})
+		ae.Nested(1, func(ae *netlink.AttributeEncoder) error {
+			ae.Bytes(wgPeerAPublicKey, wireguardKey(2))
+			return nil
+		})
+		return nil
+	})
+
+	var msgs []genetlink.Message
+	for _, ae := range []*netlink.AttributeEncoder{first, second} {
+		b, err := ae.Encode()
+		if err != nil {
+			t.Fatal(err)
+		}
+		msgs = append(msgs, genetlink.Message{Data: b})
+	}
+
+	d, err := parseWireGuardDevice(msgs)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.Name != "wg0" || d.ListenPort != 51820 || !bytes.Equal(d.PublicKey, wireguardKey(0)) {
+		t.Errorf("unexpected device: %+v", d)
+	}
+	if len(d.Peers) != 2 {
+		t.Fatalf("want 2 peers, got %d", len(d.Peers))
+	}
+	p := d.Peers[0]
+	if got, want := p.Endpoint.String(), "[2001:db8::1]:51820"; got != want {
+		t.Errorf("want endpoint %s, got %s", want, got)
+	}
+	if want := time.Unix(1650000000, 250000000); !p.LastHandshake.Equal(want) {
+		t.Errorf("want handshake %v, got %v", want, p.LastHandshake)
+	}
+	if p.ReceiveBytes != 100 || p.TransmitBytes != 200 || p.AllowedIPs != 5 {
+		t.Errorf("unexpected peer: %+v", p)
+	}
+	if p := d.Peers[1]; !bytes.Equal(p.PublicKey, wireguardKey(2)) || p.Endpoint != nil || !p.LastHandshake.IsZero() {
+		t.Errorf("unexpected peer: %+v", p)
+	}
+}
@@ -39,6 +39,7 @@ type zfsCollector struct {
 	linuxZpoolObjsetPath string
 	linuxZpoolStatePath  string
 	linuxPathMap         map[string]string
+	zpoolStatusMetrics   *zpoolStatusMetrics
 	logger               log.Logger
 }
 
@@ -62,7 +63,8 @@ func NewZFSCollector(logger log.Logger) (Collector, error) {
 			"zfs_zfetch":      "zfetchstats",
 			"zfs_zil":         "zil",
 		},
-		logger: logger,
+		zpoolStatusMetrics: newZpoolStatusMetrics(),
+		logger:             logger,
 	}, nil
 }
 
@@ -87,7 +89,13 @@ func (c *zfsCollector) Update(ch chan<- prometheus.Metric) error {
 	}
 
 	// Pool stats
-	return c.updatePoolStats(ch)
+	if err := c.updatePoolStats(ch); err != nil {
+		return err
+	}
+
+	// Vdev and scan stats
+	c.updateZpoolStatus(ch)
+	return nil
 }
 
 func (s zfsSysctl) metricName() string {
@@ -17,9 +17,17 @@
 package collector
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestArcstatsParsing(t *testing.T) {
@@ -546,3 +554,189 @@ func TestPoolStateParsing(t *testing.T) {
 	}
 
 }
+
+func TestZpoolStatusParsing(t *testing.T) {
+	file, err := os.Open("fixtures/zfs/zpool-status.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	pools, err := parseZpoolStatus(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 2 {
+		t.Fatalf("Expected 2 pools, got %d", len(pools))
+	}
+
+	var vdevs []string
+	for _, vdev := range pools[1].vdevs {
+		vdevs = append(vdevs, fmt.Sprintf("%s %s %s %d %d %d", vdev.name, vdev.vdevType, vdev.state, vdev.read, vdev.write, vdev.checksum))
+	}
+	want := []string{
+		"poolz1 root degraded 0 0 0",
+		"raidz1-0 raidz1 degraded 0 0 0",
+		"sdc disk online 0 0 0",
+		"replacing-1 replacing degraded 0 0 0",
+		"sdd disk faulted 12 74 0",
+		"sdg disk online 0 0 0",
+		"/var/tmp/zfs/disk3 file offline 0 0 0",
+	}
+	if !reflect.DeepEqual(vdevs, want) {
+		t.Errorf("Unexpected vdevs of pool poolz1, want %q, got %q", want, vdevs)
+	}
+
+	scan := pools[1].scan
+	if scan == nil || scan.function != "resilver" || !scan.running || scan.progress != 0.25 ||
+		scan.examined != 1649267441664 || scan.issued != 824633720832 || scan.total != 3298534883328 || scan.processed != 273804165120 {
+		t.Errorf("Unexpected scan of pool poolz1: %+v", scan)
+	}
+}
+
+func TestZpoolStatusParsingSpares(t *testing.T) {
+	file, err := os.Open("fixtures/zfs/zpool-status-spare.txt")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	pools, err := parseZpoolStatus(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pools) != 1 {
+		t.Fatalf("Expected 1 pool, got %d", len(pools))
+	}
+
+	var vdevs []string
+	for _, vdev := range pools[0].vdevs {
+		vdevs = append(vdevs, fmt.Sprintf("%s %s %s", vdev.name, vdev.vdevType, vdev.state))
+	}
+	// The spares section is not part of the vdev tree.
+	want := []string{
+		"tank root degraded",
+		"mirror-0 mirror degraded",
+		"sde disk online",
+		"spare-1 spare degraded",
+		"sdf disk unavail",
+		"sdh disk online",
+	}
+	if !reflect.DeepEqual(vdevs, want) {
+		t.Errorf("Unexpected vdevs of pool tank, want %q, got %q", want, vdevs)
+	}
+	if scan := pools[0].scan; scan == nil || scan.progress != 0.5 {
+		t.Errorf("Unexpected scan of pool tank: %+v", scan)
+	}
+}
+
+func TestZpoolStatusMetrics(t *testing.T) {
+	defer func(proc, command string, timeout time.Duration, local *time.Location) {
+		*procPath = proc
+		*zpoolStatusCommand = command
+		*zpoolStatusTimeout = timeout
+		time.Local = local
+	}(*procPath, *zpoolStatusCommand, *zpoolStatusTimeout, time.Local)
+	*procPath = "fixtures/proc"
+	*zpoolStatusCommand = "cat fixtures/zfs/zpool-status.txt"
+	*zpoolStatusTimeout = 10 * time.Second
+	time.Local = time.UTC
+
+	c, err := NewZFSCollector(log.NewNopLogger())
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `# HELP node_zfs_zpool_scan_end_timestamp_seconds Unix timestamp the last scrub or resilver of a pool finished or was canceled.
+# TYPE node_zfs_zpool_scan_end_timestamp_seconds gauge
+node_zfs_zpool_scan_end_timestamp_seconds{function="scrub",zpool="pool1"} 1.665275802e+09
+# HELP node_zfs_zpool_scan_progress_ratio Progress of the running or paused scrub or resilver of a pool.
+# TYPE node_zfs_zpool_scan_progress_ratio gauge
+node_zfs_zpool_scan_progress_ratio{function="resilver",zpool="poolz1"} 0.25
+# HELP node_zfs_zpool_scan_running Whether the scrub or resilver of a pool is running.
+# TYPE node_zfs_zpool_scan_running gauge
+node_zfs_zpool_scan_running{function="resilver",zpool="poolz1"} 1
+node_zfs_zpool_scan_running{function="scrub",zpool="pool1"} 0
+# HELP node_zfs_zpool_scan_start_timestamp_seconds Unix timestamp the running or paused scrub or resilver of a pool started.
+# TYPE node_zfs_zpool_scan_start_timestamp_seconds gauge
+node_zfs_zpool_scan_start_timestamp_seconds{function="resilver",zpool="poolz1"} 1.6653933e+09
+# HELP node_zfs_zpool_status_success Whether the zpool status command succeeded.
+# TYPE node_zfs_zpool_status_success gauge
+node_zfs_zpool_status_success 1
+# HELP node_zfs_zpool_vdev_checksum_errors_total Number of checksum errors of a vdev since the pool was imported or cleared.
+# TYPE node_zfs_zpool_vdev_checksum_errors_total counter
+node_zfs_zpool_vdev_checksum_errors_total{type="file",vdev="/var/tmp/zfs/disk3",zpool="poolz1"} 0
+node_zfs_zpool_vdev_checksum_errors_total{type="disk",vdev="nvme0n1p1",zpool="pool1"} 0
+node_zfs_zpool_vdev_checksum_errors_total{type="disk",vdev="nvme0n1p2",zpool="pool1"} 0
+node_zfs_zpool_vdev_checksum_errors_total{type="disk",vdev="sda",zpool="pool1"} 0
+node_zfs_zpool_vdev_checksum_errors_total{type="disk",vdev="sdb",zpool="pool1"} 2
+node_zfs_zpool_vdev_checksum_errors_total{type="disk",vdev="sdc",zpool="poolz1"} 0
+node_zfs_zpool_vdev_checksum_errors_total{type="disk",vdev="sdd",zpool="poolz1"} 0
+node_zfs_zpool_vdev_checksum_errors_total{type="disk",vdev="sdg",zpool="poolz1"} 0
+node_zfs_zpool_vdev_checksum_errors_total{type="mirror",vdev="mirror-0",zpool="pool1"} 0
+node_zfs_zpool_vdev_checksum_errors_total{type="raidz1",vdev="raidz1-0",zpool="poolz1"} 0
+node_zfs_zpool_vdev_checksum_errors_total{type="replacing",vdev="replacing-1",zpool="poolz1"} 0
+node_zfs_zpool_vdev_checksum_errors_total{type="root",vdev="pool1",zpool="pool1"} 0
+node_zfs_zpool_vdev_checksum_errors_total{type="root",vdev="poolz1",zpool="poolz1"} 0
+# HELP node_zfs_zpool_vdev_read_errors_total Number of read errors of a vdev since the pool was imported or cleared.
+# TYPE node_zfs_zpool_vdev_read_errors_total counter
+node_zfs_zpool_vdev_read_errors_total{type="file",vdev="/var/tmp/zfs/disk3",zpool="poolz1"} 0
+node_zfs_zpool_vdev_read_errors_total{type="disk",vdev="nvme0n1p1",zpool="pool1"} 0
+node_zfs_zpool_vdev_read_errors_total{type="disk",vdev="nvme0n1p2",zpool="pool1"} 0
+node_zfs_zpool_vdev_read_errors_total{type="disk",vdev="sda",zpool="pool1"} 0
+node_zfs_zpool_vdev_read_errors_total{type="disk",vdev="sdb",zpool="pool1"} 0
+node_zfs_zpool_vdev_read_errors_total{type="disk",vdev="sdc",zpool="poolz1"} 0
+node_zfs_zpool_vdev_read_errors_total{type="disk",vdev="sdd",zpool="poolz1"} 12
+node_zfs_zpool_vdev_read_errors_total{type="disk",vdev="sdg",zpool="poolz1"} 0
+node_zfs_zpool_vdev_read_errors_total{type="mirror",vdev="mirror-0",zpool="pool1"} 0
+node_zfs_zpool_vdev_read_errors_total{type="raidz1",vdev="raidz1-0",zpool="poolz1"} 0
+node_zfs_zpool_vdev_read_errors_total{type="replacing",vdev="replacing-1",zpool="poolz1"} 0
+node_zfs_zpool_vdev_read_errors_total{type="root",vdev="pool1",zpool="pool1"} 0
+node_zfs_zpool_vdev_read_errors_total{type="root",vdev="poolz1",zpool="poolz1"} 0
+`
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(collectorAdapter{c})
+	err = testutil.GatherAndCompare(registry, strings.NewReader(want),
+		"node_zfs_zpool_scan_end_timestamp_seconds",
+		"node_zfs_zpool_scan_progress_ratio",
+		"node_zfs_zpool_scan_running",
+		"node_zfs_zpool_scan_start_timestamp_seconds",
+		"node_zfs_zpool_status_success",
+		"node_zfs_zpool_vdev_checksum_errors_total",
+		"node_zfs_zpool_vdev_read_errors_total",
+	)
+	if err != nil {
+		t.Error(err)
+	}
+}
+
+func TestZpoolStatusFailure(t *testing.T) {
+	defer func(proc, command string, timeout time.Duration) {
+		*procPath = proc
+		*zpoolStatusCommand = command
+		*zpoolStatusTimeout = timeout
+	}(*procPath, *zpoolStatusCommand, *zpoolStatusTimeout)
+	*procPath = "fixtures/proc"
+	*zpoolStatusTimeout = 100 * time.Millisecond
+
+	want := `# HELP node_zfs_zpool_status_success Whether the zpool status command succeeded.
+# TYPE node_zfs_zpool_status_success gauge
+node_zfs_zpool_status_success 0
+`
+	// The wrapper leaves a child holding its output behind.
+	for _, command := range []string{"false", "sleep 10", "sh fixtures/exec_helper/wrapper.sh", "echo scan: invalid"} {
+		*zpoolStatusCommand = command
+		begin := time.Now()
+		c, err := NewZFSCollector(log.NewNopLogger())
+		if err != nil {
+			t.Fatal(err)
+		}
+		registry := prometheus.NewRegistry()
+		registry.MustRegister(collectorAdapter{c})
+		if err := testutil.GatherAndCompare(registry, strings.NewReader(want), "node_zfs_zpool_status_success"); err != nil {
+			t.Errorf("%s: %v", command, err)
+		}
+		if elapsed := time.Since(begin); elapsed > 5*time.Second {
+			t.Errorf("%s: want the command killed on timeout, took %s", command, elapsed)
+		}
+	}
+}
@@ -0,0 +1,439 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !nozfs
+// +build !nozfs
+
+package collector
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"regexp"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/client_golang/prometheus"
+	"gopkg.in/alecthomas/kingpin.v2"
+)
+
+// The kstats of ZFS don't describe the vdevs of pools, so the vdev tree,
+// its error counters and the progress of scrubs and resilvers are read from
+// the output of zpool status. Reading them from the kernel would need the
+// nvlist based ZFS_IOC_POOL_STATS ioctl of libzfs, which has no stable ABI,
+// so running the command is opt-in.
+var (
+	zpoolStatusCommand = kingpin.Flag("collector.zfs.zpool-status-command", "Command (with arguments) printing the output of 'zpool status -p', used to collect vdev and scan metrics. Disabled if empty.").Default("").String()
+	zpoolStatusTimeout = kingpin.Flag("collector.zfs.zpool-status-timeout", "Timeout after which the zpool status command is killed.").Default("10s").Duration()
+)
+
+var (
+	zpoolScanFinishedRE = regexp.MustCompile(`^(scrub repaired|resilvered) (\S+) in .* with (\d+) errors on (.+)$`)
+	zpoolScanRunningRE  = regexp.MustCompile(`^(scrub|resilver) (in progress|paused) since (.+)$`)
+	zpoolScanCanceledRE = regexp.MustCompile(`^(scrub|resilver) canceled on (.+)$`)
+	// Since ZFS 0.8 scans are split into scanning and issuing the I/O.
+	zpoolScanIssuedRE    = regexp.MustCompile(`(\S+) scanned at \S+, (\S+) issued at \S+, (\S+) total`)
+	zpoolScanScannedRE   = regexp.MustCompile(`(\S+) scanned out of (\S+) at`)
+	zpoolScanProcessedRE = regexp.MustCompile(`(\S+) (?:repaired|resilvered), ([\d.]+)% done`)
+	zpoolVdevGroupRE     = regexp.MustCompile(`^([a-z]+\d*)(:\S*)?-\d+$`)
+)
+
+// zpoolStatus is a pool as described by zpool status.
+type zpoolStatus struct {
+	name  string
+	vdevs []zpoolVdev
+	// scan is nil if the pool has never been scrubbed or resilvered.
+	scan *zpoolScan
+}
+
+type zpoolVdev struct {
+	name     string
+	vdevType string
+	state    string
+	read     uint64
+	write    uint64
+	checksum uint64
+	depth    int
+}
+
+// zpoolScan is the last or running scrub or resilver of a pool.
+type zpoolScan struct {
+	function  string
+	running   bool
+	finished  bool
+	start     time.Time
+	end       time.Time
+	errors    uint64
+	examined  uint64
+	issued    uint64
+	total     uint64
+	processed uint64
+	// progress is negative if unknown.
+	progress float64
+}
+
+type zpoolStatusMetrics struct {
+	success            typedDesc
+	vdevState          typedDesc
+	vdevReadErrors     typedDesc
+	vdevWriteErrors    typedDesc
+	vdevChecksumErrors typedDesc
+	scanRunning        typedDesc
+	scanProgress       typedDesc
+	scanStart          typedDesc
+	scanEnd            typedDesc
+	scanErrors         typedDesc
+	scanExamined       typedDesc
+	scanIssued         typedDesc
+	scanTotal          typedDesc
+	scanProcessed      typedDesc
+}
+
+func newZpoolStatusMetrics() *zpoolStatusMetrics {
+	const subsystem = "zfs_zpool"
+	var (
+		vdevLabels = []string{"zpool", "vdev", "type"}
+		scanLabels = []string{"zpool", "function"}
+	)
+	desc := func(name, help string, labels []string, valueType prometheus.ValueType) typedDesc {
+		return typedDesc{prometheus.NewDesc(prometheus.BuildFQName(namespace, subsystem, name), help, labels, nil), valueType}
+	}
+	return &zpoolStatusMetrics{
+		success:            desc("status_success", "Whether the zpool status command succeeded.", nil, prometheus.GaugeValue),
+		vdevState:          desc("vdev_state", "State of a vdev as reported by zpool status.", append(vdevLabels, "state"), prometheus.GaugeValue),
+		vdevReadErrors:     desc("vdev_read_errors_total", "Number of read errors of a vdev since the pool was imported or cleared.", vdevLabels, prometheus.CounterValue),
+		vdevWriteErrors:    desc("vdev_write_errors_total", "Number of write errors of a vdev since the pool was imported or cleared.", vdevLabels, prometheus.CounterValue),
+		vdevChecksumErrors: desc("vdev_checksum_errors_total", "Number of checksum errors of a vdev since the pool was imported or cleared.", vdevLabels, prometheus.CounterValue),
+		scanRunning:        desc("scan_running", "Whether the scrub or resilver of a pool is running.", scanLabels, prometheus.GaugeValue),
+		scanProgress:       desc("scan_progress_ratio", "Progress of the running or paused scrub or resilver of a pool.", scanLabels, prometheus.GaugeValue),
+		scanStart:          desc("scan_start_timestamp_seconds", "Unix timestamp the running or paused scrub or resilver of a pool started.", scanLabels, prometheus.GaugeValue),
+		scanEnd:            desc("scan_end_timestamp_seconds", "Unix timestamp the last scrub or resilver of a pool finished or was canceled.", scanLabels, prometheus.GaugeValue),
+		scanErrors:         desc("scan_errors", "Number of errors found by the last scrub or resilver of a pool.", scanLabels, prometheus.GaugeValue),
+		scanExamined:       desc("scan_examined_bytes", "Amount of data examined by the running or paused scrub or resilver of a pool.", scanLabels, prometheus.GaugeValue),
+		scanIssued:         desc("scan_issued_bytes", "Amount of data the running or paused scrub or resilver of a pool issued I/O for.", scanLabels, prometheus.GaugeValue),
+		scanTotal:          desc("scan_total_bytes", "Amount of data to be processed by the running or paused scrub or resilver of a pool.", scanLabels, prometheus.GaugeValue),
+		scanProcessed:      desc("scan_processed_bytes", "Amount of data repaired by a scrub or resilvered by a resilver of a pool.", scanLabels, prometheus.GaugeValue),
+	}
+}
+
+// updateZpoolStatus exports the vdev and scan metrics of all pools. A failing
+// zpool status command is reported by node_zfs_zpool_status_success instead
+// of failing the whole collector.
+func (c *zfsCollector) updateZpoolStatus(ch chan<- prometheus.Metric) {
+	command := strings.Fields(*zpoolStatusCommand)
+	if len(command) == 0 {
+		return
+	}
+
+	m := c.zpoolStatusMetrics
+	pools, err := readZpoolStatus(command)
+	if err != nil {
+		level.Error(c.logger).Log("msg", "Failed to read zpool status", "err", err)
+		ch <- m.success.mustNewConstMetric(0)
+		return
+	}
+	ch <- m.success.mustNewConstMetric(1)
+
+	for _, pool := range pools {
+		for _, vdev := range pool.vdevs {
+			for _, stateName := range zfsPoolStatesName {
+				isActive := 0.0
+				if vdev.state == stateName {
+					isActive = 1
+				}
+				ch <- m.vdevState.mustNewConstMetric(isActive, pool.name, vdev.name, vdev.vdevType, stateName)
+			}
+			ch <- m.vdevReadErrors.mustNewConstMetric(float64(vdev.read), pool.name, vdev.name, vdev.vdevType)
+			ch <- m.vdevWriteErrors.mustNewConstMetric(float64(vdev.write), pool.name, vdev.name, vdev.vdevType)
+			ch <- m.vdevChecksumErrors.mustNewConstMetric(float64(vdev.checksum), pool.name, vdev.name, vdev.vdevType)
+		}
+
+		scan := pool.scan
+		if scan == nil {
+			continue
+		}
+		running := 0.0
+		if scan.running {
+			running = 1
+		}
+		ch <- m.scanRunning.mustNewConstMetric(running, pool.name, scan.function)
+		if !scan.start.IsZero() {
+			ch <- m.scanStart.mustNewConstMetric(float64(scan.start.Unix()), pool.name, scan.function)
+			ch <- m.scanExamined.mustNewConstMetric(float64(scan.examined), pool.name, scan.function)
+			ch <- m.scanIssued.mustNewConstMetric(float64(scan.issued), pool.name, scan.function)
+			ch <- m.scanTotal.mustNewConstMetric(float64(scan.total), pool.name, scan.function)
+		}
+		if !scan.end.IsZero() {
+			ch <- m.scanEnd.mustNewConstMetric(float64(scan.end.Unix()), pool.name, scan.function)
+		}
+		if scan.finished {
+			ch <- m.scanErrors.mustNewConstMetric(float64(scan.errors), pool.name, scan.function)
+		}
+		if scan.progress >= 0 {
+			ch <- m.scanProgress.mustNewConstMetric(scan.progress, pool.name, scan.function)
+		}
+		// A canceled scan doesn't report what it processed.
+		if scan.finished || !scan.start.IsZero() {
+			ch <- m.scanProcessed.mustNewConstMetric(float64(scan.processed), pool.name, scan.function)
+		}
+	}
+}
+
+// readZpoolStatus runs the zpool status command and parses its output.
+func readZpoolStatus(command []string) ([]zpoolStatus, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(command[0], command[1:]...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	// Run the command in its own process group, so that a zpool started by
+	// a wrapper like sudo is killed on timeout as well.
+	cmd.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	err := cmd.Start()
+	if err == nil {
+		timer := time.AfterFunc(*zpoolStatusTimeout, func() {
+			syscall.Kill(-cmd.Process.Pid, syscall.SIGKILL)
+		})
+		err = cmd.Wait()
+		if !timer.Stop() {
+			err = fmt.Errorf("timed out after %s", *zpoolStatusTimeout)
+		}
+	}
+	if err != nil {
+		return nil, fmt.Errorf("zpool status command failed: %w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	pools, err := parseZpoolStatus(&stdout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse zpool status: %w", err)
+	}
+	return pools, nil
+}
+
+// parseZpoolStatus parses the output of zpool status. The sections of a pool
+// start with a "pool:" line, the vdev tree follows the "config:" line and
+// is indented by two spaces per level.
+func parseZpoolStatus(r io.Reader) ([]zpoolStatus, error) {
+	var (
+		pools   []zpoolStatus
+		pool    *zpoolStatus
+		section string
+		inTree  bool
+		// inSpares is set in the spares section of the vdev tree.
+		inSpares bool
+	)
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if i := strings.Index(line, ":"); i >= 0 && !strings.HasPrefix(line, "\t") {
+			section = strings.TrimSpace(line[:i])
+			value := strings.TrimSpace(line[i+1:])
+			inTree = false
+			switch section {
+			case "pool":
+				pools = append(pools, zpoolStatus{name: value})
+				pool = &pools[len(pools)-1]
+			case "scan":
+				if pool == nil {
+					return nil, fmt.Errorf("scan line outside of a pool: %q", line)
+				}
+				scan, err := parseZpoolScan(value)
+				if err != nil {
+					return nil, fmt.Errorf("invalid scan of pool %s: %w", pool.name, err)
+				}
+				pool.scan = scan
+			}
+			continue
+		}
+		if pool == nil || trimmed == "" {
+			continue
+		}
+
+		switch section {
+		case "scan":
+			if pool.scan != nil {
+				if err := parseZpoolScanProgress(pool.scan, trimmed); err != nil {
+					return nil, fmt.Errorf("invalid scan progress of pool %s: %w", pool.name, err)
+				}
+			}
+		case "config":
+			fields := strings.Fields(trimmed)
+			if fields[0] == "NAME" {
+				inTree = true
+				continue
+			}
+			if !inTree {
+				continue
+			}
+			depth := (len(strings.TrimPrefix(line, "\t")) - len(strings.TrimLeft(strings.TrimPrefix(line, "\t"), " "))) / 2
+			if depth == 0 {
+				inSpares = fields[0] == "spares"
+			}
+			// Spares don't have error counters, and spares in use are
+			// followed by a note, e.g. "sdh INUSE currently in use".
+			if inSpares {
+				continue
+			}
+			// Spares and the headings of the log, cache, special and dedup
+			// vdev classes don't have error counters.
+			if len(fields) < 5 {
+				continue
+			}
+			vdev := zpoolVdev{name: fields[0], state: strings.ToLower(fields[1]), depth: depth}
+			for i, v := range []*uint64{&vdev.read, &vdev.write, &vdev.checksum} {
+				n, err := parseZpoolSize(fields[2+i])
+				if err != nil {
+					return nil, fmt.Errorf("invalid error count of vdev %s of pool %s: %w", vdev.name, pool.name, err)
+				}
+				*v = n
+			}
+			pool.vdevs = append(pool.vdevs, vdev)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	for i := range pools {
+		setZpoolVdevTypes(&pools[i])
+	}
+	return pools, nil
+}
+
+// setZpoolVdevTypes derives the types of vdevs from their names and position
+// in the tree, e.g. mirror for mirror-0.
+func setZpoolVdevTypes(pool *zpoolStatus) {
+	for i := range pool.vdevs {
+		vdev := &pool.vdevs[i]
+		leaf := i+1 == len(pool.vdevs) || pool.vdevs[i+1].depth <= vdev.depth
+		switch {
+		case vdev.depth == 0 && vdev.name == pool.name:
+			vdev.vdevType = "root"
+		case !leaf:
+			if m := zpoolVdevGroupRE.FindStringSubmatch(vdev.name); m != nil {
+				vdev.vdevType = m[1]
+			} else {
+				vdev.vdevType = "unknown"
+			}
+		case strings.HasPrefix(vdev.name, "/") && !strings.HasPrefix(vdev.name, "/dev/"):
+			vdev.vdevType = "file"
+		default:
+			vdev.vdevType = "disk"
+		}
+	}
+}
+
+func parseZpoolScan(value string) (*zpoolScan, error) {
+	scan := &zpoolScan{progress: -1}
+	var err error
+	if m := zpoolScanFinishedRE.FindStringSubmatch(value); m != nil {
+		scan.function = "scrub"
+		scan.finished = true
+		if m[1] == "resilvered" {
+			scan.function = "resilver"
+		}
+		if scan.processed, err = parseZpoolSize(m[2]); err != nil {
+			return nil, err
+		}
+		if scan.errors, err = strconv.ParseUint(m[3], 10, 64); err != nil {
+			return nil, err
+		}
+		scan.end, err = parseZpoolTime(m[4])
+		return scan, err
+	}
+	if m := zpoolScanRunningRE.FindStringSubmatch(value); m != nil {
+		scan.function = m[1]
+		scan.running = m[2] == "in progress"
+		scan.start, err = parseZpoolTime(m[3])
+		return scan, err
+	}
+	if m := zpoolScanCanceledRE.FindStringSubmatch(value); m != nil {
+		scan.function = m[1]
+		scan.end, err = parseZpoolTime(m[2])
+		return scan, err
+	}
+	// E.g. "none requested".
+	return nil, nil
+}
+
+// parseZpoolScanProgress parses the lines following the scan line of running
+// or paused scans.
+func parseZpoolScanProgress(scan *zpoolScan, line string) error {
+	var err error
+	if m := zpoolScanIssuedRE.FindStringSubmatch(line); m != nil {
+		if scan.examined, err = parseZpoolSize(m[1]); err != nil {
+			return err
+		}
+		if scan.issued, err = parseZpoolSize(m[2]); err != nil {
+			return err
+		}
+		scan.total, err = parseZpoolSize(m[3])
+		return err
+	}
+	if m := zpoolScanScannedRE.FindStringSubmatch(line); m != nil {
+		if scan.examined, err = parseZpoolSize(m[1]); err != nil {
+			return err
+		}
+		scan.issued = scan.examined
+		scan.total, err = parseZpoolSize(m[2])
+		return err
+	}
+	if m := zpoolScanProcessedRE.FindStringSubmatch(line); m != nil {
+		if scan.processed, err = parseZpoolSize(m[1]); err != nil {
+			return err
+		}
+		percent, err := strconv.ParseFloat(m[2], 64)
+		if err != nil {
+			return err
+		}
+		scan.progress = percent / 100
+	}
+	return nil
+}
+
+// parseZpoolSize parses exact numbers as printed with -p as well as the
+// human-readable sizes zpool prints for scans, e.g. 1.50T.
+func parseZpoolSize(s string) (uint64, error) {
+	if n, err := strconv.ParseUint(s, 10, 64); err == nil {
+		return n, nil
+	}
+	s = strings.TrimSuffix(s, "B")
+	if s == "" {
+		return 0, fmt.Errorf("invalid size")
+	}
+	multiplier := 1.0
+	if i := strings.IndexByte("KMGTPE", s[len(s)-1]); i >= 0 {
+		for ; i >= 0; i-- {
+			multiplier *= 1024
+		}
+		s = s[:len(s)-1]
+	}
+	f, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	return uint64(f * multiplier), nil
+}
+
+// parseZpoolTime parses the local times zpool status prints.
+func parseZpoolTime(s string) (time.Time, error) {
+	return time.ParseInLocation("Mon Jan _2 15:04:05 2006", strings.TrimSpace(s), time.Local)
+}
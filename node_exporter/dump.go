@@ -0,0 +1,98 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/version"
+	"github.com/prometheus/node_exporter/collector"
+)
+
+// dumpCollector wraps a NodeCollector to keep the errors of the collectors
+// which failed during the last scrape.
+type dumpCollector struct {
+	*collector.NodeCollector
+	failed map[string]error
+}
+
+// Collect implements the prometheus.Collector interface.
+func (c *dumpCollector) Collect(ch chan<- prometheus.Metric) {
+	c.failed = c.Scrape(ch)
+}
+
+// dumpMetrics runs the enabled collectors once and writes their metrics in
+// the text exposition format to path, or to stdout if path is "-". It returns
+// an error if any collector failed, after writing the metrics of the others.
+func dumpMetrics(path string, logger log.Logger) error {
+	nc, err := collector.NewNodeCollector(logger)
+	if err != nil {
+		return fmt.Errorf("couldn't create collector: %s", err)
+	}
+	dc := &dumpCollector{NodeCollector: nc}
+
+	r := prometheus.NewRegistry()
+	r.MustRegister(version.NewCollector("node_exporter"))
+	if err := r.Register(dc); err != nil {
+		return fmt.Errorf("couldn't register node collector: %s", err)
+	}
+	mfs, gatherErr := r.Gather()
+
+	if path == "-" {
+		err = writeMetrics(os.Stdout, mfs)
+	} else {
+		var f *os.File
+		if f, err = os.Create(path); err != nil {
+			return err
+		}
+		err = writeMetrics(f, mfs)
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't write metrics: %s", err)
+	}
+
+	if gatherErr != nil {
+		return fmt.Errorf("couldn't gather metrics: %s", gatherErr)
+	}
+	if len(dc.failed) > 0 {
+		names := make([]string, 0, len(dc.failed))
+		for name := range dc.failed {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return fmt.Errorf("collectors failed: %s", strings.Join(names, ", "))
+	}
+	return nil
+}
+
+func writeMetrics(w io.Writer, mfs []*dto.MetricFamily) error {
+	enc := expfmt.NewEncoder(w, expfmt.FmtText)
+	for _, mf := range mfs {
+		if err := enc.Encode(mf); err != nil {
+			return err
+		}
+	}
+	return nil
+}
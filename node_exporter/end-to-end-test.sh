@@ -32,6 +32,8 @@ enabled_collectors=$(cat << COLLECTORS
   netstat
   nfs
   nfsd
+  numa
+  pcidevice
   pressure
   qdisc
   rapl
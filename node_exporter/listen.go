@@ -0,0 +1,70 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/go-kit/log"
+	"github.com/go-kit/log/level"
+	"github.com/prometheus/exporter-toolkit/web"
+)
+
+// unixPrefix marks listen addresses which are paths of unix domain sockets.
+const unixPrefix = "unix:"
+
+// listen returns the listeners to serve on: the sockets passed by systemd if
+// systemdSocket is set, otherwise a listener on address. Addresses starting
+// with unix: are unix domain sockets, created with the given permissions.
+func listen(address string, systemdSocket bool, socketMode os.FileMode) ([]net.Listener, error) {
+	if systemdSocket {
+		return systemdListeners()
+	}
+	if !strings.HasPrefix(address, unixPrefix) {
+		l, err := net.Listen("tcp", address)
+		if err != nil {
+			return nil, err
+		}
+		return []net.Listener{l}, nil
+	}
+	return unixListeners(strings.TrimPrefix(address, unixPrefix), socketMode)
+}
+
+// parseSocketMode parses the octal permissions of a unix domain socket.
+func parseSocketMode(s string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(s, 8, 32)
+	if err != nil || mode&^uint64(os.ModePerm) != 0 {
+		return 0, fmt.Errorf("invalid socket mode: %q", s)
+	}
+	return os.FileMode(mode), nil
+}
+
+// serve serves handler on all listeners, with TLS and authentication
+// configured by configFile, and returns once serving on one of them fails.
+// A nil handler serves http.DefaultServeMux.
+func serve(listeners []net.Listener, handler http.Handler, configFile string, logger log.Logger) error {
+	errs := make(chan error, len(listeners))
+	for _, l := range listeners {
+		go func(l net.Listener) {
+			level.Info(logger).Log("msg", "Listening on", "address", l.Addr())
+			errs <- web.Serve(l, &http.Server{Handler: handler}, configFile, logger)
+		}(l)
+	}
+	return <-errs
+}
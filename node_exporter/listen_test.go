@@ -0,0 +1,197 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/go-kit/log"
+)
+
+// unixClient returns an HTTP client connecting to the unix socket at path.
+func unixClient(path string) *http.Client {
+	return &http.Client{
+		Timeout: 5 * time.Second,
+		Transport: &http.Transport{
+			DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+				return (&net.Dialer{}).DialContext(ctx, "unix", path)
+			},
+		},
+	}
+}
+
+func TestUnixSocketListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "node_exporter.sock")
+
+	// A stale socket is replaced.
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	stale.Close()
+
+	umask := syscall.Umask(0022)
+	defer syscall.Umask(umask)
+	listeners, err := listen(unixPrefix+path, false, 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if restored := syscall.Umask(0022); restored != 0022 {
+		t.Errorf("want umask 0022 restored, got %#o", restored)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&os.ModeSocket == 0 || fi.Mode().Perm() != 0600 {
+		t.Errorf("want socket with mode 0600, got %s", fi.Mode())
+	}
+
+	// The web config applies to unix sockets, too.
+	config := filepath.Join(dir, "web-config.yml")
+	if err := ioutil.WriteFile(config, []byte("basic_auth_users:\n  alice: $2a$04$ExT.v.QpqYQkkVxgbY3Uy.fAFvOhgITfEqek8xwSrv7gJrcLFnKzO\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	})
+	go serve(listeners, handler, config, log.NewNopLogger())
+	defer listeners[0].Close()
+
+	client := unixClient(path)
+	for _, tc := range []struct {
+		password string
+		want     int
+	}{
+		{"", http.StatusUnauthorized},
+		{"secret", http.StatusOK},
+	} {
+		req, err := http.NewRequest("GET", "http://localhost/metrics", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if tc.password != "" {
+			req.SetBasicAuth("alice", tc.password)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		if resp.StatusCode != tc.want {
+			t.Errorf("password %q: want status %d, got %d", tc.password, tc.want, resp.StatusCode)
+		}
+	}
+}
+
+func TestParseSocketMode(t *testing.T) {
+	if mode, err := parseSocketMode("0660"); err != nil || mode != 0660 {
+		t.Errorf("want 0660, got %o (%v)", mode, err)
+	}
+	for _, s := range []string{"", "0960", "17777"} {
+		if _, err := parseSocketMode(s); err == nil {
+			t.Errorf("%q: want error, got none", s)
+		}
+	}
+}
+
+// TestSystemdListenerHelper serves on the sockets passed by systemd socket
+// activation when run by TestSystemdListener.
+func TestSystemdListenerHelper(t *testing.T) {
+	if os.Getenv("NODE_EXPORTER_TEST_SYSTEMD_HELPER") != "1" {
+		t.Skip("only run by TestSystemdListener")
+	}
+	// systemd sets the pid of the activated process.
+	os.Setenv("LISTEN_PID", strconv.Itoa(os.Getpid()))
+	listeners, err := listen(":0", true, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("activated"))
+	})
+	t.Fatal(serve(listeners, handler, "", log.NewNopLogger()))
+}
+
+func TestSystemdListener(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node_exporter")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "node_exporter.sock")
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+	f, err := l.(*net.UnixListener).File()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSystemdListenerHelper$")
+	cmd.Env = append(os.Environ(), "NODE_EXPORTER_TEST_SYSTEMD_HELPER=1", "LISTEN_FDS=1")
+	// The first extra file is fd 3, where systemd passes the first socket.
+	cmd.ExtraFiles = []*os.File{f}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer func() {
+		cmd.Process.Kill()
+		cmd.Wait()
+	}()
+
+	resp, err := unixClient(path).Get("http://localhost/metrics")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != "activated" {
+		t.Errorf("want response of the activated process, got %q", body)
+	}
+}
+
+func TestSystemdListenerWithoutSockets(t *testing.T) {
+	os.Unsetenv("LISTEN_PID")
+	os.Unsetenv("LISTEN_FDS")
+	if _, err := listen(":0", true, 0); err == nil {
+		t.Error("want error without sockets, got none")
+	}
+}
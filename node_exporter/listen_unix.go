@@ -0,0 +1,69 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !windows
+// +build !windows
+
+package main
+
+import (
+	"errors"
+	"net"
+	"os"
+	"syscall"
+
+	"github.com/coreos/go-systemd/activation"
+)
+
+// unixListeners returns a listener on the unix domain socket at path,
+// created with the given permissions.
+func unixListeners(path string, socketMode os.FileMode) ([]net.Listener, error) {
+	// Remove a socket left behind by an unclean shutdown, but nothing else.
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+	// Create the socket accessible by the owner only, so that it can't be
+	// connected to before it has the requested permissions.
+	umask := syscall.Umask(0177)
+	l, err := net.Listen("unix", path)
+	syscall.Umask(umask)
+	if err != nil {
+		return nil, err
+	}
+	if err := os.Chmod(path, socketMode); err != nil {
+		l.Close()
+		return nil, err
+	}
+	return []net.Listener{l}, nil
+}
+
+// systemdListeners returns the sockets passed by systemd socket activation.
+func systemdListeners() ([]net.Listener, error) {
+	all, err := activation.Listeners()
+	if err != nil {
+		return nil, err
+	}
+	var listeners []net.Listener
+	for _, l := range all {
+		// Datagram sockets can't be served.
+		if l != nil {
+			listeners = append(listeners, l)
+		}
+	}
+	if len(listeners) == 0 {
+		return nil, errors.New("no sockets passed by systemd")
+	}
+	return listeners, nil
+}
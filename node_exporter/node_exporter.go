@@ -14,6 +14,7 @@
 package main
 
 import (
+	"encoding/json"
 	"fmt"
 	stdlog "log"
 	"net/http"
@@ -31,7 +32,6 @@ import (
 	promcollectors "github.com/prometheus/client_golang/prometheus/collectors"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"github.com/prometheus/common/version"
-	"github.com/prometheus/exporter-toolkit/web"
 	"github.com/prometheus/node_exporter/collector"
 	kingpin "gopkg.in/alecthomas/kingpin.v2"
 )
@@ -140,11 +140,22 @@ func (h *handler) innerHandler(filters ...string) (http.Handler, error) {
 	return handler, nil
 }
 
+// collectorProfileHandler returns the cost of the enabled collectors over
+// their recent scrapes as JSON.
+func collectorProfileHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(collector.Profiles()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
 func main() {
 	var (
 		listenAddress = kingpin.Flag(
 			"web.listen-address",
-			"Address on which to expose metrics and web interface.",
+			"Address on which to expose metrics and web interface, or unix:<path> for a unix domain socket.",
 		).Default(":9100").String()
 		metricsPath = kingpin.Flag(
 			"web.telemetry-path",
@@ -166,6 +177,30 @@ func main() {
 			"web.config",
 			"[EXPERIMENTAL] Path to config yaml file that can enable TLS or authentication.",
 		).Default("").String()
+		systemdSocket = kingpin.Flag(
+			"web.systemd-socket",
+			"Serve on the sockets passed by systemd socket activation instead of --web.listen-address.",
+		).Default("false").Bool()
+		socketMode = kingpin.Flag(
+			"web.socket-mode",
+			"Octal permissions of the unix domain socket if --web.listen-address is unix:<path>.",
+		).Default("0660").String()
+		enableCollectorProfiling = kingpin.Flag(
+			"web.enable-collector-profiling",
+			"Record the cost of each collector and expose it on /debug/collectors.",
+		).Default("false").Bool()
+		dump = kingpin.Flag(
+			"dump",
+			"Run the enabled collectors once, write their metrics to --dump.file and exit. Exits non-zero if a collector failed.",
+		).Default("false").Bool()
+		dumpFile = kingpin.Flag(
+			"dump.file",
+			"File to write the metrics to with --dump, - for stdout.",
+		).Default("-").String()
+		captureFixtures = kingpin.Flag(
+			"capture-fixtures",
+			"Run the enabled collectors once, write the procfs and sysfs files they read to this ttar archive and exit. Only supported on Linux on amd64 and arm64.",
+		).Default("").String()
 	)
 
 	promlogConfig := &promlog.Config{}
@@ -185,20 +220,41 @@ func main() {
 		level.Warn(logger).Log("msg", "Node Exporter is running as root user. This exporter is designed to run as unpriviledged user, root is not required.")
 	}
 
+	if *captureFixtures != "" {
+		if err := captureFixturesTo(*captureFixtures, logger); err != nil {
+			level.Error(logger).Log("msg", "Couldn't capture fixtures", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+	if *dump {
+		if err := dumpMetrics(*dumpFile, logger); err != nil {
+			level.Error(logger).Log("msg", "Couldn't dump metrics", "err", err)
+			os.Exit(1)
+		}
+		return
+	}
+
+	if *enableCollectorProfiling {
+		collector.EnableProfiling()
+		http.HandleFunc("/debug/collectors", collectorProfileHandler)
+	}
 	http.Handle(*metricsPath, newHandler(!*disableExporterMetrics, *maxRequests, logger))
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		w.Write([]byte(`<html>
-			<head><title>Node Exporter</title></head>
-			<body>
-			<h1>Node Exporter</h1>
-			<p><a href="` + *metricsPath + `">Metrics</a></p>
-			</body>
-			</html>`))
-	})
-
-	level.Info(logger).Log("msg", "Listening on", "address", *listenAddress)
-	server := &http.Server{Addr: *listenAddress}
-	if err := web.ListenAndServe(server, *configFile, logger); err != nil {
+	status := newStatusHandler(*metricsPath, *enableCollectorProfiling)
+	http.HandleFunc("/api/v1/status", status.serveJSON)
+	http.HandleFunc("/", status.serveHTML)
+
+	mode, err := parseSocketMode(*socketMode)
+	if err != nil {
+		level.Error(logger).Log("err", err)
+		os.Exit(1)
+	}
+	listeners, err := listen(*listenAddress, *systemdSocket, mode)
+	if err != nil {
+		level.Error(logger).Log("msg", "Couldn't listen", "err", err)
+		os.Exit(1)
+	}
+	if err := serve(listeners, nil, *configFile, logger); err != nil {
 		level.Error(logger).Log("err", err)
 		os.Exit(1)
 	}
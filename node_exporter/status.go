@@ -0,0 +1,189 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/common/version"
+	"github.com/prometheus/node_exporter/collector"
+	kingpin "gopkg.in/alecthomas/kingpin.v2"
+)
+
+// status is the state of the exporter shown on the landing page and served
+// as JSON on /api/v1/status.
+type status struct {
+	Version     versionStatus               `json:"version"`
+	StartTime   time.Time                   `json:"start_time"`
+	MetricsPath string                      `json:"metrics_path"`
+	Collectors  []collector.CollectorStatus `json:"collectors"`
+	// Flags holds the effective values of the command-line flags, except
+	// those enabling or disabling collectors, which are part of Collectors.
+	Flags []flagStatus `json:"flags"`
+}
+
+type versionStatus struct {
+	Version   string `json:"version"`
+	Revision  string `json:"revision"`
+	Branch    string `json:"branch"`
+	BuildUser string `json:"build_user"`
+	BuildDate string `json:"build_date"`
+	GoVersion string `json:"go_version"`
+}
+
+type flagStatus struct {
+	Name    string `json:"name"`
+	Value   string `json:"value"`
+	Default string `json:"default"`
+}
+
+// statusHandler serves the landing page and its JSON equivalent.
+type statusHandler struct {
+	metricsPath string
+	startTime   time.Time
+	profiling   bool
+}
+
+func newStatusHandler(metricsPath string, profiling bool) *statusHandler {
+	return &statusHandler{
+		metricsPath: metricsPath,
+		startTime:   time.Now(),
+		profiling:   profiling,
+	}
+}
+
+func (h *statusHandler) status() status {
+	s := status{
+		Version: versionStatus{
+			Version:   version.Version,
+			Revision:  version.Revision,
+			Branch:    version.Branch,
+			BuildUser: version.BuildUser,
+			BuildDate: version.BuildDate,
+			GoVersion: version.GoVersion,
+		},
+		StartTime:   h.startTime,
+		MetricsPath: h.metricsPath,
+		Collectors:  collector.CollectorStatuses(),
+		Flags:       []flagStatus{},
+	}
+
+	toggles := make(map[string]bool, len(s.Collectors))
+	for _, c := range s.Collectors {
+		toggles["collector."+c.Name] = true
+	}
+	for _, f := range kingpin.CommandLine.Model().Flags {
+		if f.Hidden || toggles[f.Name] || f.Name == "help" || f.Name == "version" {
+			continue
+		}
+		s.Flags = append(s.Flags, flagStatus{
+			Name:    f.Name,
+			Value:   f.Value.String(),
+			Default: strings.Join(f.Default, ","),
+		})
+	}
+	sort.Slice(s.Flags, func(i, j int) bool {
+		return s.Flags[i].Name < s.Flags[j].Name
+	})
+	return s
+}
+
+// serveHTML serves the landing page.
+func (h *statusHandler) serveHTML(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	data := struct {
+		status
+		Profiling bool
+	}{h.status(), h.profiling}
+	if err := statusTemplate.Execute(w, data); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// serveJSON serves the status as JSON.
+func (h *statusHandler) serveJSON(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(h.status()); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+var statusTemplate = template.Must(template.New("status").Funcs(template.FuncMap{
+	"filteredScrape": func(metricsPath, name string) string {
+		return metricsPath + "?" + url.Values{"collect[]": {name}}.Encode()
+	},
+	"formatDuration": func(seconds float64) string {
+		return time.Duration(seconds * float64(time.Second)).Round(time.Microsecond).String()
+	},
+	"formatTime": func(t time.Time) string {
+		return t.Format(time.RFC3339)
+	},
+}).Parse(`<html>
+<head>
+<title>Node Exporter</title>
+<style>
+body { font-family: sans-serif; }
+table { border-collapse: collapse; }
+th, td { border: 1px solid #ccc; padding: 2px 8px; text-align: left; }
+.failed { color: #c00; }
+</style>
+</head>
+<body>
+<h1>Node Exporter</h1>
+<p>
+Version {{.Version.Version}} (branch {{.Version.Branch}}, revision {{.Version.Revision}}), started {{formatTime .StartTime}}.
+</p>
+<p>
+<a href="{{.MetricsPath}}">Metrics</a>
+| <a href="/api/v1/status">Status as JSON</a>
+{{- if .Profiling}}
+| <a href="/debug/collectors">Collector profiles</a>
+{{- end}}
+</p>
+<h2>Collectors</h2>
+<table>
+<tr><th>Collector</th><th>State</th><th>Last scrape</th><th>Duration</th><th>Result</th><th></th></tr>
+{{- range .Collectors}}
+<tr>
+<td>{{.Name}}</td>
+<td>{{if .Enabled}}enabled{{else}}disabled{{end}}{{if .Forced}} (forced){{end}}</td>
+{{- with .LastScrape}}
+<td>{{formatTime .Time}}</td>
+<td>{{formatDuration .DurationSeconds}}</td>
+<td{{if not .Success}} class="failed"{{end}}>{{if .Success}}success{{else if .Error}}{{.Error}}{{else}}failed{{end}}</td>
+{{- else}}
+<td></td><td></td><td></td>
+{{- end}}
+<td>{{if .Enabled}}<a href="{{filteredScrape $.MetricsPath .Name}}">Metrics</a>{{end}}</td>
+</tr>
+{{- end}}
+</table>
+<h2>Flags</h2>
+<table>
+<tr><th>Flag</th><th>Value</th><th>Default</th></tr>
+{{- range .Flags}}
+<tr><td>--{{.Name}}</td><td>{{.Value}}</td><td>{{.Default}}</td></tr>
+{{- end}}
+</table>
+</body>
+</html>
+`))
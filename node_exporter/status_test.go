@@ -0,0 +1,51 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package main
+
+import (
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestStatusHandler(t *testing.T) {
+	h := newStatusHandler("/metrics", false)
+
+	rec := httptest.NewRecorder()
+	h.serveJSON(rec, httptest.NewRequest("GET", "/api/v1/status", nil))
+	var s status
+	if err := json.NewDecoder(rec.Body).Decode(&s); err != nil {
+		t.Fatal(err)
+	}
+	var hasCollector, hasFlag bool
+	for _, c := range s.Collectors {
+		hasCollector = hasCollector || c.Name == "loadavg"
+	}
+	for _, f := range s.Flags {
+		hasFlag = hasFlag || f.Name == "path.procfs"
+		if f.Name == "collector.loadavg" {
+			t.Error("collector toggles should not be listed as flags")
+		}
+	}
+	if !hasCollector || !hasFlag {
+		t.Errorf("want loadavg collector and path.procfs flag, got %+v", s)
+	}
+
+	rec = httptest.NewRecorder()
+	h.serveHTML(rec, httptest.NewRequest("GET", "/", nil))
+	if body := rec.Body.String(); !strings.Contains(body, "<td>loadavg</td>") {
+		t.Errorf("landing page misses the loadavg collector:\n%s", body)
+	}
+}